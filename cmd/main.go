@@ -9,11 +9,16 @@ import (
 	"github.com/overload-ak/cosmos-firewall/logger"
 )
 
+// log is the logger of the main subsystem.
+var log = logger.Named("main")
+
 const (
 	flagLogLevel                    = "log_level"
 	flagRpcAddress                  = "rpc_address"
 	flagGrpcAddress                 = "grpc_address"
 	flagRestAddress                 = "rest_address"
+	flagEVMRPCEnable                = "evm_rpc.enable"
+	flagEVMRPCAddress               = "evm_rpc.address"
 	flagChainId                     = "chain.chain_id"
 	flagForward                     = "chain.forward"
 	flagJsonRpc                     = "chain.json_rpc"
@@ -25,11 +30,28 @@ const (
 	flagWhiteRouters                = "chain.white_routers"
 	flagExtensionOptions            = "chain.extension_options"
 	flagNonCriticalExtensionOptions = "chain.non_critical_extension_options"
+	flagAllowedExtensionOptions     = "chain.allowed_extension_options"
+	flagAllowedNonCriticalOptions   = "chain.allowed_non_critical_extension_options"
 	flagGranter                     = "chain.granter"
 	flagPayer                       = "chain.payer"
 	flagSignerInfos                 = "chain.signer_infos"
 	flagMinimumSignatures           = "chain.minimum_signatures"
+	flagMaximumTxBytes              = "chain.maximum_tx_bytes"
+	flagMaximumMessages             = "chain.maximum_messages"
+	flagMaximumMessagesPerType      = "chain.maximum_messages_per_type"
+	flagMaximumGasLimit             = "chain.maximum_gas_limit"
+	flagMaximumSignatures           = "chain.maximum_signatures"
+	flagMaximumTimeoutHeight        = "chain.maximum_timeout_height"
 	flagPublicKeyTypeUrl            = "chain.public_key_type_url"
+	flagStrictDecoding              = "chain.strict_decoding"
+	flagEVMChainId                  = "chain.evm.chain_id"
+	flagEVMAllowUnprotectedTxs      = "chain.evm.allow_unprotected_txs"
+	flagEVMMinimumGasLimit          = "chain.evm.minimum_gas_limit"
+	flagEVMMaximumGasLimit          = "chain.evm.maximum_gas_limit"
+	flagEVMMinimumGasPrice          = "chain.evm.minimum_gas_price"
+	flagEVMMinimumGasTipCap         = "chain.evm.minimum_gas_tip_cap"
+	flagEVMContractCreation         = "chain.evm.contract_creation"
+	flagEVMDeniedToAddresses        = "chain.evm.denied_to_addresses"
 
 	flagRequestType = "request_type"
 )
@@ -43,7 +65,9 @@ func main() {
 				return err
 			}
 			// Initialize log level
-			logger.Init(viper.GetString(flagLogLevel))
+			if err := logger.Setup(viper.GetString(flagLogLevel), logger.Options{}); err != nil {
+				return err
+			}
 			// Set the configuration file name and path
 			viper.AddConfigPath(".")
 			viper.AddConfigPath("./config")
@@ -56,7 +80,8 @@ func main() {
 	rootCmd.AddCommand(start())
 	rootCmd.AddCommand(verify())
 	rootCmd.AddCommand(list())
-	rootCmd.PersistentFlags().String(flagLogLevel, "info", "the logging level (debug|info|warn|error|dpanic|panic|fatal)")
+	rootCmd.AddCommand(hashKey())
+	rootCmd.PersistentFlags().String(flagLogLevel, "info", "the logging level (debug|info|warn|error|dpanic|panic|fatal), and of the subsystems as in node=debug,handler=warn")
 	rootCmd.PersistentFlags().StringP(flagChainId, "c", "", "the chain id")
 	rootCmd.PersistentFlags().String("config", "", "config file")
 	SilenceCmdErrors(rootCmd)
@@ -82,10 +107,10 @@ func verify() *cobra.Command {
 				isVerify = validator.IsJSONPRCRouterAllowed(args[0])
 			}
 			if !isVerify {
-				logger.Warnf("Router: \"%s\" is not allowed", args[0])
+				log.Warnf("Router: \"%s\" is not allowed", args[0])
 				return nil
 			}
-			logger.Infof("Router: \"%s\" is allowed", args[0])
+			log.Infof("Router: \"%s\" is allowed", args[0])
 			return nil
 		},
 	}
@@ -109,11 +134,24 @@ func list() *cobra.Command {
 			default:
 				routers = validator.Routers.GetRPCRouters()
 			}
-			logger.Infof("====== %v total Routers: %v ======", args[1], len(routers))
+			log.Infof("====== %v total Routers: %v ======", args[1], len(routers))
 			for _, router := range routers {
-				logger.Info(router)
+				log.Info(router)
 			}
-			logger.Infof("====== end ======")
+			log.Infof("====== end ======")
+			return nil
+		},
+	}
+	return cmd
+}
+
+func hashKey() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hash-key [api_key]",
+		Short: "print the hash of an api key to store in the key file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Println(middleware.HashAPIKey(args[0]))
 			return nil
 		},
 	}
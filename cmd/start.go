@@ -15,9 +15,12 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/application"
 	"github.com/overload-ak/cosmos-firewall/internal/handler"
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
 	"github.com/overload-ak/cosmos-firewall/internal/middleware"
 	"github.com/overload-ak/cosmos-firewall/internal/node"
+	"github.com/overload-ak/cosmos-firewall/internal/tracing"
 	"github.com/overload-ak/cosmos-firewall/internal/types"
 	"github.com/overload-ak/cosmos-firewall/logger"
 )
@@ -37,12 +40,23 @@ func start() *cobra.Command {
 			if err := cfg.ValidateBasic(); err != nil {
 				return err
 			}
+			level := cfg.LogLevel
+			if cmd.Flags().Changed(flagLogLevel) {
+				level = viper.GetString(flagLogLevel)
+				// the levels of the flag override the config file, also when it is reloaded on SIGHUP
+				viper.Set("log-level", level)
+			}
+			if err := logger.Setup(level, cfg.Log.Options()); err != nil {
+				return err
+			}
 			return Run(cfg)
 		},
 	}
 	cmd.Flags().String(flagRpcAddress, config.DefaultJSONRPCAddress, "the service rpc address")
 	cmd.Flags().String(flagGrpcAddress, config.DefaultGRPCAddress, "the service grpc address")
 	cmd.Flags().String(flagRestAddress, config.DefaultRESTAddress, "the service rest address")
+	cmd.Flags().Bool(flagEVMRPCEnable, false, "enable the service evm json rpc")
+	cmd.Flags().String(flagEVMRPCAddress, config.DefaultEVMRPCAddress, "the service evm json rpc address")
 	cmd.Flags().Bool(flagForward, false, "the forward flag")
 	cmd.Flags().String(flagJsonRpc, "", "the chain json rpc flag")
 	cmd.Flags().String(flagGrpc, "", "the chain grpc flag")
@@ -51,18 +65,38 @@ func start() *cobra.Command {
 	cmd.Flags().String(flagMinimumFee, "", "the chain minimum fee")
 	cmd.Flags().Uint64(flagMaxMemo, 256, "the chain max memo")
 	cmd.Flags().StringSlice(flagWhiteRouters, []string{""}, "the chain white routers")
-	cmd.Flags().Int(flagExtensionOptions, 0, "the chain extension options")
-	cmd.Flags().Int(flagNonCriticalExtensionOptions, 0, "the chain non critical extension options")
+	cmd.Flags().Int(flagExtensionOptions, 0, "the chain extension options, deprecated")
+	cmd.Flags().Int(flagNonCriticalExtensionOptions, 0, "the chain non critical extension options, deprecated")
+	cmd.Flags().StringSlice(flagAllowedExtensionOptions, []string{}, "the chain allowed extension option type urls")
+	cmd.Flags().StringSlice(flagAllowedNonCriticalOptions, []string{}, "the chain allowed non critical extension option type urls")
 	cmd.Flags().Int(flagGranter, 0, "the chain granter")
 	cmd.Flags().Int(flagPayer, 0, "the chain payer")
 	cmd.Flags().Int(flagSignerInfos, 1, "the chain signer infos")
 	cmd.Flags().Int(flagMinimumSignatures, 1, "the chain minimum signatures")
+	cmd.Flags().Int(flagMaximumTxBytes, config.DefaultMaxTxBytes, "the chain maximum tx bytes")
+	cmd.Flags().Int(flagMaximumMessages, config.DefaultMaxMessages, "the chain maximum messages")
+	cmd.Flags().Int(flagMaximumMessagesPerType, 0, "the chain maximum messages per type")
+	cmd.Flags().Uint64(flagMaximumGasLimit, config.DefaultMaxGasLimit, "the chain maximum gas limit")
+	cmd.Flags().Int(flagMaximumSignatures, config.DefaultMaxSignatures, "the chain maximum signatures")
+	cmd.Flags().Uint64(flagMaximumTimeoutHeight, 0, "the chain maximum timeout height distance")
 	cmd.Flags().StringSlice(flagPublicKeyTypeUrl, []string{""}, "the chain public key type url")
+	cmd.Flags().Bool(flagStrictDecoding, true, "the chain strict tx decoding")
+	cmd.Flags().Uint64(flagEVMChainId, 0, "the chain evm EIP-155 chain id")
+	cmd.Flags().Bool(flagEVMAllowUnprotectedTxs, false, "the chain evm allow unprotected txs")
+	cmd.Flags().Uint64(flagEVMMinimumGasLimit, config.DefaultEVMMinGasLimit, "the chain evm minimum gas limit")
+	cmd.Flags().Uint64(flagEVMMaximumGasLimit, 0, "the chain evm maximum gas limit")
+	cmd.Flags().String(flagEVMMinimumGasPrice, "", "the chain evm minimum gas price")
+	cmd.Flags().String(flagEVMMinimumGasTipCap, "", "the chain evm minimum gas tip cap")
+	cmd.Flags().Bool(flagEVMContractCreation, true, "the chain evm contract creation")
+	cmd.Flags().StringSlice(flagEVMDeniedToAddresses, []string{}, "the chain evm denied to addresses")
 	return cmd
 }
 
 func Run(config *config.Config) (err error) {
-	var jsonrpcNodes, grpcNodes, restNodes *node.Node
+	if err = application.SetBech32Prefixes(config.Chain.ChainID); err != nil {
+		return err
+	}
+	var jsonrpcNodes, grpcNodes, restNodes, evmRPCNodes *node.Node
 	if config.Redirect.Enable {
 		light := config.Redirect.Nodes[string(types.LightNode)]
 		fullNode := config.Redirect.Nodes[string(types.FullNode)]
@@ -79,12 +113,65 @@ func Run(config *config.Config) (err error) {
 		if err != nil {
 			return err
 		}
+		if config.EVMRPC.Enable {
+			evmRPCNodes, err = node.NewEVMJSONRPCNode(light.EVMRPCNode, fullNode.EVMRPCNode, archiveNode.EVMRPCNode, config.Redirect.TimeoutSecond, config.Redirect.CheckNodeSecond)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	validator := middleware.NewValidator(config)
+	if jsonrpcNodes != nil {
+		validator.LatestHeight = jsonrpcNodes.LatestHeight
+		if validator.Mempool != nil {
+			validator.MempoolSize = jsonrpcNodes.MempoolSize
+		}
+	}
 	ctx, cancelFn := context.WithCancel(context.Background())
+	if config.Tracing.Enable {
+		shutdown, err := tracing.Init(ctx, config.Tracing)
+		if err != nil {
+			cancelFn()
+			return err
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(shutdownCtx); err != nil {
+				log.Error("failed to flush the spans", "err", err)
+			}
+		}()
+	}
 	g, ctx := errgroup.WithContext(ctx)
 	ListenForQuitSignals(cancelFn)
+	ListenForLogLevelSignals(ctx)
+	if validator.IPFilter != nil {
+		go validator.IPFilter.Watch(ctx)
+	}
+	if validator.Authenticator != nil {
+		go validator.Authenticator.Watch(ctx)
+	}
+	if validator.Auditor != nil {
+		go validator.Auditor.Watch(ctx)
+	}
+	if validator.AccessLogger != nil {
+		go validator.AccessLogger.Watch(ctx)
+	}
+	if validator.MempoolSize != nil {
+		go func() {
+			ticker := time.NewTicker(time.Duration(config.Mempool.PollSecond) * time.Second)
+			defer ticker.Stop()
+			for {
+				jsonrpcNodes.CheckMempool()
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
 	g.Go(func() error {
 		return RunJSONRPCServer(ctx, validator, jsonrpcNodes)
 	})
@@ -94,6 +181,21 @@ func Run(config *config.Config) (err error) {
 	g.Go(func() error {
 		return RunGRPCServer(ctx, validator, grpcNodes)
 	})
+	if config.EVMRPC.Enable {
+		g.Go(func() error {
+			return RunEVMJSONRPCServer(ctx, validator, evmRPCNodes)
+		})
+	}
+	if config.Admin.Enable {
+		g.Go(func() error {
+			return RunAdminServer(ctx, validator)
+		})
+	}
+	if config.Metrics.Enable {
+		g.Go(func() error {
+			return RunMetricsServer(ctx, config.Metrics.Address)
+		})
+	}
 	return g.Wait()
 }
 
@@ -103,12 +205,38 @@ func ListenForQuitSignals(cancelFn context.CancelFunc) {
 	go func() {
 		sig := <-sigCh
 		cancelFn()
-		logger.Info("caught signal", "signal", sig.String())
+		log.Info("caught signal", "signal", sig.String())
+	}()
+}
+
+// ListenForLogLevelSignals reloads the log levels from the config file on SIGHUP, unless
+// they are set by the log_level flag.
+func ListenForLogLevelSignals(ctx context.Context) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigCh:
+			}
+			if err := viper.ReadInConfig(); err != nil {
+				log.Error("failed to reload the config", "err", err)
+				continue
+			}
+			if err := logger.SetLevels(viper.GetString("log-level")); err != nil {
+				log.Error("failed to reload the log levels", "err", err)
+				continue
+			}
+			log.Infof("log levels reloaded: %s", logger.GetLevels().String())
+		}
 	}()
 }
 
 func RunGRPCServer(ctx context.Context, validator middleware.Validator, node *node.Node) error {
-	logger.Infof("start GRPC server listening on %v", validator.Cfg.GRPCAddress)
+	log.Infof("start GRPC server listening on %v", validator.Cfg.GRPCAddress)
 	var director middleware.Director
 	if node != nil {
 		go func() {
@@ -120,7 +248,11 @@ func RunGRPCServer(ctx context.Context, validator middleware.Validator, node *no
 		}()
 		director = middleware.NewRedirect(node).StreamDirector
 	}
-	grpcSrv := grpc.NewServer(grpc.CustomCodec(types.Codec()), grpc.UnknownServiceHandler(handler.TransparentHandler(ctx, validator, director))) //nolint:staticcheck
+	grpcSrv := grpc.NewServer(grpc.CustomCodec(types.Codec()), //nolint:staticcheck
+		grpc.MaxRecvMsgSize(validator.SizeLimits.GRPCMaxRecvBytes()),
+		grpc.MaxSendMsgSize(validator.SizeLimits.GRPCMaxSendBytes()),
+		grpc.ChainStreamInterceptor(handler.StreamInterceptors(validator)...),
+		grpc.UnknownServiceHandler(handler.TransparentHandler(ctx, validator, director)))
 	addr, err := net.Listen("tcp", validator.Cfg.GRPCAddress)
 	if err != nil {
 		return err
@@ -131,17 +263,17 @@ func RunGRPCServer(ctx context.Context, validator middleware.Validator, node *no
 	}()
 	select {
 	case <-ctx.Done():
-		logger.Info("stopping GRPC  server...", "address", validator.Cfg.RestAddress)
+		log.Info("stopping GRPC  server...", "address", validator.Cfg.RestAddress)
 		grpcSrv.Stop()
 		return nil
 	case err = <-errCh:
-		logger.Error("failed to start GRPC server", "err", err)
+		log.Error("failed to start GRPC server", "err", err)
 		return err
 	}
 }
 
 func RunRESTServer(ctx context.Context, validator middleware.Validator, node *node.Node) error {
-	logger.Infof("start REST server listening on %v", validator.Cfg.RestAddress)
+	log.Infof("start REST server listening on %v", validator.Cfg.RestAddress)
 	var director middleware.Director
 	if node != nil {
 		go func() {
@@ -153,24 +285,53 @@ func RunRESTServer(ctx context.Context, validator middleware.Validator, node *no
 		}()
 		director = middleware.NewRedirect(node).HttpDirector
 	}
-	srv := &http.Server{Addr: validator.Cfg.RestAddress, Handler: handler.RestHandler(ctx, validator, director)}
+	srv := &http.Server{Addr: validator.Cfg.RestAddress, Handler: handler.Chain(validator, types.RESTProtocol, handler.RestHandler(ctx, validator, director))}
 	errCh := make(chan error)
 	go func() {
 		errCh <- srv.ListenAndServe()
 	}()
 	select {
 	case <-ctx.Done():
-		logger.Info("stopping REST  server...", "address", validator.Cfg.RestAddress)
+		log.Info("stopping REST  server...", "address", validator.Cfg.RestAddress)
 		return srv.Shutdown(ctx)
 	case err := <-errCh:
-		logger.Error("failed to start REST server", "err", err)
+		log.Error("failed to start REST server", "err", err)
 		return err
 	}
 }
 
 func RunJSONRPCServer(ctx context.Context, validator middleware.Validator, node *node.Node) error {
-	logger.Infof("start JSON-RPC server listening on %v", validator.Cfg.RPCAddress)
+	log.Infof("start JSON-RPC server listening on %v", validator.Cfg.RPCAddress)
+	var director middleware.Director
+	if node != nil {
+		go func() {
+			node.CheckNode()
+			ticker := time.NewTicker(time.Duration(node.CheckNodeSecond) * time.Second)
+			for range ticker.C {
+				node.CheckNode()
+			}
+		}()
+		director = middleware.NewRedirect(node).HttpDirector
+	}
+	srv := &http.Server{Addr: validator.Cfg.RPCAddress, Handler: handler.Chain(validator, types.JSONRPCProtocol, handler.JSONRPCHandler(ctx, validator, director))}
+	errCh := make(chan error)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	select {
+	case <-ctx.Done():
+		log.Info("stopping JSON-RPC  server...", "address", validator.Cfg.RPCAddress)
+		return srv.Shutdown(ctx)
+	case err := <-errCh:
+		log.Error("failed to start JSON-RPC server", "err", err)
+		return err
+	}
+}
+
+func RunEVMJSONRPCServer(ctx context.Context, validator middleware.Validator, node *node.Node) error {
+	log.Infof("start EVM JSON-RPC server listening on %v", validator.Cfg.EVMRPC.Address)
 	var director middleware.Director
+	var latestHeight func() int64
 	if node != nil {
 		go func() {
 			node.CheckNode()
@@ -180,18 +341,55 @@ func RunJSONRPCServer(ctx context.Context, validator middleware.Validator, node
 			}
 		}()
 		director = middleware.NewRedirect(node).HttpDirector
+		latestHeight = node.LatestHeight
+	}
+	srv := &http.Server{Addr: validator.Cfg.EVMRPC.Address, Handler: handler.Chain(validator, types.EVMRPCProtocol, handler.EVMJSONRPCHandler(ctx, validator, director, latestHeight))}
+	errCh := make(chan error)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	select {
+	case <-ctx.Done():
+		log.Info("stopping EVM JSON-RPC  server...", "address", validator.Cfg.EVMRPC.Address)
+		return srv.Shutdown(ctx)
+	case err := <-errCh:
+		log.Error("failed to start EVM JSON-RPC server", "err", err)
+		return err
 	}
-	srv := &http.Server{Addr: validator.Cfg.RPCAddress, Handler: handler.JSONRPCHandler(ctx, validator, director)}
+}
+
+func RunAdminServer(ctx context.Context, validator middleware.Validator) error {
+	log.Infof("start admin server listening on %v", validator.Cfg.Admin.Address)
+	srv := &http.Server{Addr: validator.Cfg.Admin.Address, Handler: handler.AdminHandler(validator)}
+	errCh := make(chan error)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	select {
+	case <-ctx.Done():
+		log.Info("stopping admin server...", "address", validator.Cfg.Admin.Address)
+		return srv.Shutdown(ctx)
+	case err := <-errCh:
+		log.Error("failed to start admin server", "err", err)
+		return err
+	}
+}
+
+func RunMetricsServer(ctx context.Context, address string) error {
+	log.Infof("start metrics server listening on %v", address)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	srv := &http.Server{Addr: address, Handler: mux}
 	errCh := make(chan error)
 	go func() {
 		errCh <- srv.ListenAndServe()
 	}()
 	select {
 	case <-ctx.Done():
-		logger.Info("stopping JSON-RPC  server...", "address", validator.Cfg.RPCAddress)
+		log.Info("stopping metrics server...", "address", address)
 		return srv.Shutdown(ctx)
 	case err := <-errCh:
-		logger.Error("failed to start JSON-RPC server", "err", err)
+		log.Error("failed to start metrics server", "err", err)
 		return err
 	}
 }
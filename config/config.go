@@ -2,45 +2,409 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"net"
 	"strings"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/overload-ak/cosmos-firewall/internal/types"
+	"github.com/overload-ak/cosmos-firewall/logger"
 )
 
 const (
 	DefaultMinGasLimit = 30000
+	// DefaultMaxGasLimit defines the default gas limit ceiling of a transaction.
+	DefaultMaxGasLimit = 30000000
+	// DefaultMaxTxBytes defines the default size ceiling of a raw transaction, tendermint's default max tx bytes.
+	DefaultMaxTxBytes = 1048576
+	// DefaultMaxMessages defines the default number of messages allowed in a transaction.
+	DefaultMaxMessages = 128
+	// DefaultMaxSignatures defines the default number of signatures allowed in a transaction, the sdk's default TxSigLimit.
+	DefaultMaxSignatures = 7
+	// DefaultEVMMinGasLimit defines the intrinsic gas of a plain ethereum transfer.
+	DefaultEVMMinGasLimit = 21000
 	// DefaultRESTAddress defines the default address to bind the API server to.
 	DefaultRESTAddress = "tcp://0.0.0.0:1317"
 	// DefaultGRPCAddress defines the default address to bind the gRPC server to.
 	DefaultGRPCAddress = "0.0.0.0:9090"
 	// DefaultJSONRPCAddress defines the default address to bind the gRPC server to.
 	DefaultJSONRPCAddress = "tcp://0.0.0.0:26657"
+	// DefaultEVMRPCAddress defines the default address to bind the EVM JSON-RPC server to.
+	DefaultEVMRPCAddress = "0.0.0.0:8545"
+	// DefaultEVMRPCMaxGetLogsBlockRange defines the default block range limit of eth_getLogs.
+	DefaultEVMRPCMaxGetLogsBlockRange = 10000
+	// DefaultEVMRPCMaxCallGas defines the default gas cap of eth_call and eth_estimateGas.
+	DefaultEVMRPCMaxCallGas = 25000000
+	// DefaultMaxRequestBytes defines the default request size limit, large enough for a
+	// base64 encoded tx of DefaultMaxTxBytes and gRPC's default maximum received message size.
+	DefaultMaxRequestBytes = 4194304
+	// DefaultAdminAddress defines the default address to bind the admin server to.
+	DefaultAdminAddress = "127.0.0.1:26680"
+	// DefaultMetricsAddress defines the default address to bind the Prometheus metrics server to.
+	DefaultMetricsAddress = "127.0.0.1:26681"
+	// DefaultTracingEndpoint defines the default address of the OTLP gRPC trace collector.
+	DefaultTracingEndpoint = "127.0.0.1:4317"
+)
+
+// Formats of the REST responses rendered by the firewall, upstream responses are passed on
+// as they are. The gateway format is the grpc-gateway error schema of the cosmos-sdk REST
+// server, the legacy format is the {code, msg, data} envelope.
+const (
+	RESTFormatGateway = "gateway"
+	RESTFormatLegacy  = "legacy"
+)
+
+// Modes of the body log: no bodies, a sample of the bodies, the bodies of the rejected
+// requests or every body.
+const (
+	BodyLogOff      = "off"
+	BodyLogSampled  = "sampled"
+	BodyLogOnReject = "on-reject"
+	BodyLogFull     = "full"
+)
+
+// Tracing exporters.
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
 )
 
 type Config struct {
+	// LogLevel is the default log level and the levels of the subsystems, see logger.ParseLevels.
 	LogLevel    string   `mapstructure:"log-level"`
 	RPCAddress  string   `mapstructure:"rpc-address"`
 	GRPCAddress string   `mapstructure:"grpc-address"`
 	RestAddress string   `mapstructure:"rest-address"`
+	RestFormat  string   `mapstructure:"rest-format"`
+	EVMRPC      EVMRPC   `mapstructure:"evm-rpc"`
 	Chain       Chain    `mapstructure:"chain"`
 	Redirect    Redirect `mapstructure:"redirect"`
+	// TrustedProxies lists the CIDRs whose X-Forwarded-For / X-Real-IP headers are trusted.
+	TrustedProxies []string      `mapstructure:"trusted-proxies"`
+	AccessControl  AccessControl `mapstructure:"access-control"`
+	RateLimit      RateLimit     `mapstructure:"rate-limit"`
+	SignerLimit    SignerLimit   `mapstructure:"signer-limit"`
+	Auth           Auth          `mapstructure:"auth"`
+	Ban            Ban           `mapstructure:"ban"`
+	PoW            PoW           `mapstructure:"pow"`
+	SizeLimit      SizeLimit     `mapstructure:"size-limit"`
+	QueryLimit     QueryLimit    `mapstructure:"query-limit"`
+	Concurrency    Concurrency   `mapstructure:"concurrency"`
+	Mempool        Mempool       `mapstructure:"mempool"`
+	Admin          Admin         `mapstructure:"admin"`
+	Metrics        Metrics       `mapstructure:"metrics"`
+	Tracing        Tracing       `mapstructure:"tracing"`
+	Audit          Audit         `mapstructure:"audit"`
+	AccessLog      AccessLog     `mapstructure:"access-log"`
+	BodyLog        BodyLog       `mapstructure:"body-log"`
+	Log            Log           `mapstructure:"log"`
+}
+
+// PoW defines hashcash style proof of work stamps, bound to the tx hash, required on the
+// broadcasts of the JSON-RPC, gRPC and REST listeners while the broadcast rate exceeds
+// LoadThreshold per second. The challenge rotates every ChallengeSecond and its difficulty,
+// in leading zero bits, grows by a bit every time the rate doubles.
+type PoW struct {
+	Enable          bool    `mapstructure:"enable"`
+	LoadThreshold   float64 `mapstructure:"load-threshold"`
+	MinDifficulty   int     `mapstructure:"min-difficulty"`
+	MaxDifficulty   int     `mapstructure:"max-difficulty"`
+	ChallengeSecond int64   `mapstructure:"challenge-second"`
+	Header          string  `mapstructure:"header"`
+}
+
+// SizeLimit defines the size limits of the requests and of the upstream responses, keyed by
+// protocol, 0 or a missing protocol for no limit. The gRPC limits are the maximum received
+// and sent message sizes. Routes override the request limit of a JSON-RPC URI path, a gRPC
+// full method name or a REST path pattern.
+type SizeLimit struct {
+	MaxRequestBytes  map[string]int64 `mapstructure:"max-request-bytes"`
+	MaxResponseBytes map[string]int64 `mapstructure:"max-response-bytes"`
+	Routes           []RouteSizeLimit `mapstructure:"routes"`
+}
+
+type RouteSizeLimit struct {
+	Protocol        string `mapstructure:"protocol"`
+	Route           string `mapstructure:"route"`
+	MaxRequestBytes int64  `mapstructure:"max-request-bytes"`
+}
+
+// QueryLimit defines the guardrails of heavy queries: the pagination of cosmos queries, sent
+// as REST query parameters or in gRPC requests, the per_page of the paginated JSON-RPC routes
+// and the number of conditions of event queries. A request over a limit is rejected, or with
+// Clamp set its pagination is clamped to the limit, event queries are always rejected.
+type QueryLimit struct {
+	Enable             bool   `mapstructure:"enable"`
+	Clamp              bool   `mapstructure:"clamp"`
+	MaxPaginationLimit uint64 `mapstructure:"max-pagination-limit"`
+	AllowCountTotal    bool   `mapstructure:"allow-count-total"`
+	MaxPerPage         int    `mapstructure:"max-per-page"`
+	MaxEventConditions int    `mapstructure:"max-event-conditions"`
+}
+
+// Concurrency defines the bounds of the requests in flight to each upstream node, in total
+// and per route class ("query", "simulate", "broadcast"). A request over a bound waits up to
+// QueueTimeoutMillis in a queue of QueueSize requests, 0 for no queue. Load is shed cheapest
+// to retry first: queries are rejected once the upstream is ShedRatio full, scaled down while
+// its latency is over TargetLatencyMillis, simulations once it is halfway from there to full,
+// broadcasts only when it is full. HealthReserved health checks in flight are admitted over
+// the bounds, further ones like the other requests of their class.
+type Concurrency struct {
+	Enable              bool           `mapstructure:"enable"`
+	MaxInFlight         int            `mapstructure:"max-in-flight"`
+	ClassMaxInFlight    map[string]int `mapstructure:"class-max-in-flight"`
+	QueueSize           int            `mapstructure:"queue-size"`
+	QueueTimeoutMillis  int64          `mapstructure:"queue-timeout-millis"`
+	ShedRatio           float64        `mapstructure:"shed-ratio"`
+	TargetLatencyMillis int64          `mapstructure:"target-latency-millis"`
+	HealthReserved      int            `mapstructure:"health-reserved"`
+}
+
+// Mempool defines the backpressure on broadcasts while the mempools of the upstream JSON-RPC
+// nodes, polled every PollSecond, fill up. Over a throttle threshold broadcasts are limited to
+// ThrottleRate per second, over a reject threshold they are rejected. Txs whose messages are
+// all white routers have priority and are neither throttled nor rejected. A threshold of 0 is not checked.
+type Mempool struct {
+	Enable        bool    `mapstructure:"enable"`
+	PollSecond    int64   `mapstructure:"poll-second"`
+	ThrottleTxs   int64   `mapstructure:"throttle-txs"`
+	ThrottleBytes int64   `mapstructure:"throttle-bytes"`
+	ThrottleRate  float64 `mapstructure:"throttle-rate"`
+	RejectTxs     int64   `mapstructure:"reject-txs"`
+	RejectBytes   int64   `mapstructure:"reject-bytes"`
+}
+
+// Admin defines the listener of the operator endpoints, which must not be reachable by clients.
+type Admin struct {
+	Enable  bool   `mapstructure:"enable"`
+	Address string `mapstructure:"address"`
+	Format  string `mapstructure:"format"`
+}
+
+// Metrics defines the listener serving the Prometheus metrics on /metrics.
+type Metrics struct {
+	Enable  bool   `mapstructure:"enable"`
+	Address string `mapstructure:"address"`
+}
+
+// Audit defines the audit log of the tx-bearing requests, one JSON line per tx admitted or
+// rejected appended to File, rotated as set by Rotation.
+type Audit struct {
+	Enable          bool   `mapstructure:"enable"`
+	File            string `mapstructure:"file"`
+	logger.Rotation `mapstructure:",squash"`
+}
+
+// AccessLog defines the access log of the requests, one JSON line per request served appended
+// to File, apart from the application log, rotated as set by Rotation.
+type AccessLog struct {
+	Enable          bool   `mapstructure:"enable"`
+	File            string `mapstructure:"file"`
+	logger.Rotation `mapstructure:",squash"`
+}
+
+// Log defines the format and the output of the application log, rotated as set by Rotation
+// when written to File.
+type Log struct {
+	Format          string `mapstructure:"format"`
+	Output          string `mapstructure:"output"`
+	File            string `mapstructure:"file"`
+	logger.Rotation `mapstructure:",squash"`
+}
+
+// BodyLog defines the logging of the request bodies, at debug level only. Mode selects the
+// bodies logged, SampleRatio of them when sampled, Routes override the mode of a route named
+// as in the size limits. JSON bodies are logged with the txs they carry decoded and the
+// RedactFields replaced at any depth, gRPC bodies as JSON, and bodies are truncated to MaxBytes.
+// The bodies which can not be rendered as JSON are logged in base64, or only by their size and
+// hash when RedactFields is set.
+type BodyLog struct {
+	Mode         string         `mapstructure:"mode"`
+	SampleRatio  float64        `mapstructure:"sample-ratio"`
+	MaxBytes     int            `mapstructure:"max-bytes"`
+	RedactFields []string       `mapstructure:"redact-fields"`
+	Routes       []RouteBodyLog `mapstructure:"routes"`
+}
+
+type RouteBodyLog struct {
+	Protocol string `mapstructure:"protocol"`
+	Route    string `mapstructure:"route"`
+	Mode     string `mapstructure:"mode"`
+}
+
+// Tracing defines the OpenTelemetry spans of the requests, exported to an OTLP gRPC collector
+// at Endpoint, or as JSON to stdout or to File for offline use. SampleRatio of the traces
+// started by the firewall are sampled, a trace propagated by the client keeps its decision.
+type Tracing struct {
+	Enable      bool    `mapstructure:"enable"`
+	Exporter    string  `mapstructure:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	File        string  `mapstructure:"file"`
+	ServiceName string  `mapstructure:"service-name"`
+	SampleRatio float64 `mapstructure:"sample-ratio"`
+}
+
+// Ban defines fail2ban style bans of the client IPs, and of the tx signers, whose requests
+// keep being rejected. Threshold rejections within WindowSecond ban the offender for
+// BanSecond, every further ban within ForgetSecond of the last one lasts Multiplier times
+// longer, up to MaxBanSecond.
+type Ban struct {
+	Enable       bool    `mapstructure:"enable"`
+	Threshold    int     `mapstructure:"threshold"`
+	WindowSecond int64   `mapstructure:"window-second"`
+	BanSecond    int64   `mapstructure:"ban-second"`
+	Multiplier   float64 `mapstructure:"multiplier"`
+	MaxBanSecond int64   `mapstructure:"max-ban-second"`
+	ForgetSecond int64   `mapstructure:"forget-second"`
+	Signers      bool    `mapstructure:"signers"`
+}
+
+// Auth defines API key authentication. Keys are read from KeyFile, which stores the
+// sha256 hashes of the keys, and clients without a key are served by DefaultTier.
+type Auth struct {
+	Enable       bool            `mapstructure:"enable"`
+	KeyFile      string          `mapstructure:"key-file"`
+	ReloadSecond int64           `mapstructure:"reload-second"`
+	Header       string          `mapstructure:"header"`
+	QueryParam   string          `mapstructure:"query-param"`
+	DefaultTier  string          `mapstructure:"default-tier"`
+	Tiers        map[string]Tier `mapstructure:"tiers"`
+	Challenge    ChallengeAuth   `mapstructure:"challenge"`
+}
+
+// ChallengeAuth defines the authentication of chain addresses by a signed ADR-036 challenge.
+// The issued token is sent like an API key and grants Tier to the address.
+type ChallengeAuth struct {
+	Enable          bool   `mapstructure:"enable"`
+	Tier            string `mapstructure:"tier"`
+	ChallengeSecond int64  `mapstructure:"challenge-second"`
+	TokenSecond     int64  `mapstructure:"token-second"`
+
+	MaxChallenges           int `mapstructure:"max-challenges"`
+	MaxChallengesPerAddress int `mapstructure:"max-challenges-per-address"`
+}
+
+// Tier defines the quotas and permissions of the clients of an API key tier. Routes are
+// keyed by protocol, a protocol without routes allows every route the firewall serves.
+// Rules are keyed like the rate limit rules and take precedence over them.
+type Tier struct {
+	Broadcast bool                     `mapstructure:"broadcast"`
+	Routes    map[string][]string      `mapstructure:"routes"`
+	Rules     map[string]RateLimitRule `mapstructure:"rules"`
+}
+
+// SignerLimit defines sliding window limits on the txs broadcast by a signer and on
+// the messages of a type signed by a signer: the sender of an ethereum tx, or the address
+// of a public key of the signer infos of a cosmos tx. Trusted addresses are exempt.
+type SignerLimit struct {
+	Enable           bool           `mapstructure:"enable"`
+	BroadcastLimit   int            `mapstructure:"broadcast-limit"`
+	WindowSecond     int64          `mapstructure:"window-second"`
+	MessageQuotas    []MessageQuota `mapstructure:"message-quotas"`
+	TrustedAddresses []string       `mapstructure:"trusted-addresses"`
+}
+
+type MessageQuota struct {
+	TypeURL      string `mapstructure:"type-url"`
+	Limit        int    `mapstructure:"limit"`
+	WindowSecond int64  `mapstructure:"window-second"`
+}
+
+// AccessControl defines the client IP and country filter applied before a request is read.
+// The lists of the files, one IP or CIDR per line, add to the static lists, and the files
+// and the MaxMind database are reloaded when they change.
+type AccessControl struct {
+	Enable           bool     `mapstructure:"enable"`
+	AllowList        []string `mapstructure:"allow-list"`
+	DenyList         []string `mapstructure:"deny-list"`
+	AllowFile        string   `mapstructure:"allow-file"`
+	DenyFile         string   `mapstructure:"deny-file"`
+	GeoIPDatabase    string   `mapstructure:"geoip-database"`
+	AllowedCountries []string `mapstructure:"allowed-countries"`
+	DeniedCountries  []string `mapstructure:"denied-countries"`
+	ReloadSecond     int64    `mapstructure:"reload-second"`
+}
+
+// RateLimit defines per client IP token buckets. Rules are keyed by protocol
+// ("jsonrpc", "grpc", "rest", "evm-rpc") or by protocol and route class
+// ("query", "simulate", "broadcast"), e.g. "rest-broadcast", which takes precedence.
+// Buckets are counted in cost units, a request costs DefaultCost unless its route is
+// listed in Costs or is one of the built-in heavy routes.
+type RateLimit struct {
+	Enable      bool                     `mapstructure:"enable"`
+	DefaultCost float64                  `mapstructure:"default-cost"`
+	Costs       []RouteCost              `mapstructure:"costs"`
+	Rules       map[string]RateLimitRule `mapstructure:"rules"`
+}
+
+// RouteCost is the cost of a route of a protocol: a JSON-RPC URI path such as "/tx_search",
+// a gRPC full method name, an ethereum JSON-RPC method, or a REST path pattern optionally
+// prefixed with an HTTP method, such as "GET /cosmos/tx/v1beta1/txs".
+type RouteCost struct {
+	Protocol string  `mapstructure:"protocol"`
+	Route    string  `mapstructure:"route"`
+	Cost     float64 `mapstructure:"cost"`
+}
+
+type RateLimitRule struct {
+	RequestsPerSecond float64 `mapstructure:"requests-per-second"`
+	Burst             int     `mapstructure:"burst"`
+}
+
+// EVMRPC defines the ethereum JSON-RPC listener and its method policy.
+type EVMRPC struct {
+	Enable               bool     `mapstructure:"enable"`
+	Address              string   `mapstructure:"address"`
+	AllowedMethods       []string `mapstructure:"allowed-methods"`
+	DeniedMethods        []string `mapstructure:"denied-methods"`
+	MaxGetLogsBlockRange uint64   `mapstructure:"max-get-logs-block-range"`
+	MaxCallGas           uint64   `mapstructure:"max-call-gas"`
 }
 
 type Chain struct {
-	ChainID                     string   `mapstructure:"chain-id"`
-	MinimumGasLimit             uint64   `mapstructure:"minimum-gas-limit"`
-	MinimumFee                  string   `mapstructure:"minimum-fee"`
-	MaxMemo                     int      `mapstructure:"max-memo"`
-	WhiteRouters                []string `mapstructure:"white-routers"`
-	ExtensionOptions            int      `mapstructure:"extension-options"`
+	ChainID                            string   `mapstructure:"chain-id"`
+	MinimumGasLimit                    uint64   `mapstructure:"minimum-gas-limit"`
+	MinimumFee                         string   `mapstructure:"minimum-fee"`
+	MaxMemo                            int      `mapstructure:"max-memo"`
+	WhiteRouters                       []string `mapstructure:"white-routers"`
+	AllowedExtensionOptions            []string `mapstructure:"allowed-extension-options"`
+	AllowedNonCriticalExtensionOptions []string `mapstructure:"allowed-non-critical-extension-options"`
+	// Deprecated: ExtensionOptions not 0 allows any extension option, use AllowedExtensionOptions.
+	ExtensionOptions int `mapstructure:"extension-options"`
+	// Deprecated: NonCriticalExtensionOptions not 0 allows any non-critical extension option,
+	// use AllowedNonCriticalExtensionOptions.
 	NonCriticalExtensionOptions int      `mapstructure:"non-critical-extension-options"`
 	Granter                     int      `mapstructure:"granter"`
 	Payer                       int      `mapstructure:"payer"`
 	SignerInfos                 int      `mapstructure:"signer-infos"`
 	MinimumSignatures           int      `mapstructure:"minimum-signatures"`
+	MaximumTxBytes              int      `mapstructure:"maximum-tx-bytes"`
+	MaximumMessages             int      `mapstructure:"maximum-messages"`
+	MaximumMessagesPerType      int      `mapstructure:"maximum-messages-per-type"`
+	MaximumGasLimit             uint64   `mapstructure:"maximum-gas-limit"`
+	MaximumSignatures           int      `mapstructure:"maximum-signatures"`
+	MaximumTimeoutHeight        uint64   `mapstructure:"maximum-timeout-height"`
 	PublicKeyTypeURL            []string `mapstructure:"public-key-type-url"`
+	StrictDecoding              bool     `mapstructure:"strict-decoding"`
+	EVM                         EVM      `mapstructure:"evm"`
+}
+
+// EVM defines the policy applied to ethermint MsgEthereumTx messages.
+type EVM struct {
+	ChainID             uint64   `mapstructure:"chain-id"`
+	AllowUnprotectedTxs bool     `mapstructure:"allow-unprotected-txs"`
+	MinimumGasLimit     uint64   `mapstructure:"minimum-gas-limit"`
+	MaximumGasLimit     uint64   `mapstructure:"maximum-gas-limit"`
+	MinimumGasPrice     string   `mapstructure:"minimum-gas-price"`
+	MinimumGasTipCap    string   `mapstructure:"minimum-gas-tip-cap"`
+	ContractCreation    bool     `mapstructure:"contract-creation"`
+	DeniedToAddresses   []string `mapstructure:"denied-to-addresses"`
 }
 
 type Redirect struct {
@@ -54,6 +418,7 @@ type NodeConfig struct {
 	JSONRPCNode []string `mapstructure:"json-rpc-nodes"`
 	GRPCNode    []string `mapstructure:"grpc-nodes"`
 	RESTNode    []string `mapstructure:"rest-nodes"`
+	EVMRPCNode  []string `mapstructure:"evm-json-rpc-nodes"`
 }
 
 // SetMinFee sets minimum gas prices.
@@ -79,40 +444,694 @@ func (c *Chain) GetMinFee() sdk.Coins {
 	return fees
 }
 
+// GetMinGasPrice returns the minimum gas price (or fee cap) in wei, nil if not set.
+func (e *EVM) GetMinGasPrice() *big.Int {
+	return parseWei(e.MinimumGasPrice)
+}
+
+// GetMinGasTipCap returns the minimum gas tip cap in wei, nil if not set.
+func (e *EVM) GetMinGasTipCap() *big.Int {
+	return parseWei(e.MinimumGasTipCap)
+}
+
+func parseWei(s string) *big.Int {
+	if s == "" {
+		return nil
+	}
+	wei, ok := new(big.Int).SetString(s, 10)
+	if !ok || wei.Sign() < 0 {
+		panic(fmt.Errorf("failed to parse wei amount (%s)", s))
+	}
+	return wei
+}
+
+// RateLimitRuleKey returns the rule key of a route class of a protocol.
+func RateLimitRuleKey(protocol types.Protocol, class types.RouteClass) string {
+	return fmt.Sprintf("%s-%s", protocol, class)
+}
+
+// ParseCIDRs parses CIDRs, a bare IP is treated as a single address network.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip: %s", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr: %s", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (a AccessControl) ValidateBasic() error {
+	if _, err := ParseCIDRs(a.AllowList); err != nil {
+		return err
+	}
+	if _, err := ParseCIDRs(a.DenyList); err != nil {
+		return err
+	}
+	if (len(a.AllowedCountries) > 0 || len(a.DeniedCountries) > 0) && a.GeoIPDatabase == "" {
+		return fmt.Errorf("country filter requires a geoip database")
+	}
+	for _, country := range append(append([]string{}, a.AllowedCountries...), a.DeniedCountries...) {
+		if len(country) != 2 {
+			return fmt.Errorf("invalid ISO 3166-1 country code: %s", country)
+		}
+	}
+	return nil
+}
+
+func (s SignerLimit) ValidateBasic() error {
+	if s.BroadcastLimit < 0 || (s.BroadcastLimit > 0 && s.WindowSecond <= 0) {
+		return fmt.Errorf("invalid signer broadcast limit: %d per %d seconds", s.BroadcastLimit, s.WindowSecond)
+	}
+	for _, quota := range s.MessageQuotas {
+		if !strings.HasPrefix(quota.TypeURL, "/") {
+			return fmt.Errorf("invalid message quota type url: %s", quota.TypeURL)
+		}
+		if quota.Limit < 0 || quota.WindowSecond <= 0 {
+			return fmt.Errorf("invalid message quota: %s", quota.TypeURL)
+		}
+	}
+	if _, err := ParseAccAddresses(s.TrustedAddresses); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (b Ban) ValidateBasic() error {
+	if !b.Enable {
+		return nil
+	}
+	if b.Threshold <= 0 || b.WindowSecond <= 0 {
+		return fmt.Errorf("invalid ban threshold: %d per %d seconds", b.Threshold, b.WindowSecond)
+	}
+	if b.BanSecond <= 0 || b.MaxBanSecond < b.BanSecond || b.Multiplier < 1 {
+		return fmt.Errorf("invalid ban duration: %d seconds up to %d seconds", b.BanSecond, b.MaxBanSecond)
+	}
+	if b.ForgetSecond < 0 {
+		return fmt.Errorf("invalid ban forget second: %d", b.ForgetSecond)
+	}
+	return nil
+}
+
+func (p PoW) ValidateBasic() error {
+	if !p.Enable {
+		return nil
+	}
+	if p.LoadThreshold < 0 {
+		return fmt.Errorf("invalid pow load threshold: %v", p.LoadThreshold)
+	}
+	if p.MinDifficulty <= 0 || p.MaxDifficulty < p.MinDifficulty || p.MaxDifficulty > 64 {
+		return fmt.Errorf("invalid pow difficulty: %d to %d bits", p.MinDifficulty, p.MaxDifficulty)
+	}
+	if p.ChallengeSecond <= 0 {
+		return fmt.Errorf("invalid pow challenge second: %d", p.ChallengeSecond)
+	}
+	if p.Header == "" {
+		return fmt.Errorf("pow header is empty")
+	}
+	return nil
+}
+
+func (s SizeLimit) ValidateBasic() error {
+	for _, limits := range []map[string]int64{s.MaxRequestBytes, s.MaxResponseBytes} {
+		for protocol, limit := range limits {
+			if !IsProtocol(protocol) {
+				return fmt.Errorf("invalid size limit protocol: %s", protocol)
+			}
+			if limit < 0 || (protocol == string(types.GRPCProtocol) && limit > math.MaxInt32) {
+				return fmt.Errorf("invalid %s size limit: %d", protocol, limit)
+			}
+		}
+	}
+	for _, route := range s.Routes {
+		switch types.Protocol(route.Protocol) {
+		case types.JSONRPCProtocol, types.GRPCProtocol, types.RESTProtocol:
+		default:
+			return fmt.Errorf("invalid size limit route protocol: %s", route.Protocol)
+		}
+		if route.Route == "" || route.MaxRequestBytes < 0 || (route.Protocol == string(types.GRPCProtocol) && route.MaxRequestBytes > math.MaxInt32) {
+			return fmt.Errorf("invalid size limit route: %s %s", route.Protocol, route.Route)
+		}
+	}
+	return nil
+}
+
+func (q QueryLimit) ValidateBasic() error {
+	if !q.Enable {
+		return nil
+	}
+	if q.MaxPaginationLimit == 0 || q.MaxPerPage <= 0 || q.MaxEventConditions <= 0 {
+		return fmt.Errorf("invalid query limits")
+	}
+	return nil
+}
+
+func (c Concurrency) ValidateBasic() error {
+	if !c.Enable {
+		return nil
+	}
+	if c.MaxInFlight <= 0 || c.QueueSize < 0 || c.QueueTimeoutMillis < 0 || c.TargetLatencyMillis < 0 || c.HealthReserved < 0 {
+		return fmt.Errorf("invalid concurrency limits")
+	}
+	if c.ShedRatio <= 0 || c.ShedRatio > 1 {
+		return fmt.Errorf("invalid concurrency shed ratio: %v", c.ShedRatio)
+	}
+	for class, limit := range c.ClassMaxInFlight {
+		switch types.RouteClass(class) {
+		case types.QueryRoute, types.SimulateRoute, types.BroadcastRoute:
+		default:
+			return fmt.Errorf("invalid concurrency route class: %s", class)
+		}
+		if limit < 0 {
+			return fmt.Errorf("invalid concurrency %s limit: %d", class, limit)
+		}
+	}
+	return nil
+}
+
+func (m Mempool) ValidateBasic() error {
+	if !m.Enable {
+		return nil
+	}
+	if m.PollSecond <= 0 || m.ThrottleRate <= 0 {
+		return fmt.Errorf("invalid mempool poll second or throttle rate")
+	}
+	if m.ThrottleTxs < 0 || m.ThrottleBytes < 0 || m.RejectTxs < 0 || m.RejectBytes < 0 {
+		return fmt.Errorf("invalid mempool thresholds")
+	}
+	if (m.ThrottleTxs > 0 && m.RejectTxs > 0 && m.ThrottleTxs > m.RejectTxs) ||
+		(m.ThrottleBytes > 0 && m.RejectBytes > 0 && m.ThrottleBytes > m.RejectBytes) {
+		return fmt.Errorf("mempool throttle thresholds exceed the reject thresholds")
+	}
+	return nil
+}
+
+func (a Audit) ValidateBasic() error {
+	if !a.Enable {
+		return nil
+	}
+	if a.File == "" {
+		return fmt.Errorf("audit file is empty")
+	}
+	return a.Rotation.Validate("audit")
+}
+
+func (a AccessLog) ValidateBasic() error {
+	if !a.Enable {
+		return nil
+	}
+	if a.File == "" {
+		return fmt.Errorf("access log file is empty")
+	}
+	return a.Rotation.Validate("access log")
+}
+
+func (l Log) ValidateBasic() error {
+	switch l.Format {
+	case logger.FormatConsole, logger.FormatJSON:
+	default:
+		return fmt.Errorf("invalid log format: %s", l.Format)
+	}
+	switch l.Output {
+	case logger.OutputStdout, logger.OutputStderr:
+	case logger.OutputFile:
+		if l.File == "" {
+			return fmt.Errorf("log file is empty")
+		}
+		if err := l.Rotation.Validate("log"); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid log output: %s", l.Output)
+	}
+	return nil
+}
+
+// Options returns the logger options of the log.
+func (l Log) Options() logger.Options {
+	return logger.Options{Format: l.Format, Output: l.Output, File: l.File, Rotation: l.Rotation}
+}
+
+func (b BodyLog) ValidateBasic() error {
+	if !IsBodyLogMode(b.Mode) {
+		return fmt.Errorf("invalid body log mode: %s", b.Mode)
+	}
+	if b.SampleRatio < 0 || b.SampleRatio > 1 {
+		return fmt.Errorf("invalid body log sample ratio: %v", b.SampleRatio)
+	}
+	if b.MaxBytes < 0 {
+		return fmt.Errorf("invalid body log max bytes: %d", b.MaxBytes)
+	}
+	for _, route := range b.Routes {
+		if !IsProtocol(route.Protocol) {
+			return fmt.Errorf("invalid body log route protocol: %s", route.Protocol)
+		}
+		if route.Route == "" || !IsBodyLogMode(route.Mode) {
+			return fmt.Errorf("invalid body log route: %s %s", route.Protocol, route.Route)
+		}
+	}
+	return nil
+}
+
+func (t Tracing) ValidateBasic() error {
+	if !t.Enable {
+		return nil
+	}
+	switch t.Exporter {
+	case TracingExporterOTLP:
+		if t.Endpoint == "" {
+			return fmt.Errorf("tracing endpoint is empty")
+		}
+	case TracingExporterStdout:
+	case TracingExporterFile:
+		if t.File == "" {
+			return fmt.Errorf("tracing file is empty")
+		}
+	default:
+		return fmt.Errorf("invalid tracing exporter: %s", t.Exporter)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("invalid tracing sample ratio: %v", t.SampleRatio)
+	}
+	return nil
+}
+
+func (a Auth) ValidateBasic() error {
+	if !a.Enable {
+		return nil
+	}
+	if a.KeyFile == "" {
+		return fmt.Errorf("auth key file is empty")
+	}
+	if a.Header == "" && a.QueryParam == "" {
+		return fmt.Errorf("auth header and query param are empty")
+	}
+	if _, ok := a.Tiers[a.DefaultTier]; !ok {
+		return fmt.Errorf("unknown auth default tier: %s", a.DefaultTier)
+	}
+	if a.Challenge.Enable {
+		if _, ok := a.Tiers[a.Challenge.Tier]; !ok {
+			return fmt.Errorf("unknown auth challenge tier: %s", a.Challenge.Tier)
+		}
+		if a.Challenge.ChallengeSecond <= 0 || a.Challenge.TokenSecond <= 0 {
+			return fmt.Errorf("invalid auth challenge expiry")
+		}
+		if a.Challenge.MaxChallenges <= 0 || a.Challenge.MaxChallengesPerAddress <= 0 {
+			return fmt.Errorf("invalid auth challenge max challenges")
+		}
+	}
+	for name, tier := range a.Tiers {
+		for protocol := range tier.Routes {
+			if !IsProtocol(protocol) {
+				return fmt.Errorf("invalid auth tier %s routes protocol: %s", name, protocol)
+			}
+		}
+		for key, rule := range tier.Rules {
+			if rule.RequestsPerSecond < 0 || rule.Burst < 0 {
+				return fmt.Errorf("invalid auth tier %s rate limit rule: %s", name, key)
+			}
+		}
+	}
+	return nil
+}
+
+// IsProtocol reports whether the name is one of the protocols served by the firewall.
+func IsProtocol(name string) bool {
+	switch types.Protocol(name) {
+	case types.JSONRPCProtocol, types.GRPCProtocol, types.RESTProtocol, types.EVMRPCProtocol:
+		return true
+	}
+	return false
+}
+
+// IsBodyLogMode reports whether name is a mode of the body log.
+func IsBodyLogMode(name string) bool {
+	switch name {
+	case BodyLogOff, BodyLogSampled, BodyLogOnReject, BodyLogFull:
+		return true
+	}
+	return false
+}
+
+// IsRESTFormat reports whether name is a format of the REST responses.
+func IsRESTFormat(name string) bool {
+	return name == RESTFormatGateway || name == RESTFormatLegacy
+}
+
+// ParseAccAddresses parses bech32 or hex addresses into account address bytes.
+func ParseAccAddresses(addresses []string) ([]sdk.AccAddress, error) {
+	accAddresses := make([]sdk.AccAddress, 0, len(addresses))
+	for _, address := range addresses {
+		if common.IsHexAddress(address) {
+			accAddresses = append(accAddresses, common.HexToAddress(address).Bytes())
+			continue
+		}
+		_, bz, err := bech32.DecodeAndConvert(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address: %s", address)
+		}
+		accAddresses = append(accAddresses, bz)
+	}
+	return accAddresses, nil
+}
+
 func DefaultConfig() *Config {
 	return &Config{
 		LogLevel:    "info",
 		RPCAddress:  DefaultJSONRPCAddress,
 		GRPCAddress: DefaultGRPCAddress,
 		RestAddress: DefaultRESTAddress,
+		RestFormat:  RESTFormatGateway,
+		EVMRPC: EVMRPC{
+			Enable:               false,
+			Address:              DefaultEVMRPCAddress,
+			AllowedMethods:       []string{"eth_*", "net_*", "web3_*"},
+			DeniedMethods:        []string{"eth_sign", "eth_signTransaction", "eth_signTypedData", "eth_sendTransaction", "eth_subscribe", "eth_unsubscribe"},
+			MaxGetLogsBlockRange: DefaultEVMRPCMaxGetLogsBlockRange,
+			MaxCallGas:           DefaultEVMRPCMaxCallGas,
+		},
 		Chain: Chain{
-			ChainID:                     "fxcore",
-			MinimumGasLimit:             DefaultMinGasLimit,
-			MinimumFee:                  "",
-			MaxMemo:                     256,
-			WhiteRouters:                []string{""},
-			ExtensionOptions:            0,
-			NonCriticalExtensionOptions: 0,
-			Granter:                     0,
-			Payer:                       0,
-			SignerInfos:                 1,
-			MinimumSignatures:           1,
-			PublicKeyTypeURL:            []string{"/cosmos.crypto.secp256k1.PubKey", "/ethermint.crypto.v1.ethsecp256k1.PubKey"},
+			ChainID:                            "fxcore",
+			MinimumGasLimit:                    DefaultMinGasLimit,
+			MinimumFee:                         "",
+			MaxMemo:                            256,
+			WhiteRouters:                       []string{""},
+			AllowedExtensionOptions:            []string{"/ethermint.evm.v1.ExtensionOptionsEthereumTx", "/ethermint.types.v1.ExtensionOptionsWeb3Tx"},
+			AllowedNonCriticalExtensionOptions: []string{},
+			ExtensionOptions:                   0,
+			NonCriticalExtensionOptions:        0,
+			Granter:                            0,
+			Payer:                              0,
+			SignerInfos:                        1,
+			MinimumSignatures:                  1,
+			MaximumTxBytes:                     DefaultMaxTxBytes,
+			MaximumMessages:                    DefaultMaxMessages,
+			MaximumMessagesPerType:             0,
+			MaximumGasLimit:                    DefaultMaxGasLimit,
+			MaximumSignatures:                  DefaultMaxSignatures,
+			MaximumTimeoutHeight:               0,
+			PublicKeyTypeURL:                   []string{"/cosmos.crypto.secp256k1.PubKey", "/ethermint.crypto.v1.ethsecp256k1.PubKey"},
+			StrictDecoding:                     true,
+			EVM: EVM{
+				ChainID:             0,
+				AllowUnprotectedTxs: false,
+				MinimumGasLimit:     DefaultEVMMinGasLimit,
+				MaximumGasLimit:     0,
+				MinimumGasPrice:     "",
+				MinimumGasTipCap:    "",
+				ContractCreation:    true,
+				DeniedToAddresses:   []string{},
+			},
+		},
+		TrustedProxies: []string{},
+		AccessControl: AccessControl{
+			Enable:           false,
+			AllowList:        []string{},
+			DenyList:         []string{},
+			AllowedCountries: []string{},
+			DeniedCountries:  []string{},
+			ReloadSecond:     30,
+		},
+		RateLimit: RateLimit{
+			Enable:      false,
+			DefaultCost: 1,
+			Costs:       []RouteCost{},
+			Rules: map[string]RateLimitRule{
+				string(types.JSONRPCProtocol):                                 {RequestsPerSecond: 50, Burst: 100},
+				string(types.GRPCProtocol):                                    {RequestsPerSecond: 50, Burst: 100},
+				string(types.RESTProtocol):                                    {RequestsPerSecond: 50, Burst: 100},
+				string(types.EVMRPCProtocol):                                  {RequestsPerSecond: 50, Burst: 100},
+				RateLimitRuleKey(types.JSONRPCProtocol, types.BroadcastRoute): {RequestsPerSecond: 2, Burst: 5},
+				RateLimitRuleKey(types.GRPCProtocol, types.BroadcastRoute):    {RequestsPerSecond: 2, Burst: 5},
+				RateLimitRuleKey(types.RESTProtocol, types.BroadcastRoute):    {RequestsPerSecond: 2, Burst: 5},
+				RateLimitRuleKey(types.EVMRPCProtocol, types.BroadcastRoute):  {RequestsPerSecond: 2, Burst: 5},
+			},
+		},
+		SignerLimit: SignerLimit{
+			Enable:         false,
+			BroadcastLimit: 60,
+			WindowSecond:   60,
+			MessageQuotas: []MessageQuota{
+				{TypeURL: "/cosmos.gov.v1beta1.MsgSubmitProposal", Limit: 3, WindowSecond: 3600},
+				{TypeURL: "/cosmos.gov.v1.MsgSubmitProposal", Limit: 3, WindowSecond: 3600},
+			},
+			TrustedAddresses: []string{},
+		},
+		Auth: Auth{
+			Enable:       false,
+			KeyFile:      "config/keys.json",
+			ReloadSecond: 30,
+			Header:       "X-API-Key",
+			QueryParam:   "api_key",
+			DefaultTier:  "anonymous",
+			Tiers: map[string]Tier{
+				"anonymous": {Broadcast: true, Routes: map[string][]string{}, Rules: map[string]RateLimitRule{}},
+			},
+			Challenge: ChallengeAuth{
+				Enable:          false,
+				Tier:            "anonymous",
+				ChallengeSecond: 300,
+				TokenSecond:     3600,
+
+				MaxChallenges:           10000,
+				MaxChallengesPerAddress: 3,
+			},
+		},
+		Ban: Ban{
+			Enable:       false,
+			Threshold:    20,
+			WindowSecond: 60,
+			BanSecond:    300,
+			Multiplier:   2,
+			MaxBanSecond: 86400,
+			ForgetSecond: 86400,
+			Signers:      false,
+		},
+		PoW: PoW{
+			Enable:          false,
+			LoadThreshold:   20,
+			MinDifficulty:   16,
+			MaxDifficulty:   24,
+			ChallengeSecond: 30,
+			Header:          "X-PoW-Stamp",
+		},
+		SizeLimit: SizeLimit{
+			MaxRequestBytes: map[string]int64{
+				string(types.JSONRPCProtocol): DefaultMaxRequestBytes,
+				string(types.GRPCProtocol):    DefaultMaxRequestBytes,
+				string(types.RESTProtocol):    DefaultMaxRequestBytes,
+				string(types.EVMRPCProtocol):  DefaultMaxRequestBytes,
+			},
+			MaxResponseBytes: map[string]int64{},
+			Routes:           []RouteSizeLimit{},
+		},
+		QueryLimit: QueryLimit{
+			Enable:             false,
+			Clamp:              false,
+			MaxPaginationLimit: 200,
+			AllowCountTotal:    false,
+			MaxPerPage:         50,
+			MaxEventConditions: 5,
+		},
+		Concurrency: Concurrency{
+			Enable:      false,
+			MaxInFlight: 256,
+			ClassMaxInFlight: map[string]int{
+				string(types.QueryRoute):     192,
+				string(types.SimulateRoute):  64,
+				string(types.BroadcastRoute): 128,
+			},
+			QueueSize:           64,
+			QueueTimeoutMillis:  200,
+			ShedRatio:           0.75,
+			TargetLatencyMillis: 2000,
+			HealthReserved:      4,
+		},
+		Mempool: Mempool{
+			Enable:        false,
+			PollSecond:    5,
+			ThrottleTxs:   4000,
+			ThrottleBytes: 768 << 20,
+			ThrottleRate:  20,
+			RejectTxs:     4800,
+			RejectBytes:   960 << 20,
+		},
+		Admin: Admin{
+			Enable:  false,
+			Address: DefaultAdminAddress,
+			Format:  RESTFormatLegacy,
+		},
+		Metrics: Metrics{
+			Enable:  false,
+			Address: DefaultMetricsAddress,
+		},
+		Audit: Audit{
+			Enable: false,
+			File:   "audit.jsonl",
+			Rotation: logger.Rotation{
+				MaxSizeMB:    100,
+				RotateSecond: 86400,
+				MaxBackups:   30,
+				MaxAgeDays:   90,
+				Compress:     false,
+			},
+		},
+		AccessLog: AccessLog{
+			Enable: false,
+			File:   "access.jsonl",
+			Rotation: logger.Rotation{
+				MaxSizeMB:    100,
+				RotateSecond: 86400,
+				MaxBackups:   7,
+				MaxAgeDays:   30,
+				Compress:     false,
+			},
+		},
+		Log: Log{
+			Format: logger.FormatConsole,
+			Output: logger.OutputStdout,
+			File:   "firewall.log",
+			Rotation: logger.Rotation{
+				MaxSizeMB:    100,
+				RotateSecond: 0,
+				MaxBackups:   10,
+				MaxAgeDays:   30,
+				Compress:     false,
+			},
+		},
+		BodyLog: BodyLog{
+			Mode:         BodyLogOff,
+			SampleRatio:  0.01,
+			MaxBytes:     4096,
+			RedactFields: []string{"memo"},
+			Routes:       []RouteBodyLog{},
+		},
+		Tracing: Tracing{
+			Enable:      false,
+			Exporter:    TracingExporterOTLP,
+			Endpoint:    DefaultTracingEndpoint,
+			Insecure:    true,
+			File:        "",
+			ServiceName: "cosmos-firewall",
+			SampleRatio: 1,
 		},
 		Redirect: Redirect{
 			Enable:          false,
 			TimeoutSecond:   30,
 			CheckNodeSecond: 180,
 			Nodes: map[string]NodeConfig{
-				string(types.LightNode):   {JSONRPCNode: []string{}, GRPCNode: []string{}, RESTNode: []string{}},
-				string(types.ArchiveNode): {JSONRPCNode: []string{}, GRPCNode: []string{}, RESTNode: []string{}},
-				string(types.FullNode):    {JSONRPCNode: []string{}, GRPCNode: []string{}, RESTNode: []string{}},
+				string(types.LightNode):   {JSONRPCNode: []string{}, GRPCNode: []string{}, RESTNode: []string{}, EVMRPCNode: []string{}},
+				string(types.ArchiveNode): {JSONRPCNode: []string{}, GRPCNode: []string{}, RESTNode: []string{}, EVMRPCNode: []string{}},
+				string(types.FullNode):    {JSONRPCNode: []string{}, GRPCNode: []string{}, RESTNode: []string{}, EVMRPCNode: []string{}},
 			},
 		},
 	}
 }
 
 func (c *Config) ValidateBasic() error {
+	if _, err := logger.ParseLevels(c.LogLevel); err != nil {
+		return err
+	}
+	if err := c.Log.ValidateBasic(); err != nil {
+		return err
+	}
+	if _, err := ParseCIDRs(c.TrustedProxies); err != nil {
+		return err
+	}
+	for key, rule := range c.RateLimit.Rules {
+		if rule.RequestsPerSecond < 0 || rule.Burst < 0 {
+			return fmt.Errorf("invalid rate limit rule: %s", key)
+		}
+	}
+	if c.RateLimit.DefaultCost < 0 {
+		return fmt.Errorf("invalid rate limit default cost: %v", c.RateLimit.DefaultCost)
+	}
+	for _, routeCost := range c.RateLimit.Costs {
+		if !IsProtocol(routeCost.Protocol) {
+			return fmt.Errorf("invalid rate limit cost protocol: %s", routeCost.Protocol)
+		}
+		if routeCost.Route == "" || routeCost.Cost < 0 {
+			return fmt.Errorf("invalid rate limit cost: %s %s", routeCost.Protocol, routeCost.Route)
+		}
+	}
+	if err := c.AccessControl.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.SignerLimit.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.Auth.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.Ban.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.PoW.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.SizeLimit.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.QueryLimit.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.Concurrency.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.Mempool.ValidateBasic(); err != nil {
+		return err
+	}
+	if !IsRESTFormat(c.RestFormat) {
+		return fmt.Errorf("invalid rest format: %s", c.RestFormat)
+	}
+	if !IsRESTFormat(c.Admin.Format) {
+		return fmt.Errorf("invalid admin format: %s", c.Admin.Format)
+	}
+	if err := c.Tracing.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.Audit.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.AccessLog.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := c.BodyLog.ValidateBasic(); err != nil {
+		return err
+	}
+	for _, typeURLs := range [][]string{c.Chain.AllowedExtensionOptions, c.Chain.AllowedNonCriticalExtensionOptions} {
+		for _, typeURL := range typeURLs {
+			if !strings.HasPrefix(typeURL, "/") {
+				return fmt.Errorf("invalid extension option type url: %s", typeURL)
+			}
+		}
+	}
+	if err := c.Chain.EVM.ValidateBasic(); err != nil {
+		return err
+	}
+	if c.EVMRPC.Enable && c.Redirect.Enable {
+		evmNodes := 0
+		for _, nodes := range c.Redirect.Nodes {
+			evmNodes += len(nodes.EVMRPCNode)
+		}
+		if evmNodes == 0 {
+			return fmt.Errorf("evm json rpc nodes is required")
+		}
+	}
 	if c.Redirect.Enable {
 		if c.Redirect.Nodes == nil {
 			return fmt.Errorf("redirect nodes is required")
@@ -137,3 +1156,23 @@ func (c *Config) ValidateBasic() error {
 	}
 	return nil
 }
+
+func (e *EVM) ValidateBasic() error {
+	for _, s := range []string{e.MinimumGasPrice, e.MinimumGasTipCap} {
+		if s == "" {
+			continue
+		}
+		if wei, ok := new(big.Int).SetString(s, 10); !ok || wei.Sign() < 0 {
+			return fmt.Errorf("invalid evm wei amount: %s", s)
+		}
+	}
+	if e.MaximumGasLimit > 0 && e.MaximumGasLimit < e.MinimumGasLimit {
+		return fmt.Errorf("evm maximum gas limit %d is less than minimum gas limit %d", e.MaximumGasLimit, e.MinimumGasLimit)
+	}
+	for _, address := range e.DeniedToAddresses {
+		if !common.IsHexAddress(address) {
+			return fmt.Errorf("invalid evm denied to address: %s", address)
+		}
+	}
+	return nil
+}
@@ -5,19 +5,37 @@ import (
 	"strings"
 
 	"github.com/cosmos/cosmos-sdk/baseapp"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
 	"github.com/cosmos/cosmos-sdk/server/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
 )
 
 type appCreator func() (Application, error)
 
-var applications = map[string]appCreator{}
+var (
+	applications   = map[string]appCreator{}
+	bech32Prefixes = map[string]func(config *sdk.Config){}
+)
 
-func registerAppCreator(chainId string, creator appCreator) {
+func registerAppCreator(chainId string, creator appCreator, setBech32Prefixes func(config *sdk.Config)) {
 	_, ok := applications[chainId]
 	if ok {
 		return
 	}
 	applications[chainId] = creator
+	bech32Prefixes[chainId] = setBech32Prefixes
+}
+
+// SetBech32Prefixes sets the global bech32 prefixes of the sdk to the ones of the chain,
+// which msg.GetSigners decodes the addresses of the messages with. It is called once at
+// startup, before any tx is validated.
+func SetBech32Prefixes(chainId string) error {
+	setBech32Prefixes, ok := bech32Prefixes[chainId]
+	if !ok {
+		return fmt.Errorf("unknown  chainId %s", chainId)
+	}
+	setBech32Prefixes(sdk.GetConfig())
+	return nil
 }
 
 // NewApplication creates a new application with the given chainId.
@@ -43,4 +61,5 @@ type Application interface {
 	types.ApplicationQueryService
 	GRPCQueryRouter() *baseapp.GRPCQueryRouter
 	MsgServiceRouter() *baseapp.MsgServiceRouter
+	InterfaceRegistry() codectypes.InterfaceRegistry
 }
@@ -5,6 +5,7 @@ import (
 
 	"github.com/cosmos/cosmos-sdk/simapp"
 	"github.com/evmos/ethermint/app"
+	ethermintconfig "github.com/evmos/ethermint/cmd/config"
 	"github.com/evmos/ethermint/encoding"
 )
 
@@ -15,5 +16,5 @@ func init() {
 		return app.NewEthermintApp(nil, nil, nil, true, map[int64]bool{}, os.TempDir(), 5,
 			encoding.MakeConfig(app.ModuleBasics), simapp.EmptyAppOptions{}), nil
 	}
-	registerAppCreator(ETHERMINT, applicationCreator)
+	registerAppCreator(ETHERMINT, applicationCreator, ethermintconfig.SetBech32Prefixes)
 }
@@ -3,7 +3,9 @@ package application
 import (
 	"os"
 
+	sdk "github.com/cosmos/cosmos-sdk/types"
 	"github.com/functionx/fx-core/v4/app"
+	fxtypes "github.com/functionx/fx-core/v4/types"
 )
 
 const FXCORE = "fxcore"
@@ -13,5 +15,10 @@ func init() {
 		return app.New(nil, nil, nil, false, map[int64]bool{}, os.TempDir(), 5,
 			app.MakeEncodingConfig(), app.EmptyAppOptions{}), nil
 	}
-	registerAppCreator(FXCORE, applicationCreator)
+	setBech32Prefixes := func(config *sdk.Config) {
+		config.SetBech32PrefixForAccount(fxtypes.AddressPrefix, fxtypes.AddressPrefix+sdk.PrefixPublic)
+		config.SetBech32PrefixForValidator(fxtypes.AddressPrefix+sdk.PrefixValidator+sdk.PrefixOperator, fxtypes.AddressPrefix+sdk.PrefixValidator+sdk.PrefixOperator+sdk.PrefixPublic)
+		config.SetBech32PrefixForConsensusNode(fxtypes.AddressPrefix+sdk.PrefixValidator+sdk.PrefixConsensus, fxtypes.AddressPrefix+sdk.PrefixValidator+sdk.PrefixConsensus+sdk.PrefixPublic)
+	}
+	registerAppCreator(FXCORE, applicationCreator, setBech32Prefixes)
 }
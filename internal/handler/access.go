@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// AccessHandler rejects clients denied by the IP filter or banned before the request body is read.
+func AccessHandler(validator middleware.Validator, protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	if validator.IPFilter == nil && validator.Banner == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := middleware.HTTPClientIP(r, validator.TrustedProxies)
+		if validator.IPFilter != nil {
+			if err := validator.IPFilter.Check(r.Context(), client); err != nil {
+				log.Ctx(r.Context()).Warnf("%s access denied, client: %s, err: %s", protocol, client, err.Error())
+				validator.CountRejection(middleware.RejectIPDenied)
+				rejectResponse(w, validator.Cfg.RestFormat, protocol, err)
+				return
+			}
+		}
+		if until, banned := validator.CheckClientBan(client); banned {
+			log.Ctx(r.Context()).Warnf("%s access denied, client: %s, banned until %s", protocol, client, until.Format(time.RFC3339))
+			validator.CountRejection(middleware.RejectBanned)
+			w.Header().Set("Retry-After", retryAfterSeconds(time.Until(until)))
+			rejectResponse(w, validator.Cfg.RestFormat, protocol, middleware.ErrBanned)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// AccessStreamInterceptor rejects gRPC clients denied by the IP filter or banned before a message is received.
+func AccessStreamInterceptor(validator middleware.Validator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		if validator.IPFilter == nil && validator.Banner == nil {
+			return next(srv, ss)
+		}
+		client := middleware.GRPCClientIP(ss.Context(), validator.TrustedProxies)
+		if validator.IPFilter != nil {
+			if err := validator.IPFilter.Check(ss.Context(), client); err != nil {
+				log.Ctx(ss.Context()).Warnf("%s access denied, client: %s, err: %s", types.GRPCProtocol, client, err.Error())
+				validator.CountRejection(middleware.RejectIPDenied)
+				return grpcRejection(err)
+			}
+		}
+		if until, banned := validator.CheckClientBan(client); banned {
+			log.Ctx(ss.Context()).Warnf("%s access denied, client: %s, banned until %s", types.GRPCProtocol, client, until.Format(time.RFC3339))
+			validator.CountRejection(middleware.RejectBanned)
+			_ = ss.SetHeader(metadata.Pairs("retry-after", retryAfterSeconds(time.Until(until))))
+			return grpcRejection(middleware.ErrBanned)
+		}
+		return next(srv, ss)
+	}
+}
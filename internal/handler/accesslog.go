@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+	"github.com/overload-ak/cosmos-firewall/logger"
+)
+
+// AccessLogHandler assigns the request its id, the X-Request-ID sent by the client or a new
+// one, returns it to the client and adds it to the lines logged about the request. A line
+// is appended to the access log once the request is served.
+func AccessLogHandler(validator middleware.Validator, protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.RequestID(r.Header.Get(middleware.RequestIDHeader))
+		r.Header.Set(middleware.RequestIDHeader, id)
+		w.Header().Set(middleware.RequestIDHeader, id)
+		ctx := logger.WithFields(middleware.WithRequestID(r.Context(), id), "request_id", id)
+		if validator.AccessLogger == nil {
+			next(w, r.WithContext(ctx))
+			return
+		}
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		// recorded on panics too, a response over the size limit is aborted
+		defer func() {
+			record := middleware.AccessRecord{
+				Time:      start.UTC(),
+				RequestID: id,
+				ClientIP:  middleware.HTTPClientIP(r, validator.TrustedProxies),
+				Protocol:  string(protocol),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    sw.status,
+				Bytes:     sw.bytes,
+				LatencyMs: latencyMs(start),
+			}
+			if request, ok := metrics.RequestFromContext(ctx); ok {
+				record.Route, record.Upstream = request.Route, request.Upstream
+			}
+			validator.AccessLogger.Record(record)
+		}()
+		next(sw, r.WithContext(ctx))
+	}
+}
+
+// AccessLogStreamInterceptor assigns the gRPC call its id, the x-request-id metadata sent by
+// the client or a new one, as AccessLogHandler.
+func AccessLogStreamInterceptor(validator middleware.Validator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		var sent string
+		if md, ok := metadata.FromIncomingContext(ss.Context()); ok {
+			if ids := md.Get(middleware.RequestIDMetadata); len(ids) > 0 {
+				sent = ids[0]
+			}
+		}
+		id := middleware.RequestID(sent)
+		_ = ss.SetHeader(metadata.Pairs(middleware.RequestIDMetadata, id))
+		ctx := logger.WithFields(middleware.WithRequestID(ss.Context(), id), "request_id", id)
+		if validator.AccessLogger == nil {
+			return next(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+		}
+		start := time.Now()
+		stream := &countingServerStream{contextServerStream: contextServerStream{ServerStream: ss, ctx: ctx}}
+		err := next(srv, stream)
+		record := middleware.AccessRecord{
+			Time:      start.UTC(),
+			RequestID: id,
+			ClientIP:  middleware.GRPCClientIP(ctx, validator.TrustedProxies),
+			Protocol:  string(types.GRPCProtocol),
+			Method:    info.FullMethod,
+			Status:    int(status.Code(err)),
+			Bytes:     atomic.LoadInt64(&stream.bytes),
+			LatencyMs: latencyMs(start),
+		}
+		if request, ok := metrics.RequestFromContext(ctx); ok {
+			record.Route, record.Upstream = request.Route, request.Upstream
+		}
+		validator.AccessLogger.Record(record)
+		return err
+	}
+}
+
+// countingServerStream counts the bytes of the messages sent to the client, forwarded from
+// the upstream node by a goroutine of their own.
+type countingServerStream struct {
+	contextServerStream
+	bytes int64
+}
+
+func (s *countingServerStream) SendMsg(m interface{}) error {
+	if frame, ok := m.(*types.Frame); ok {
+		atomic.AddInt64(&s.bytes, int64(len(frame.Payload)))
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func latencyMs(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
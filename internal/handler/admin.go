@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/logger"
+)
+
+const (
+	AdminBansPath      = "/bans"
+	AdminUpstreamsPath = "/upstreams"
+	AdminLogLevelPath  = "/log-level"
+)
+
+// AdminHandler serves the operator endpoints of the admin listener: GET /bans lists the
+// bans in effect, DELETE /bans?key=<key> lifts a ban and GET /upstreams lists the load of
+// the upstream nodes. GET /log-level returns the log levels and PUT /log-level?level=<levels>
+// changes them, as in node=debug,handler=info.
+func AdminHandler(validator middleware.Validator) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(AdminBansPath, func(w http.ResponseWriter, r *http.Request) {
+		if validator.Banner == nil {
+			restResponse(w, validator.Cfg.Admin.Format, http.StatusNotFound, "bans are disabled", nil)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			restResponse(w, validator.Cfg.Admin.Format, http.StatusOK, "", validator.Banner.Bans())
+		case http.MethodDelete:
+			key := r.URL.Query().Get("key")
+			if !validator.Banner.Unban(key) {
+				restResponse(w, validator.Cfg.Admin.Format, http.StatusNotFound, "not banned: "+key, nil)
+				return
+			}
+			restResponse(w, validator.Cfg.Admin.Format, http.StatusOK, "", nil)
+		default:
+			restResponse(w, validator.Cfg.Admin.Format, http.StatusMethodNotAllowed, "method not allowed", nil)
+		}
+	})
+	mux.HandleFunc(AdminUpstreamsPath, func(w http.ResponseWriter, r *http.Request) {
+		if validator.Concurrency == nil {
+			restResponse(w, validator.Cfg.Admin.Format, http.StatusNotFound, "concurrency limits are disabled", nil)
+			return
+		}
+		if r.Method != http.MethodGet {
+			restResponse(w, validator.Cfg.Admin.Format, http.StatusMethodNotAllowed, "method not allowed", nil)
+			return
+		}
+		restResponse(w, validator.Cfg.Admin.Format, http.StatusOK, "", validator.Concurrency.Loads())
+	})
+	mux.HandleFunc(AdminLogLevelPath, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			level := r.URL.Query().Get("level")
+			if level == "" {
+				restResponse(w, validator.Cfg.Admin.Format, http.StatusBadRequest, "log level is empty", nil)
+				return
+			}
+			if err := logger.SetLevels(level); err != nil {
+				restResponse(w, validator.Cfg.Admin.Format, http.StatusBadRequest, err.Error(), nil)
+				return
+			}
+			log.Infof("log levels changed: %s", logger.GetLevels().String())
+		default:
+			restResponse(w, validator.Cfg.Admin.Format, http.StatusMethodNotAllowed, "method not allowed", nil)
+			return
+		}
+		restResponse(w, validator.Cfg.Admin.Format, http.StatusOK, "", map[string]string{"level": logger.GetLevels().String()})
+	})
+	return mux
+}
@@ -0,0 +1,32 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/handler"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/logger"
+)
+
+func TestAdminLogLevel(t *testing.T) {
+	defer logger.Init("info")
+	h := handler.AdminHandler(middleware.NewValidator(config.DefaultConfig()))
+	serve := func(method, target string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, handler.AdminLogLevelPath+"?level=middleware=debug"))
+	assert.Equal(t, "info,middleware=debug", logger.GetLevels().String())
+	// an empty level does not reset the levels
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, handler.AdminLogLevelPath))
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, handler.AdminLogLevelPath+"?level=nodes=debug"))
+	assert.Equal(t, "info,middleware=debug", logger.GetLevels().String())
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, handler.AdminLogLevelPath))
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// AuthHandler resolves the API key of the request to an identity, checks its tier permits
+// every route called by the request and passes the identity on in the request context.
+// The key is removed from the request before it is forwarded.
+func AuthHandler(validator middleware.Validator, protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	authenticator := validator.Authenticator
+	if authenticator == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := middleware.HTTPClientIP(r, validator.TrustedProxies)
+		identity, err := authenticator.Authenticate(authenticator.HTTPAPIKey(r), client)
+		if err != nil {
+			log.Ctx(r.Context()).Warnf("%s authentication failed, client: %s", protocol, client)
+			validator.RecordRejection(r.Context(), client, middleware.RejectInvalidAPIKey)
+			rejectResponse(w, validator.Cfg.RestFormat, protocol, err)
+			return
+		}
+		routes, err := httpRoutes(protocol, r)
+		if err != nil {
+			// malformed bodies are reported by the protocol handler
+			routes = nil
+		}
+		for _, route := range routes {
+			if err = authenticator.CheckRoute(identity, protocol, route.class, route.name); err != nil {
+				log.Ctx(r.Context()).Warnf("%s route %s is not permitted, client: %s, tier: %s", protocol, route.name, identity.Client, identity.Tier)
+				validator.RecordRejection(r.Context(), client, middleware.RejectRouteDenied)
+				rejectResponse(w, validator.Cfg.RestFormat, protocol, err)
+				return
+			}
+		}
+		authenticator.StripHTTPAPIKey(r)
+		next(w, r.WithContext(middleware.WithIdentity(r.Context(), identity)))
+	}
+}
+
+// AuthStreamInterceptor resolves the API key of a gRPC call to an identity and checks its
+// tier permits the method.
+func AuthStreamInterceptor(validator middleware.Validator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		authenticator := validator.Authenticator
+		if authenticator == nil {
+			return next(srv, ss)
+		}
+		client := middleware.GRPCClientIP(ss.Context(), validator.TrustedProxies)
+		identity, err := authenticator.Authenticate(authenticator.GRPCAPIKey(ss.Context()), client)
+		if err != nil {
+			log.Ctx(ss.Context()).Warnf("%s authentication failed, client: %s", types.GRPCProtocol, client)
+			validator.RecordRejection(ss.Context(), client, middleware.RejectInvalidAPIKey)
+			return grpcRejection(err)
+		}
+		if err = authenticator.CheckRoute(identity, types.GRPCProtocol, middleware.GRPCRouteClass(info.FullMethod), info.FullMethod); err != nil {
+			log.Ctx(ss.Context()).Warnf("%s route %s is not permitted, client: %s, tier: %s", types.GRPCProtocol, info.FullMethod, identity.Client, identity.Tier)
+			validator.RecordRejection(ss.Context(), client, middleware.RejectRouteDenied)
+			return grpcRejection(err)
+		}
+		return next(srv, &contextServerStream{ServerStream: ss, ctx: middleware.WithIdentity(ss.Context(), identity)})
+	}
+}
+
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+type httpRoute struct {
+	name  string
+	class types.RouteClass
+}
+
+// httpRoutes returns the routes called by a request, named as in the tier route sets.
+func httpRoutes(protocol types.Protocol, r *http.Request) ([]httpRoute, error) {
+	if protocol == types.RESTProtocol {
+		return []httpRoute{{name: r.URL.Path, class: middleware.RESTRouteClass(r.Method, r.URL.Path)}}, nil
+	}
+	methods, err := jsonRPCMethods(r)
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]httpRoute, 0, len(methods))
+	for _, method := range methods {
+		if protocol == types.EVMRPCProtocol {
+			routes = append(routes, httpRoute{name: method, class: middleware.EVMRPCRouteClass(method)})
+		} else {
+			routes = append(routes, httpRoute{name: "/" + method, class: middleware.JSONRPCRouteClass(method)})
+		}
+	}
+	return routes, nil
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// BodyLogHandler logs the bodies kept by logBody in the on-reject mode once the request is
+// served, when the firewall rejected it.
+func BodyLogHandler(validator middleware.Validator, next http.HandlerFunc) http.HandlerFunc {
+	if validator.BodyLogger == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		kept := &keptBody{}
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		ctx := context.WithValue(r.Context(), keptBodyKey{}, kept)
+		// logged on panics too, a response over the size limit is aborted
+		defer func() {
+			kept.flush(ctx, validator, sw.status >= http.StatusBadRequest)
+		}()
+		next(sw, r.WithContext(ctx))
+	}
+}
+
+// BodyLogStreamInterceptor logs the bodies of the gRPC calls as BodyLogHandler.
+func BodyLogStreamInterceptor(validator middleware.Validator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		if validator.BodyLogger == nil {
+			return next(srv, ss)
+		}
+		kept := &keptBody{}
+		ctx := context.WithValue(ss.Context(), keptBodyKey{}, kept)
+		err := next(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+		kept.flush(ctx, validator, err != nil)
+		return err
+	}
+}
+
+// logBody logs the body of a request calling routes at debug level, as the body log mode of
+// the routes decides. A body logged on rejection is kept until the request is served.
+func logBody(ctx context.Context, validator middleware.Validator, protocol types.Protocol, routes []string, body []byte) {
+	bodyLogger := validator.BodyLogger
+	if bodyLogger == nil || len(body) == 0 || !log.Enabled(zapcore.DebugLevel) {
+		return
+	}
+	switch bodyLogger.Mode(protocol, routes) {
+	case config.BodyLogFull:
+	case config.BodyLogSampled:
+		if !bodyLogger.Sample() {
+			return
+		}
+	case config.BodyLogOnReject:
+		if kept, ok := ctx.Value(keptBodyKey{}).(*keptBody); ok {
+			kept.protocol, kept.routes, kept.body = protocol, routes, body
+		}
+		return
+	default:
+		return
+	}
+	log.Ctx(ctx).Debugf("%s request body: %s", protocol, bodyLogger.Render(protocol, routes, body))
+}
+
+// httpBodyRoutes returns the routes of a request body for the body log, named as in the
+// size limits.
+func httpBodyRoutes(protocol types.Protocol, r *http.Request, body []byte) []string {
+	if protocol == types.RESTProtocol || r.Method == http.MethodGet {
+		return []string{r.URL.Path}
+	}
+	methods, _ := jsonRPCBodyMethods(body)
+	if protocol == types.JSONRPCProtocol {
+		for i, method := range methods {
+			methods[i] = "/" + method
+		}
+	}
+	return methods
+}
+
+type keptBodyKey struct{}
+
+// keptBody is the body of a request logged if the firewall rejects the request.
+type keptBody struct {
+	protocol types.Protocol
+	routes   []string
+	body     []byte
+}
+
+// flush logs the body kept, if any, when the request failed without being forwarded.
+func (k *keptBody) flush(ctx context.Context, validator middleware.Validator, failed bool) {
+	if k.body == nil || !failed {
+		return
+	}
+	if request, ok := metrics.RequestFromContext(ctx); ok && request.Forwarded {
+		return
+	}
+	log.Ctx(ctx).Debugf("%s rejected request body: %s", k.protocol, validator.BodyLogger.Render(k.protocol, k.routes, k.body))
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+	"github.com/overload-ak/cosmos-firewall/logger"
+)
+
+// log is the logger of the handler subsystem.
+var log = logger.Named("handler")
+
+// Chain wraps the handler of a protocol with the middlewares shared by the HTTP listeners,
+// the first middleware sees the request first.
+func Chain(validator middleware.Validator, protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	handler := AuthHandler(validator, protocol,
+		RateLimitHandler(validator, protocol, next))
+	if protocol == types.RESTProtocol {
+		handler = PoWHandler(validator, ChallengeHandler(validator, handler))
+	}
+	return TracingHandler(protocol,
+		MetricsHandler(validator, protocol,
+			AccessLogHandler(validator, protocol,
+				BodyLogHandler(validator,
+					AccessHandler(validator, protocol,
+						SizeLimitHandler(validator, protocol,
+							metricsRouteHandler(validator, protocol, handler)))))))
+}
+
+// StreamInterceptors returns the interceptors of the gRPC listener, in the order of Chain.
+func StreamInterceptors(validator middleware.Validator) []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		TracingStreamInterceptor(),
+		MetricsStreamInterceptor(validator),
+		AccessLogStreamInterceptor(validator),
+		BodyLogStreamInterceptor(validator),
+		AccessStreamInterceptor(validator),
+		AuthStreamInterceptor(validator),
+		RateLimitStreamInterceptor(validator),
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+const (
+	AuthChallengePath = "/firewall/auth/challenge"
+	AuthTokenPath     = "/firewall/auth/token"
+)
+
+type challengeResponse struct {
+	Address   string    `json:"address"`
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type tokenRequest struct {
+	Address   string          `json:"address"`
+	Challenge string          `json:"challenge"`
+	PubKey    json.RawMessage `json:"pub_key"`
+	Signature []byte          `json:"signature"`
+}
+
+type tokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ChallengeHandler serves the address authentication endpoints on the REST listener and
+// hands every other request to next. The endpoints are rate limited by client IP.
+func ChallengeHandler(validator middleware.Validator, next http.HandlerFunc) http.HandlerFunc {
+	if validator.Authenticator == nil || validator.Authenticator.Challenger() == nil {
+		return next
+	}
+	challenger := validator.Authenticator.Challenger()
+	endpoints := RateLimitHandler(validator, types.RESTProtocol, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == AuthChallengePath && r.Method == http.MethodGet:
+			address := r.URL.Query().Get("address")
+			challenge, expiresAt, err := challenger.NewChallenge(address)
+			if err != nil {
+				restRejectResponse(w, validator.Cfg.RestFormat, middleware.AsRejection(middleware.CodeInvalidRequest, err))
+				return
+			}
+			restResponse(w, validator.Cfg.RestFormat, http.StatusOK, "", challengeResponse{Address: address, Challenge: challenge, ExpiresAt: expiresAt})
+		case r.URL.Path == AuthTokenPath && r.Method == http.MethodPost:
+			var req tokenRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				restResponse(w, validator.Cfg.RestFormat, http.StatusBadRequest, "json unmarshal token request: "+err.Error(), nil)
+				return
+			}
+			token, expiresAt, err := challenger.IssueToken(req.Address, req.Challenge, req.PubKey, req.Signature)
+			if err != nil {
+				log.Ctx(r.Context()).Warnf("auth challenge failed, address: %s, err: %s", req.Address, err.Error())
+				restResponse(w, validator.Cfg.RestFormat, http.StatusUnauthorized, err.Error(), nil)
+				return
+			}
+			restResponse(w, validator.Cfg.RestFormat, http.StatusOK, "", tokenResponse{Token: token, ExpiresAt: expiresAt})
+		default:
+			restResponse(w, validator.Cfg.RestFormat, http.StatusMethodNotAllowed, "method not allowed", nil)
+		}
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == AuthChallengePath || r.URL.Path == AuthTokenPath {
+			endpoints(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
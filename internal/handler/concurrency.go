@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// acquireUpstream takes an in-flight slot of the upstream of client for the routes of an HTTP
+// request, a batch is shed like its call cheapest to retry and is a health check only when
+// all its calls are.
+func acquireUpstream(ctx context.Context, validator middleware.Validator, client *middleware.RedirectClient, protocol types.Protocol, routes []httpRoute) (func(), error) {
+	classes := make([]types.RouteClass, 0, len(routes))
+	health := len(routes) > 0
+	for _, route := range routes {
+		classes = append(classes, route.class)
+		health = health && middleware.IsHealthRoute(protocol, route.name)
+	}
+	release, err := validator.AcquireUpstream(ctx, client.URI(), middleware.LowestRouteClass(classes), health)
+	if err != nil {
+		log.Ctx(ctx).Warnf("%s upstream overloaded: %s, error: %s", protocol, client.URI(), err.Error())
+	}
+	return release, err
+}
+
+// overloadedResponse answers 503 Service Unavailable to a request held back to protect the upstream nodes.
+func overloadedResponse(w http.ResponseWriter, validator middleware.Validator, protocol types.Protocol, retryAfter time.Duration, err error) {
+	validator.CountRejection(middleware.CodeOf(err).Reason())
+	w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+	rejectResponse(w, validator.Cfg.RestFormat, protocol, err)
+}
@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/tracing"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+const (
+	evmRPCParseError     = -32700
+	evmRPCInvalidRequest = -32600
+	evmRPCInternalError  = -32603
+)
+
+type evmRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type evmRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type evmRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *evmRPCError    `json:"error,omitempty"`
+}
+
+// EVMJSONRPCHandler fronts the ethereum JSON-RPC server of ethermint based chains.
+// latestHeight resolves "latest" block tags for eth_getLogs and may be nil.
+func EVMJSONRPCHandler(ctx context.Context, validator middleware.Validator, director middleware.Director, latestHeight func() int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, parse := tracing.Start(r.Context(), tracing.StageParse)
+		defer parse.End()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			evmRPCRejectResponse(w, nil, bodyRejection(err))
+			return
+		}
+		log.Ctx(r.Context()).Infof("EVM JSONRPC Method: [%s], RequestURI: [%s]", r.Method, r.URL.RequestURI())
+		logBody(r.Context(), validator, types.EVMRPCProtocol, httpBodyRoutes(types.EVMRPCProtocol, r, body), body)
+		if r.Method != http.MethodPost {
+			evmRPCErrorResponse(w, http.StatusMethodNotAllowed, nil, evmRPCInvalidRequest, "method not allowed")
+			return
+		}
+		var requests []evmRPCRequest
+		if err = json.Unmarshal(body, &requests); err != nil {
+			var request evmRPCRequest
+			if err = json.Unmarshal(body, &request); err != nil {
+				evmRPCErrorResponse(w, http.StatusBadRequest, nil, evmRPCParseError, err.Error())
+				return
+			}
+			requests = []evmRPCRequest{request}
+		}
+		if len(requests) == 0 {
+			evmRPCErrorResponse(w, http.StatusBadRequest, nil, evmRPCInvalidRequest, "empty batch")
+			return
+		}
+		parse.End()
+		validateCtx, validate := tracing.Start(r.Context(), tracing.StageValidate)
+		defer validate.End()
+		var height int64
+		if latestHeight != nil {
+			height = latestHeight()
+		}
+		for _, request := range requests {
+			if !validator.IsEVMRPCMethodAllowed(request.Method) {
+				validator.RecordRejection(r.Context(), middleware.HTTPClientIP(r, validator.TrustedProxies), middleware.RejectRouteDenied)
+				evmRPCRejectResponse(w, request.ID, middleware.Rejectf(middleware.CodeRouteDenied, "the method %s does not exist/is not available", request.Method))
+				return
+			}
+			if err := checkEVMRPCRequest(validateCtx, validator, middleware.HTTPClientIP(r, validator.TrustedProxies), request, height); err != nil {
+				if errors.Is(err, middleware.ErrMempoolFull) {
+					overloadedResponse(w, validator, types.EVMRPCProtocol, validator.Mempool.RetryAfter(), err)
+					return
+				}
+				validator.RecordRejectionOf(validateCtx, middleware.HTTPClientIP(r, validator.TrustedProxies), err)
+				evmRPCRejectResponse(w, request.ID, err)
+				return
+			}
+		}
+		validate.End()
+		if director != nil {
+			client, err := direct(r.Context(), ctx, director, 0)
+			if err != nil {
+				evmRPCErrorResponse(w, http.StatusMisdirectedRequest, nil, evmRPCInternalError, err.Error())
+				return
+			}
+			routes := make([]httpRoute, 0, len(requests))
+			for _, request := range requests {
+				routes = append(routes, httpRoute{name: request.Method, class: middleware.EVMRPCRouteClass(request.Method)})
+			}
+			release, err := acquireUpstream(r.Context(), validator, client, types.EVMRPCProtocol, routes)
+			if err != nil {
+				overloadedResponse(w, validator, types.EVMRPCProtocol, time.Second, err)
+				return
+			}
+			defer release()
+			if err = client.HttpRedirect(w, r, bytes.NewReader(body)); err != nil {
+				evmRPCErrorResponse(w, http.StatusMisdirectedRequest, nil, evmRPCInternalError, err.Error())
+				return
+			}
+			return
+		}
+		writeEVMRPCResponse(w, http.StatusOK, evmRPCResponse{JSONRPC: "2.0", ID: requests[0].ID, Result: "SUCCESS"})
+	}
+}
+
+func checkEVMRPCRequest(ctx context.Context, validator middleware.Validator, client string, request evmRPCRequest, latestHeight int64) error {
+	switch request.Method {
+	case "eth_sendRawTransaction":
+		var params []hexutil.Bytes
+		if err := json.Unmarshal(request.Params, &params); err != nil || len(params) == 0 {
+			return errors.New("invalid raw transaction params")
+		}
+		err := checkTx(ctx, func() error { return validator.CheckBroadcastEthereumRawTx(ctx, params[0]) })
+		validator.AuditEthereumRawTx(ctx, types.EVMRPCProtocol, request.Method, client, params[0], err)
+		if err != nil {
+			return err
+		}
+	case "eth_getLogs":
+		var params []struct {
+			BlockHash *string `json:"blockHash"`
+			FromBlock string  `json:"fromBlock"`
+			ToBlock   string  `json:"toBlock"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil || len(params) == 0 {
+			return errors.New("invalid filter params")
+		}
+		if params[0].BlockHash != nil || params[0].FromBlock == params[0].ToBlock {
+			return nil
+		}
+		fromBlock, fromOk, err := resolveBlockNumber(params[0].FromBlock, latestHeight)
+		if err != nil {
+			return err
+		}
+		toBlock, toOk, err := resolveBlockNumber(params[0].ToBlock, latestHeight)
+		if err != nil {
+			return err
+		}
+		if !fromOk || !toOk {
+			// the range of a head tag cannot be bounded until the latest height is known
+			if validator.Cfg.EVMRPC.MaxGetLogsBlockRange > 0 {
+				return middleware.NewRejection(middleware.CodeQueryLimitExceeded, "block range cannot be bounded, the latest height is unknown")
+			}
+			return nil
+		}
+		if err = validator.CheckEVMLogsBlockRange(fromBlock, toBlock); err != nil {
+			return err
+		}
+	case "eth_call", "eth_estimateGas":
+		var params []json.RawMessage
+		if err := json.Unmarshal(request.Params, &params); err != nil || len(params) == 0 {
+			return errors.New("invalid call params")
+		}
+		var args struct {
+			Gas *hexutil.Uint64 `json:"gas"`
+		}
+		if err := json.Unmarshal(params[0], &args); err != nil {
+			return errors.Wrapf(err, "invalid call args")
+		}
+		if args.Gas != nil {
+			if err := validator.CheckEVMCallGas(uint64(*args.Gas)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveBlockNumber converts a block number or tag to a height, reporting false when the
+// tag refers to the chain head and no height is known yet.
+func resolveBlockNumber(block string, latestHeight int64) (int64, bool, error) {
+	switch block {
+	case "", "latest", "pending", "safe", "finalized":
+		return latestHeight, latestHeight > 0, nil
+	case "earliest":
+		return 0, true, nil
+	}
+	number, err := hexutil.DecodeUint64(block)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid block number %s", block)
+	}
+	return int64(number), true, nil
+}
+
+func evmRPCErrorResponse(writer http.ResponseWriter, code int, id json.RawMessage, rpcCode int, msg string) {
+	writeEVMRPCResponse(writer, code, evmRPCResponse{JSONRPC: "2.0", ID: id, Error: &evmRPCError{Code: rpcCode, Message: msg}})
+}
+
+func writeEVMRPCResponse(writer http.ResponseWriter, code int, res evmRPCResponse) {
+	if res.ID == nil {
+		res.ID = json.RawMessage("null")
+	}
+	d, err := json.Marshal(res)
+	if err != nil {
+		log.Errorf("output json marshal error: %s", err.Error())
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	if _, err = writer.Write(d); err != nil {
+		log.Errorf("output write error: %s", err.Error())
+	}
+}
@@ -0,0 +1,59 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/handler"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func serveEVMRPC(t *testing.T, h http.HandlerFunc, body string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	res := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	return w.Code, res
+}
+
+func TestEVMRPCGetLogsBlockRange(t *testing.T) {
+	validator := middleware.Validator{Cfg: config.DefaultConfig()}
+	getLogs := func(filter string) string {
+		return `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[` + filter + `]}`
+	}
+
+	var latestHeight int64
+	h := handler.EVMJSONRPCHandler(context.Background(), validator, nil, func() int64 { return latestHeight })
+
+	// the latest height is unknown, a range ending at the head cannot be bounded
+	for _, filter := range []string{`{"fromBlock":"0x0"}`, `{"fromBlock":"0x0","toBlock":"latest"}`, `{"fromBlock":"latest","toBlock":"0x0"}`} {
+		code, res := serveEVMRPC(t, h, getLogs(filter))
+		assert.Equal(t, http.StatusBadRequest, code, filter)
+		require.Contains(t, res, "error", filter)
+		assert.Equal(t, string(middleware.CodeQueryLimitExceeded), res["error"].(map[string]interface{})["data"], filter)
+	}
+	code, _ := serveEVMRPC(t, h, getLogs(`{"fromBlock":"0x10","toBlock":"0x20"}`))
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = serveEVMRPC(t, h, getLogs(`{"blockHash":"0x01"}`))
+	assert.Equal(t, http.StatusOK, code)
+
+	latestHeight = 20000
+	code, _ = serveEVMRPC(t, h, getLogs(`{"fromBlock":"0x0"}`))
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = serveEVMRPC(t, h, getLogs(`{"fromBlock":"0x2710"}`))
+	assert.Equal(t, http.StatusOK, code)
+
+	// without a range limit the range is not bounded
+	validator.Cfg.EVMRPC.MaxGetLogsBlockRange = 0
+	latestHeight = 0
+	code, _ = serveEVMRPC(t, h, getLogs(`{"fromBlock":"0x0"}`))
+	assert.Equal(t, http.StatusOK, code)
+}
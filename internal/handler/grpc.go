@@ -2,19 +2,17 @@ package handler
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 
 	"github.com/cosmos/cosmos-sdk/types/tx"
 	"github.com/gogo/protobuf/proto"
-	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
 	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/tracing"
 	"github.com/overload-ak/cosmos-firewall/internal/types"
-	"github.com/overload-ak/cosmos-firewall/logger"
 )
 
 func TransparentHandler(ctx context.Context, validator middleware.Validator, director middleware.Director) grpc.StreamHandler {
@@ -33,19 +31,31 @@ func (h *handler) handler(_ interface{}, serverStream grpc.ServerStream) error {
 	if !ok {
 		return status.Errorf(codes.Internal, "lowLevelServerStream not exists in context")
 	}
+	_, parse := tracing.Start(serverStream.Context(), tracing.StageParse)
 	f := &types.Frame{}
-	if err := serverStream.RecvMsg(f); err != nil {
+	err := serverStream.RecvMsg(f)
+	parse.End()
+	if err != nil {
 		return err
 	}
-	if err := h.processRequest(f, fullMethodName); err != nil {
-		return err
+	if err := h.processRequest(serverStream.Context(), f, fullMethodName, grpcStamps(h.validator, serverStream.Context())); err != nil {
+		h.validator.RecordRejectionOf(serverStream.Context(), middleware.GRPCClientIP(serverStream.Context(), h.validator.TrustedProxies), err)
+		return grpcRejection(err)
 	}
 	var height int64
 	if h.director != nil {
-		grpcClient, err := h.director(h.ctx, height)
+		grpcClient, err := direct(serverStream.Context(), h.ctx, h.director, height)
 		if err != nil {
 			return err
 		}
+		release, err := h.validator.AcquireUpstream(serverStream.Context(), grpcClient.URI(),
+			middleware.GRPCRouteClass(fullMethodName), middleware.IsHealthRoute(types.GRPCProtocol, fullMethodName))
+		if err != nil {
+			log.Ctx(serverStream.Context()).Warnf("%s upstream overloaded: %s, error: %s", types.GRPCProtocol, grpcClient.URI(), err.Error())
+			h.validator.CountRejection(middleware.RejectOverloaded)
+			return grpcRejection(err)
+		}
+		defer release()
 		return grpcClient.GrpcRedirect(serverStream, fullMethodName, f)
 	}
 	if err := serverStream.SendMsg(nil); err != nil {
@@ -54,16 +64,25 @@ func (h *handler) handler(_ interface{}, serverStream grpc.ServerStream) error {
 	return nil
 }
 
-func (h *handler) processRequest(frame *types.Frame, fullMethodName string) error {
+func (h *handler) processRequest(ctx context.Context, frame *types.Frame, fullMethodName string, stamps []string) error {
+	ctx, span := tracing.Start(ctx, tracing.StageValidate)
+	defer span.End()
 	body := frame.Payload
-	logger.Infof("GRPC RequestURI: [%s]", fullMethodName)
-	logger.Info("GRPC request body base64: ", base64.StdEncoding.EncodeToString(body))
+	log.Ctx(ctx).Infof("GRPC RequestURI: [%s]", fullMethodName)
+	logBody(ctx, h.validator, types.GRPCProtocol, []string{fullMethodName}, body)
 	url := fullMethodName
 
 	if !h.validator.IsGRPCRouterAllowed(url) {
-		return errors.New("method not allowed")
+		return middleware.ErrRouteDenied
+	}
+	if err := h.validator.CheckGRPCRequestSize(url, len(body)); err != nil {
+		return err
+	}
+	payload, err := h.validator.CheckGRPCQuery(url, body)
+	if err != nil {
+		return err
 	}
-	var err error
+	frame.Payload = payload
 	switch url {
 	case "/cosmos.tx.v1beta1.Service/Simulate":
 		simulateReq := tx.SimulateRequest{}
@@ -75,45 +94,49 @@ func (h *handler) processRequest(frame *types.Frame, fullMethodName string) erro
 				}
 				var req1 BroadcastTxRequest
 				if err = json.Unmarshal(body, &req1); err != nil {
-					return errors.Wrapf(err, "unmarshal error: %s", err.Error())
+					return middleware.WrapRejection(middleware.CodeInvalidRequest, err, "unmarshal SimulateRequest")
 				}
 				simulateReq.TxBytes = req1.TxBytes
 			}
 		}
 		if err != nil {
-			return errors.Wrapf(err, "unmarshal error: %s", err.Error())
+			return middleware.WrapRejection(middleware.CodeInvalidRequest, err, "unmarshal SimulateRequest")
 		}
 		if simulateReq.Tx != nil {
-			for _, signature := range simulateReq.Tx.Signatures {
-				if len(signature) != 64 && len(signature) != 65 {
-					return errors.Wrapf(err, "unmarshal error: %s", err.Error())
-				}
-			}
-			if err = h.validator.CheckTxAuthInfo(*simulateReq.Tx.AuthInfo); err != nil {
-				return errors.Wrapf(err, "unmarshal error: %s", err.Error())
-			}
-			if err = h.validator.CheckTxBody(*simulateReq.Tx.Body); err != nil {
-				return errors.Wrapf(err, "unmarshal error: %s", err.Error())
+			err = checkTx(ctx, func() error { return h.validator.CheckTx(simulateReq.Tx) })
+			h.validator.AuditTx(ctx, types.GRPCProtocol, url, middleware.GRPCClientIP(ctx, h.validator.TrustedProxies), simulateReq.Tx, err)
+			if err != nil {
+				return err
 			}
 		}
 		if simulateReq.TxBytes != nil {
-			if err = h.validator.CheckTxBytes(simulateReq.TxBytes); err != nil {
-				return errors.Wrapf(err, "unmarshal error: %s", err.Error())
+			err = checkTx(ctx, func() error { return h.validator.CheckTxBytes(ctx, simulateReq.TxBytes) })
+			h.validator.AuditTxBytes(ctx, types.GRPCProtocol, url, middleware.GRPCClientIP(ctx, h.validator.TrustedProxies), simulateReq.TxBytes, err)
+			if err != nil {
+				return err
 			}
 		}
 	case "/cosmos.tx.v1beta1.Service/BroadcastTx":
 		txRequest := new(tx.BroadcastTxRequest)
 		if err = proto.Unmarshal(body, txRequest); err != nil {
-			return errors.Wrapf(err, "unmarshal error: %s", err.Error())
+			return middleware.WrapRejection(middleware.CodeInvalidRequest, err, "unmarshal BroadcastTxRequest")
 		}
 		switch txRequest.Mode {
 		case tx.BroadcastMode_BROADCAST_MODE_UNSPECIFIED:
-			return errors.New("broadcast method unknown")
+			return middleware.NewRejection(middleware.CodeInvalidRequest, "broadcast method unknown")
 		case tx.BroadcastMode_BROADCAST_MODE_BLOCK:
 		case tx.BroadcastMode_BROADCAST_MODE_SYNC:
 		case tx.BroadcastMode_BROADCAST_MODE_ASYNC:
 		}
-		if err = h.validator.CheckTxBytes(txRequest.TxBytes); err != nil {
+		if err = h.validator.CheckBroadcastStamp(stamps, txRequest.TxBytes); err != nil {
+			h.validator.AuditTxBytes(ctx, types.GRPCProtocol, url, middleware.GRPCClientIP(ctx, h.validator.TrustedProxies), txRequest.TxBytes, err)
+			return err
+		}
+		err = checkTx(ctx, func() error {
+			return h.validator.CheckBroadcastTxBytes(ctx, middleware.GRPCClientIP(ctx, h.validator.TrustedProxies), txRequest.TxBytes)
+		})
+		h.validator.AuditTxBytes(ctx, types.GRPCProtocol, url, middleware.GRPCClientIP(ctx, h.validator.TrustedProxies), txRequest.TxBytes, err)
+		if err != nil {
 			return err
 		}
 	}
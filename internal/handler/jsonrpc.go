@@ -3,67 +3,112 @@ package handler
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tendermint/tendermint/rpc/jsonrpc/server"
 	tmtypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
 
 	"github.com/overload-ak/cosmos-firewall/internal/middleware"
-	"github.com/overload-ak/cosmos-firewall/logger"
+	"github.com/overload-ak/cosmos-firewall/internal/tracing"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
 )
 
 func JSONRPCHandler(ctx context.Context, validator middleware.Validator, director middleware.Director) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		_, parse := tracing.Start(r.Context(), tracing.StageParse)
 		body, err := io.ReadAll(r.Body)
+		parse.End()
 		if err != nil {
-			jsonRpcResponse(w, http.StatusInternalServerError, tmtypes.RPCInvalidParamsError(nil, err))
+			jsonRPCRejectResponse(w, nil, bodyRejection(err))
 			return
 		}
-		logger.Infof("JSONRPC Method: [%s], RequestURI: [%s]", r.Method, r.URL.RequestURI())
-		logger.Info("JSONRPC request body base64: ", base64.StdEncoding.EncodeToString(body))
+		validateCtx, validate := tracing.Start(r.Context(), tracing.StageValidate)
+		defer validate.End()
+		log.Ctx(r.Context()).Infof("JSONRPC Method: [%s], RequestURI: [%s]", r.Method, r.URL.RequestURI())
+		logBody(r.Context(), validator, types.JSONRPCProtocol, httpBodyRoutes(types.JSONRPCProtocol, r, body), body)
 		path := r.URL.Path
 		if !validator.IsJSONPRCRouterAllowed(path) {
-			jsonRpcResponse(w, http.StatusMethodNotAllowed, tmtypes.RPCMethodNotFoundError(nil))
+			validator.RecordRejection(r.Context(), middleware.HTTPClientIP(r, validator.TrustedProxies), middleware.RejectRouteDenied)
+			jsonRPCRejectResponse(w, nil, middleware.ErrRouteDenied)
 			return
 		}
 		var height int64
+		var routes []httpRoute
 		if len(body) == 0 && r.Method == http.MethodGet {
+			if err = validator.CheckJSONRPCURIQuery(strings.TrimPrefix(path, "/"), r.URL); err != nil {
+				validator.RecordRejection(r.Context(), middleware.HTTPClientIP(r, validator.TrustedProxies), middleware.RejectInvalidRequest)
+				jsonRPCRejectResponse(w, nil, err)
+				return
+			}
 			height, _ = strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+			routes = append(routes, httpRoute{name: path, class: middleware.JSONRPCRouteClass(path)})
 		} else if len(body) > 0 {
 			var requests []tmtypes.RPCRequest
+			batch := true
 			if err = json.Unmarshal(body, &requests); err != nil {
 				var request tmtypes.RPCRequest
 				if err = json.Unmarshal(body, &request); err != nil {
-					jsonRpcResponse(w, http.StatusInternalServerError, tmtypes.RPCParseError(err))
+					jsonRpcResponse(w, http.StatusBadRequest, tmtypes.RPCParseError(err))
 					return
 				}
 				requests = []tmtypes.RPCRequest{request}
+				batch = false
 			}
-			for _, rpcRequest := range requests {
+			clamped := false
+			for i, rpcRequest := range requests {
 				request := rpcRequest
+				routes = append(routes, httpRoute{name: "/" + request.Method, class: middleware.JSONRPCRouteClass(request.Method)})
 				if request.ID == nil {
-					logger.Debug(
+					log.Ctx(r.Context()).Debug(
 						"HTTPJSONRPC received a notification, skipping... (please send a non-empty ID if you want to call a method)",
 						"req", request,
 					)
 					continue
 				}
+				params, err := validator.CheckJSONRPCParams(request.Method, request.Params)
+				if err != nil {
+					validator.RecordRejection(r.Context(), middleware.HTTPClientIP(r, validator.TrustedProxies), middleware.RejectInvalidRequest)
+					jsonRPCRejectResponse(w, &request, err)
+					return
+				}
+				if !bytes.Equal(params, request.Params) {
+					requests[i].Params, clamped = params, true
+				}
 				if len(request.Params) > 0 {
 					if request.Method == "broadcast_tx_commit" || request.Method == "check_tx" ||
 						request.Method == "broadcast_tx_sync" || request.Method == "broadcast_tx_async" {
-						txBytes, err := getTxBytesFromParams(request.Params)
+						txBytes, err := getTxBytesFromParams(r.Context(), request.Params)
 						if err != nil {
-							jsonRpcResponse(w, http.StatusInternalServerError, tmtypes.RPCInvalidParamsError(request.ID, err))
+							jsonRPCRejectResponse(w, &request, err)
+							return
+						}
+						checkTxBytes := func(ctx context.Context, txBytes []byte) error {
+							return validator.CheckBroadcastTxBytes(ctx, middleware.HTTPClientIP(r, validator.TrustedProxies), txBytes)
+						}
+						if request.Method == "check_tx" {
+							checkTxBytes = validator.CheckTxBytes
+						} else if err = validator.CheckBroadcastStamp(httpStamps(validator, r), txBytes); err != nil {
+							validator.CountRejection(middleware.RejectProofOfWork)
+							validator.AuditTxBytes(validateCtx, types.JSONRPCProtocol, request.Method, middleware.HTTPClientIP(r, validator.TrustedProxies), txBytes, err)
+							jsonRPCRejectResponse(w, &request, err)
 							return
 						}
-						if err = validator.CheckTxBytes(txBytes); err != nil {
-							jsonRpcResponse(w, http.StatusInternalServerError, tmtypes.RPCInternalError(nil, err))
+						err = checkTx(validateCtx, func() error { return checkTxBytes(validateCtx, txBytes) })
+						validator.AuditTxBytes(validateCtx, types.JSONRPCProtocol, request.Method, middleware.HTTPClientIP(r, validator.TrustedProxies), txBytes, err)
+						if err != nil {
+							if errors.Is(err, middleware.ErrMempoolFull) {
+								overloadedResponse(w, validator, types.JSONRPCProtocol, validator.Mempool.RetryAfter(), err)
+								return
+							}
+							validator.RecordRejectionOf(validateCtx, middleware.HTTPClientIP(r, validator.TrustedProxies), err)
+							jsonRPCRejectResponse(w, &request, err)
 							return
 						}
 					}
@@ -71,21 +116,39 @@ func JSONRPCHandler(ctx context.Context, validator middleware.Validator, directo
 					if request.Method == "block" || request.Method == "block_results" || request.Method == "commit" ||
 						request.Method == "consensus_params" || request.Method == "validators" {
 						//	request.Params
-						params, err := getTxBytesFromParams(request.Params)
+						params, err := getTxBytesFromParams(r.Context(), request.Params)
 						if err != nil {
 							panic(err)
 						}
-						logger.Infof("%v", params)
+						log.Ctx(r.Context()).Infof("%v", params)
 					}
 				}
 			}
+			if clamped {
+				if batch {
+					body, err = json.Marshal(requests)
+				} else {
+					body, err = json.Marshal(requests[0])
+				}
+				if err != nil {
+					jsonRpcResponse(w, http.StatusInternalServerError, tmtypes.RPCInternalError(nil, err))
+					return
+				}
+			}
 		}
+		validate.End()
 		if director != nil {
-			client, err := director(ctx, height)
+			client, err := direct(r.Context(), ctx, director, height)
 			if err != nil {
 				jsonRpcResponse(w, http.StatusMisdirectedRequest, tmtypes.RPCInternalError(nil, err))
 				return
 			}
+			release, err := acquireUpstream(r.Context(), validator, client, types.JSONRPCProtocol, routes)
+			if err != nil {
+				overloadedResponse(w, validator, types.JSONRPCProtocol, time.Second, err)
+				return
+			}
+			defer release()
 			if err = client.HttpRedirect(w, r, bytes.NewReader(body)); err != nil {
 				jsonRpcResponse(w, http.StatusMisdirectedRequest, tmtypes.RPCInternalError(nil, err))
 				return
@@ -96,7 +159,7 @@ func JSONRPCHandler(ctx context.Context, validator middleware.Validator, directo
 	}
 }
 
-func getTxBytesFromParams(data json.RawMessage) ([]byte, error) {
+func getTxBytesFromParams(ctx context.Context, data json.RawMessage) ([]byte, error) {
 	var raw map[string]json.RawMessage
 	if err := json.Unmarshal(data, &raw); err == nil {
 		rawTx, ok := raw["tx"]
@@ -109,7 +172,7 @@ func getTxBytesFromParams(data json.RawMessage) ([]byte, error) {
 		}
 		return txBytes, nil
 	} else {
-		logger.Warnf("json unmarshal raw error: %s", err.Error())
+		log.Ctx(ctx).Warnf("json unmarshal raw error: %s", err.Error())
 	}
 	var raws []json.RawMessage
 	if err := json.Unmarshal(data, &raws); err == nil {
@@ -121,7 +184,7 @@ func getTxBytesFromParams(data json.RawMessage) ([]byte, error) {
 		}
 		return txBytes, nil
 	} else {
-		logger.Warnf("json unmarshal raws error: %s", err.Error())
+		log.Ctx(ctx).Warnf("json unmarshal raws error: %s", err.Error())
 	}
 	return nil, errors.New("unknown type tx raw message")
 }
@@ -129,11 +192,11 @@ func getTxBytesFromParams(data json.RawMessage) ([]byte, error) {
 func jsonRpcResponse(writer http.ResponseWriter, code int, res tmtypes.RPCResponse) {
 	if code != http.StatusOK {
 		if err := server.WriteRPCResponseHTTPError(writer, code, res); err != nil {
-			logger.Error("failed to write response", "res", res, "err", err)
+			log.Error("failed to write response", "res", res, "err", err)
 		}
 		return
 	}
 	if err := server.WriteRPCResponseHTTP(writer, tmtypes.NewRPCSuccessResponse(tmtypes.JSONRPCIntID(0), res)); err != nil {
-		logger.Error("failed to write response", "res", res, "err", err)
+		log.Error("failed to write response", "res", res, "err", err)
 	}
 }
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// MetricsHandler records the count and latency of the requests of a protocol by route and
+// verdict, and the requests in flight. The route of a JSON-RPC POST request is labeled by
+// metricsRouteHandler once its body size is limited.
+func MetricsHandler(validator middleware.Validator, protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inFlight := metrics.RequestsInFlight.WithLabelValues(string(protocol))
+		inFlight.Inc()
+		defer inFlight.Dec()
+		request := &metrics.Request{Protocol: string(protocol), Route: metrics.RouteOther, Start: time.Now()}
+		if protocol == types.RESTProtocol || r.Method == http.MethodGet {
+			routes, _ := httpRoutes(protocol, r)
+			request.Route = metricsRoute(validator, protocol, routes)
+		}
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		// observed on panics too, a response over the size limit is aborted
+		defer func() {
+			request.Observe(sw.status >= http.StatusBadRequest)
+		}()
+		next(sw, r.WithContext(metrics.WithRequest(r.Context(), request)))
+	}
+}
+
+// metricsRouteHandler labels the metrics of a JSON-RPC POST request with the methods it calls.
+func metricsRouteHandler(validator middleware.Validator, protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	if protocol == types.RESTProtocol {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if request, ok := metrics.RequestFromContext(r.Context()); ok && r.Method != http.MethodGet {
+			// malformed bodies are reported by the protocol handler
+			routes, _ := httpRoutes(protocol, r)
+			request.Route = metricsRoute(validator, protocol, routes)
+		}
+		next(w, r)
+	}
+}
+
+// MetricsStreamInterceptor records the count and latency of the gRPC calls by method and verdict.
+func MetricsStreamInterceptor(validator middleware.Validator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		inFlight := metrics.RequestsInFlight.WithLabelValues(string(types.GRPCProtocol))
+		inFlight.Inc()
+		defer inFlight.Dec()
+		request := &metrics.Request{Protocol: string(types.GRPCProtocol), Route: metrics.RouteOther, Start: time.Now()}
+		if validator.IsGRPCRouterAllowed(info.FullMethod) {
+			request.Route = info.FullMethod
+		}
+		err := next(srv, &contextServerStream{ServerStream: ss, ctx: metrics.WithRequest(ss.Context(), request)})
+		request.Observe(err != nil)
+		return err
+	}
+}
+
+// metricsRoute returns the route label of the routes called by a request. Routes the firewall
+// does not serve share a label, to bound the number of series.
+func metricsRoute(validator middleware.Validator, protocol types.Protocol, routes []httpRoute) string {
+	if len(routes) > 1 {
+		return metrics.RouteBatch
+	}
+	if len(routes) == 0 {
+		return metrics.RouteOther
+	}
+	name := routes[0].name
+	switch protocol {
+	case types.RESTProtocol:
+		if pattern, ok := validator.MatchRESTRouter(name); ok {
+			return pattern
+		}
+	case types.EVMRPCProtocol:
+		if validator.IsEVMRPCMethodAllowed(name) {
+			return name
+		}
+	default:
+		if validator.IsJSONPRCRouterAllowed(name) {
+			return name
+		}
+	}
+	return metrics.RouteOther
+}
+
+// statusResponseWriter records the status and the size of the response.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
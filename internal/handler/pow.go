@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+const PoWChallengePath = "/firewall/pow/challenge"
+
+type powChallengeResponse struct {
+	middleware.PoWChallenge
+	Header string `json:"header"`
+}
+
+// PoWHandler serves the proof of work challenge on the REST listener and hands every other
+// request to next. The endpoint is rate limited by client IP.
+func PoWHandler(validator middleware.Validator, next http.HandlerFunc) http.HandlerFunc {
+	if validator.PoW == nil {
+		return next
+	}
+	endpoint := RateLimitHandler(validator, types.RESTProtocol, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			restResponse(w, validator.Cfg.RestFormat, http.StatusMethodNotAllowed, "method not allowed", nil)
+			return
+		}
+		restResponse(w, validator.Cfg.RestFormat, http.StatusOK, "", powChallengeResponse{PoWChallenge: validator.PoW.Challenge(), Header: validator.Cfg.PoW.Header})
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == PoWChallengePath {
+			endpoint(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// httpStamps returns the proof of work stamps of an HTTP request.
+func httpStamps(validator middleware.Validator, r *http.Request) []string {
+	if validator.PoW == nil {
+		return nil
+	}
+	return splitStamps(r.Header.Values(validator.Cfg.PoW.Header))
+}
+
+// grpcStamps returns the proof of work stamps of a gRPC call.
+func grpcStamps(validator middleware.Validator, ctx context.Context) []string {
+	if validator.PoW == nil {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return splitStamps(md.Get(validator.Cfg.PoW.Header))
+}
+
+func splitStamps(values []string) []string {
+	var stamps []string
+	for _, value := range values {
+		for _, stamp := range strings.Split(value, ",") {
+			if stamp = strings.TrimSpace(stamp); stamp != "" {
+				stamps = append(stamps, stamp)
+			}
+		}
+	}
+	return stamps
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+var errRateLimited = middleware.NewRejection(middleware.CodeRateLimited, "rate limit exceeded")
+
+// RateLimitHandler charges the client's token buckets before handing the request to next.
+// Every call of a JSON-RPC batch is charged its route cost against the bucket of its route class,
+// the request being rejected without charging any bucket when one of them is short.
+func RateLimitHandler(validator middleware.Validator, protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	if validator.RateLimiter == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := middleware.HTTPClientIP(r, validator.TrustedProxies)
+		identity, ok := middleware.IdentityFromContext(r.Context())
+		if !ok {
+			identity = middleware.Identity{Client: client}
+		}
+		costs := httpRouteCosts(validator.RateLimiter, protocol, r)
+		if class, ok, retryAfter := validator.RateLimiter.AllowClasses(identity, protocol, costs); !ok {
+			log.Ctx(r.Context()).Warnf("%s rate limit exceeded, client: %s, route class: %s", protocol, identity.Client, class)
+			metrics.RateLimited.WithLabelValues(string(protocol), string(class)).Inc()
+			validator.RecordRejection(r.Context(), client, middleware.RejectRateLimited)
+			w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+			rejectResponse(w, validator.Cfg.RestFormat, protocol, errRateLimited)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RateLimitStreamInterceptor charges the cost of the gRPC method to the client's token bucket of its route class.
+func RateLimitStreamInterceptor(validator middleware.Validator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		if validator.RateLimiter == nil {
+			return next(srv, ss)
+		}
+		client := middleware.GRPCClientIP(ss.Context(), validator.TrustedProxies)
+		identity, ok := middleware.IdentityFromContext(ss.Context())
+		if !ok {
+			identity = middleware.Identity{Client: client}
+		}
+		class := middleware.GRPCRouteClass(info.FullMethod)
+		if ok, retryAfter := validator.RateLimiter.Allow(identity, types.GRPCProtocol, class, validator.RateLimiter.Cost(types.GRPCProtocol, info.FullMethod)); !ok {
+			log.Ctx(ss.Context()).Warnf("%s rate limit exceeded, client: %s, route class: %s", types.GRPCProtocol, identity.Client, class)
+			metrics.RateLimited.WithLabelValues(string(types.GRPCProtocol), string(class)).Inc()
+			validator.RecordRejection(ss.Context(), client, middleware.RejectRateLimited)
+			_ = ss.SetHeader(metadata.Pairs("retry-after", retryAfterSeconds(retryAfter)))
+			return grpcRejection(errRateLimited)
+		}
+		return next(srv, ss)
+	}
+}
+
+// httpRouteCosts returns the total cost of the request per route class.
+func httpRouteCosts(limiter *middleware.RateLimiter, protocol types.Protocol, r *http.Request) map[types.RouteClass]float64 {
+	classes := make(map[types.RouteClass]float64)
+	routes, err := httpRoutes(protocol, r)
+	if err != nil {
+		// malformed bodies are reported by the protocol handler
+		routes = nil
+	}
+	for _, route := range routes {
+		if protocol == types.RESTProtocol {
+			classes[route.class] += limiter.Cost(protocol, r.Method+" "+route.name)
+		} else {
+			classes[route.class] += limiter.Cost(protocol, route.name)
+		}
+	}
+	if len(classes) == 0 {
+		classes[types.QueryRoute] = 1
+	}
+	return classes
+}
+
+// jsonRPCMethods returns the methods called by a JSON-RPC request, either from the
+// URI of a GET request or from a single or batch POST body, which is restored for the next handler.
+func jsonRPCMethods(r *http.Request) ([]string, error) {
+	if r.Method == http.MethodGet {
+		return []string{strings.TrimPrefix(r.URL.Path, "/")}, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return jsonRPCBodyMethods(body)
+}
+
+// jsonRPCBodyMethods returns the methods called by a single or batch JSON-RPC body.
+func jsonRPCBodyMethods(body []byte) ([]string, error) {
+	type rpcMethod struct {
+		Method string `json:"method"`
+	}
+	var requests []rpcMethod
+	if err := json.Unmarshal(body, &requests); err != nil {
+		var request rpcMethod
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, err
+		}
+		requests = []rpcMethod{request}
+	}
+	methods := make([]string, 0, len(requests))
+	for _, request := range requests {
+		methods = append(methods, request.Method)
+	}
+	return methods, nil
+}
+
+func retryAfterSeconds(retryAfter time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds()))))
+}
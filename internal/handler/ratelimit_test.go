@@ -0,0 +1,44 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/handler"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+func TestRateLimitBatchOverBurst(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RateLimit = config.RateLimit{Enable: true, DefaultCost: 1, Rules: map[string]config.RateLimitRule{
+		string(types.JSONRPCProtocol): {RequestsPerSecond: 1, Burst: 10},
+	}}
+	validator := middleware.Validator{Cfg: cfg, RateLimiter: middleware.NewRateLimiter(cfg.RateLimit, nil, nil)}
+	h := handler.RateLimitHandler(validator, types.JSONRPCProtocol, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.RemoteAddr = "10.0.0.1:1234"
+		h(w, r)
+		return w
+	}
+
+	calls := make([]string, 50)
+	for i := range calls {
+		calls[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"status"}`, i)
+	}
+	// the batch costs 50 against a burst of 10, it is admitted and charged in full
+	assert.Equal(t, http.StatusOK, serve("["+strings.Join(calls, ",")+"]").Code)
+	w := serve(`{"jsonrpc":"2.0","id":1,"method":"status"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "41", w.Header().Get("Retry-After"))
+}
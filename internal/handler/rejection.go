@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	tmtypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// rejectionData is the data of a REST rejection in the legacy format, the code of the
+// rejection as in the ErrorInfo details of gRPC.
+type rejectionData struct {
+	Reason string `json:"reason"`
+	Domain string `json:"domain"`
+}
+
+// rejectResponse answers a request rejected with err in the error format of its protocol,
+// format being the REST format of the listener.
+func rejectResponse(w http.ResponseWriter, format string, protocol types.Protocol, err error) {
+	switch protocol {
+	case types.RESTProtocol:
+		restRejectResponse(w, format, err)
+	case types.EVMRPCProtocol:
+		evmRPCRejectResponse(w, nil, err)
+	default:
+		jsonRPCRejectResponse(w, nil, err)
+	}
+}
+
+func restRejectResponse(w http.ResponseWriter, format string, err error) {
+	code := middleware.CodeOf(err)
+	if format == config.RESTFormatLegacy {
+		restResponse(w, format, code.HTTPStatus(), err.Error(), rejectionData{Reason: string(code), Domain: middleware.RejectionDomain})
+		return
+	}
+	gatewayErrorResponse(w, code.HTTPStatus(), rejectionStatus(err))
+}
+
+// jsonRPCRejectResponse answers the JSON-RPC request, nil when the request is not known, with
+// the code of the rejection as error data.
+func jsonRPCRejectResponse(w http.ResponseWriter, request *tmtypes.RPCRequest, err error) {
+	code := middleware.CodeOf(err)
+	res := tmtypes.RPCResponse{JSONRPC: "2.0", Error: &tmtypes.RPCError{Code: code.RPCCode(), Message: err.Error(), Data: string(code)}}
+	if request != nil {
+		res.ID = request.ID
+	}
+	jsonRpcResponse(w, code.HTTPStatus(), res)
+}
+
+// evmRPCRejectResponse answers the ethereum JSON-RPC request with the code of the rejection as error data.
+func evmRPCRejectResponse(w http.ResponseWriter, id json.RawMessage, err error) {
+	code := middleware.CodeOf(err)
+	writeEVMRPCResponse(w, code.HTTPStatus(), evmRPCResponse{JSONRPC: "2.0", ID: id,
+		Error: &evmRPCError{Code: code.RPCCode(), Message: err.Error(), Data: string(code)}})
+}
+
+// grpcRejection returns the status error of a gRPC call rejected with err.
+func grpcRejection(err error) error {
+	return rejectionStatus(err).Err()
+}
+
+// rejectionStatus returns the status of a rejection, with its code in the ErrorInfo details.
+func rejectionStatus(err error) *status.Status {
+	code := middleware.CodeOf(err)
+	st := status.New(code.GRPCCode(), err.Error())
+	if detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: string(code), Domain: middleware.RejectionDomain}); detailsErr == nil {
+		st = detailed
+	}
+	return st
+}
@@ -3,31 +3,46 @@ package handler
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/cosmos/cosmos-sdk/types/tx"
 	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 
+	"github.com/overload-ak/cosmos-firewall/config"
 	"github.com/overload-ak/cosmos-firewall/internal/middleware"
-	"github.com/overload-ak/cosmos-firewall/logger"
+	"github.com/overload-ak/cosmos-firewall/internal/tracing"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
 )
 
 func RestHandler(ctx context.Context, validator middleware.Validator, director middleware.Director) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
+		_, parse := tracing.Start(request.Context(), tracing.StageParse)
 		body, err := io.ReadAll(request.Body)
+		parse.End()
 		if err != nil {
-			restResponse(writer, http.StatusInternalServerError, "read all body error: ", nil)
+			restRejectResponse(writer, validator.Cfg.RestFormat, bodyRejection(err))
 			return
 		}
-		logger.Infof("REST Method: [%s], RequestURI: [%s]", request.Method, request.URL.RequestURI())
-		logger.Info("REST request body base64: ", base64.StdEncoding.EncodeToString(body))
+		validateCtx, validate := tracing.Start(request.Context(), tracing.StageValidate)
+		defer validate.End()
+		log.Ctx(request.Context()).Infof("REST Method: [%s], RequestURI: [%s]", request.Method, request.URL.RequestURI())
+		logBody(request.Context(), validator, types.RESTProtocol, httpBodyRoutes(types.RESTProtocol, request, body), body)
 		url := request.URL.RequestURI()
 		if !validator.IsRESTRouterAllowed(url) {
-			restResponse(writer, http.StatusMethodNotAllowed, "method not allowed", nil)
+			validator.RecordRejection(request.Context(), middleware.HTTPClientIP(request, validator.TrustedProxies), middleware.RejectRouteDenied)
+			restRejectResponse(writer, validator.Cfg.RestFormat, middleware.ErrRouteDenied)
+			return
+		}
+		if err = validator.CheckRESTQuery(request.URL); err != nil {
+			validator.RecordRejection(request.Context(), middleware.HTTPClientIP(request, validator.TrustedProxies), middleware.RejectInvalidRequest)
+			restRejectResponse(writer, validator.Cfg.RestFormat, err)
 			return
 		}
 		var height int64
@@ -42,36 +57,31 @@ func RestHandler(ctx context.Context, validator middleware.Validator, director m
 					}
 					var req1 BroadcastTxRequest
 					if err = json.Unmarshal(body, &req1); err != nil {
-						restResponse(writer, http.StatusInternalServerError, fmt.Sprintf("broadcastTxRequest json unmarshal %v", err.Error()), nil)
+						restRejectResponse(writer, validator.Cfg.RestFormat, middleware.WrapRejection(middleware.CodeInvalidRequest, err, "broadcastTxRequest json unmarshal"))
 						return
 					}
 					simulateReq.TxBytes = req1.TxBytes
 				}
 			}
 			if err != nil {
-				restResponse(writer, http.StatusInternalServerError, fmt.Sprintf("simulateRequest json unmarshal %v", err.Error()), nil)
+				restRejectResponse(writer, validator.Cfg.RestFormat, middleware.WrapRejection(middleware.CodeInvalidRequest, err, "simulateRequest json unmarshal"))
 				return
 			}
 			if simulateReq.Tx != nil {
-				for _, signature := range simulateReq.Tx.Signatures {
-					if len(signature) != 64 && len(signature) != 65 {
-						restResponse(writer, http.StatusNonAuthoritativeInfo, "signature format error", nil)
-						return
-					}
-				}
-				if err = validator.CheckTxAuthInfo(*simulateReq.Tx.AuthInfo); err != nil {
-					restResponse(writer, http.StatusUnprocessableEntity, err.Error(), nil)
-					return
-				}
-
-				if err = validator.CheckTxBody(*simulateReq.Tx.Body); err != nil {
-					restResponse(writer, http.StatusUnprocessableEntity, err.Error(), nil)
+				err = checkTx(validateCtx, func() error { return validator.CheckTx(simulateReq.Tx) })
+				validator.AuditTx(validateCtx, types.RESTProtocol, url, middleware.HTTPClientIP(request, validator.TrustedProxies), simulateReq.Tx, err)
+				if err != nil {
+					validator.RecordRejectionOf(validateCtx, middleware.HTTPClientIP(request, validator.TrustedProxies), err)
+					restRejectResponse(writer, validator.Cfg.RestFormat, err)
 					return
 				}
 			}
 			if simulateReq.TxBytes != nil {
-				if err = validator.CheckTxBytes(simulateReq.TxBytes); err != nil {
-					restResponse(writer, http.StatusUnprocessableEntity, err.Error(), nil)
+				err = checkTx(validateCtx, func() error { return validator.CheckTxBytes(validateCtx, simulateReq.TxBytes) })
+				validator.AuditTxBytes(validateCtx, types.RESTProtocol, url, middleware.HTTPClientIP(request, validator.TrustedProxies), simulateReq.TxBytes, err)
+				if err != nil {
+					validator.RecordRejectionOf(validateCtx, middleware.HTTPClientIP(request, validator.TrustedProxies), err)
+					restRejectResponse(writer, validator.Cfg.RestFormat, err)
 					return
 				}
 			}
@@ -84,14 +94,14 @@ func RestHandler(ctx context.Context, validator middleware.Validator, director m
 				}
 				var req1 BroadcastTxRequest
 				if err = json.Unmarshal(body, &req1); err != nil {
-					restResponse(writer, http.StatusInternalServerError, fmt.Sprintf("json unmarshal BroadcastTxRequest error: %s", err.Error()), nil)
+					restRejectResponse(writer, validator.Cfg.RestFormat, middleware.WrapRejection(middleware.CodeInvalidRequest, err, "json unmarshal BroadcastTxRequest"))
 					return
 				}
 				req.TxBytes = req1.TxBytes
 				req.Mode = tx.BroadcastMode(tx.BroadcastMode_value[req1.Mode])
 			}
 			if req.TxBytes == nil {
-				restResponse(writer, http.StatusInternalServerError, "invalid empty tx bytes", nil)
+				restRejectResponse(writer, validator.Cfg.RestFormat, middleware.NewRejection(middleware.CodeInvalidRequest, "invalid empty tx bytes"))
 				return
 			}
 			switch req.Mode {
@@ -100,24 +110,47 @@ func RestHandler(ctx context.Context, validator middleware.Validator, director m
 			case tx.BroadcastMode_BROADCAST_MODE_SYNC:
 			case tx.BroadcastMode_BROADCAST_MODE_ASYNC:
 			}
-			if err = validator.CheckTxBytes(req.TxBytes); err != nil {
-				restResponse(writer, http.StatusUnprocessableEntity, err.Error(), nil)
+			if err = validator.CheckBroadcastStamp(httpStamps(validator, request), req.TxBytes); err != nil {
+				validator.CountRejection(middleware.RejectProofOfWork)
+				validator.AuditTxBytes(validateCtx, types.RESTProtocol, url, middleware.HTTPClientIP(request, validator.TrustedProxies), req.TxBytes, err)
+				restRejectResponse(writer, validator.Cfg.RestFormat, err)
+				return
+			}
+			err = checkTx(validateCtx, func() error {
+				return validator.CheckBroadcastTxBytes(validateCtx, middleware.HTTPClientIP(request, validator.TrustedProxies), req.TxBytes)
+			})
+			validator.AuditTxBytes(validateCtx, types.RESTProtocol, url, middleware.HTTPClientIP(request, validator.TrustedProxies), req.TxBytes, err)
+			if err != nil {
+				if errors.Is(err, middleware.ErrMempoolFull) {
+					overloadedResponse(writer, validator, types.RESTProtocol, validator.Mempool.RetryAfter(), err)
+					return
+				}
+				validator.RecordRejectionOf(validateCtx, middleware.HTTPClientIP(request, validator.TrustedProxies), err)
+				restRejectResponse(writer, validator.Cfg.RestFormat, err)
 				return
 			}
 		}
+		validate.End()
 		if director != nil {
-			client, err := director(ctx, height)
+			client, err := direct(request.Context(), ctx, director, height)
 			if err != nil {
-				restResponse(writer, http.StatusMisdirectedRequest, err.Error(), nil)
+				restResponse(writer, validator.Cfg.RestFormat, http.StatusMisdirectedRequest, err.Error(), nil)
 				return
 			}
+			release, err := acquireUpstream(request.Context(), validator, client, types.RESTProtocol,
+				[]httpRoute{{name: request.URL.Path, class: middleware.RESTRouteClass(request.Method, request.URL.Path)}})
+			if err != nil {
+				overloadedResponse(writer, validator, types.RESTProtocol, time.Second, err)
+				return
+			}
+			defer release()
 			if err = client.HttpRedirect(writer, request, bytes.NewReader(body)); err != nil {
-				restResponse(writer, http.StatusMisdirectedRequest, err.Error(), nil)
+				restResponse(writer, validator.Cfg.RestFormat, http.StatusMisdirectedRequest, err.Error(), nil)
 				return
 			}
 			return
 		}
-		restResponse(writer, http.StatusOK, "SUCCESS", nil)
+		restResponse(writer, validator.Cfg.RestFormat, http.StatusOK, "SUCCESS", nil)
 	}
 }
 
@@ -127,21 +160,74 @@ type Response struct {
 	Data interface{} `json:"data"`
 }
 
-func restResponse(writer http.ResponseWriter, code int, msg string, data interface{}) {
-	writer.Header().Set("Content-Type", "application/json")
-	writer.WriteHeader(code)
-	response := &Response{
-		Code: code,
-		Msg:  msg,
-		Data: data,
+// restResponse writes a response rendered by the firewall in the REST format of the
+// listener: in the gateway format the data of a success, or the status of an error with the
+// gRPC code matching the HTTP status.
+func restResponse(writer http.ResponseWriter, format string, code int, msg string, data interface{}) {
+	if format == config.RESTFormatLegacy {
+		writeRESTResponse(writer, code, &Response{Code: code, Msg: msg, Data: data})
+		return
 	}
+	if code >= http.StatusBadRequest {
+		gatewayErrorResponse(writer, code, status.New(httpStatusGRPCCode(code), msg))
+		return
+	}
+	if data == nil {
+		data = struct{}{}
+	}
+	writeRESTResponse(writer, code, data)
+}
+
+// gatewayErrorResponse writes an error status in the grpc-gateway schema, {code, message, details}.
+func gatewayErrorResponse(writer http.ResponseWriter, code int, st *status.Status) {
+	d, err := protojson.Marshal(st.Proto())
+	if err != nil {
+		log.Errorf("output json marshal error: %s", err.Error())
+		return
+	}
+	writeRESTBody(writer, code, d)
+}
+
+func writeRESTResponse(writer http.ResponseWriter, code int, response interface{}) {
 	d, err := json.Marshal(response)
-	logger.Infof("REST response statusCode: %d, body: %s", code, base64.StdEncoding.EncodeToString(d))
 	if err != nil {
-		logger.Errorf("output json marshal error: %s", err.Error())
-	} else {
-		if _, err := writer.Write(d); err != nil {
-			logger.Errorf("output write error: %s", err.Error())
-		}
+		log.Errorf("output json marshal error: %s", err.Error())
+		return
+	}
+	writeRESTBody(writer, code, d)
+}
+
+func writeRESTBody(writer http.ResponseWriter, code int, d []byte) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	log.Debugf("REST response statusCode: %d, size: %d", code, len(d))
+	if _, err := writer.Write(d); err != nil {
+		log.Errorf("output write error: %s", err.Error())
+	}
+}
+
+// httpStatusGRPCCode returns the gRPC code of an HTTP error status of a response not
+// carrying a rejection.
+func httpStatusGRPCCode(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusPreconditionRequired:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusMisdirectedRequest, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
 	}
+	return codes.Unknown
 }
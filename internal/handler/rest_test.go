@@ -0,0 +1,122 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/handler"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+const errorInfoType = "type.googleapis.com/google.rpc.ErrorInfo"
+
+func newRESTValidator(format string) middleware.Validator {
+	cfg := config.DefaultConfig()
+	cfg.RestFormat = format
+	cfg.QueryLimit.Enable = true
+	return middleware.NewValidator(cfg)
+}
+
+func serveREST(t *testing.T, h http.HandlerFunc, target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, target, nil))
+	res := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res), w.Body.String())
+	return w, res
+}
+
+func TestRESTRejectResponse(t *testing.T) {
+	rejections := []struct {
+		target string
+		status int
+		code   middleware.Code
+	}{
+		{"/firewall/unknown", http.StatusMethodNotAllowed, middleware.CodeRouteDenied},
+		{"/cosmos/bank/v1beta1/balances/fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy?pagination.limit=1000000", http.StatusBadRequest, middleware.CodeQueryLimitExceeded},
+	}
+
+	// the gateway format carries the code of the rejection in the ErrorInfo details
+	h := handler.RestHandler(context.Background(), newRESTValidator(config.RESTFormatGateway), nil)
+	for _, rejection := range rejections {
+		w, res := serveREST(t, h, rejection.target)
+		assert.Equal(t, rejection.status, w.Code, rejection.target)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, float64(rejection.code.GRPCCode()), res["code"], rejection.target)
+		assert.NotEmpty(t, res["message"], rejection.target)
+		require.Len(t, res["details"], 1, rejection.target)
+		details := res["details"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, errorInfoType, details["@type"])
+		assert.Equal(t, string(rejection.code), details["reason"])
+		assert.Equal(t, middleware.RejectionDomain, details["domain"])
+	}
+
+	// the legacy format carries it in the data
+	h = handler.RestHandler(context.Background(), newRESTValidator(config.RESTFormatLegacy), nil)
+	for _, rejection := range rejections {
+		w, res := serveREST(t, h, rejection.target)
+		assert.Equal(t, rejection.status, w.Code, rejection.target)
+		assert.Equal(t, float64(rejection.status), res["code"], rejection.target)
+		assert.NotEmpty(t, res["msg"], rejection.target)
+		assert.Equal(t, map[string]interface{}{"reason": string(rejection.code), "domain": middleware.RejectionDomain}, res["data"])
+	}
+}
+
+func TestRESTResponse(t *testing.T) {
+	director := func(ctx context.Context, height int64) (*middleware.RedirectClient, error) {
+		return nil, errors.New("no upstream node")
+	}
+	target := "/cosmos/bank/v1beta1/balances/fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy"
+
+	// an error which is not a rejection has the gRPC code of its HTTP status and no details
+	h := handler.RestHandler(context.Background(), newRESTValidator(config.RESTFormatGateway), director)
+	w, res := serveREST(t, h, target)
+	assert.Equal(t, http.StatusMisdirectedRequest, w.Code)
+	assert.Equal(t, float64(codes.Unavailable), res["code"])
+	assert.Equal(t, "no upstream node", res["message"])
+	assert.Empty(t, res["details"])
+
+	h = handler.RestHandler(context.Background(), newRESTValidator(config.RESTFormatLegacy), director)
+	w, res = serveREST(t, h, target)
+	assert.Equal(t, http.StatusMisdirectedRequest, w.Code)
+	assert.Equal(t, float64(http.StatusMisdirectedRequest), res["code"])
+	assert.Equal(t, "no upstream node", res["msg"])
+	assert.Nil(t, res["data"])
+}
+
+func TestRESTForwardedResponse(t *testing.T) {
+	// the responses of the upstream node are neither parsed nor rendered again
+	responses := map[string]struct {
+		status int
+		body   string
+	}{
+		"/cosmos/bank/v1beta1/balances/fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy": {http.StatusOK, `{"balances":[],  "pagination":{"next_key":null,"total":"0"}}`},
+		"/cosmos/bank/v1beta1/balances/fx1invalid":                                {http.StatusBadRequest, `{"code":3,"message":"invalid address","details":[]}` + "\n"},
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(responses[r.URL.Path].status)
+		_, _ = w.Write([]byte(responses[r.URL.Path].body))
+	}))
+	defer upstream.Close()
+	director := func(ctx context.Context, height int64) (*middleware.RedirectClient, error) {
+		return middleware.NewRedirectClient(ctx, upstream.URL, upstream.Client(), nil), nil
+	}
+
+	for _, format := range []string{config.RESTFormatGateway, config.RESTFormatLegacy} {
+		h := handler.RestHandler(context.Background(), newRESTValidator(format), director)
+		for target, response := range responses {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodGet, target, nil))
+			assert.Equal(t, response.status, w.Code, format)
+			assert.Equal(t, response.body, w.Body.String(), format)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// SizeLimitHandler caps the request body at the limit of the route, rejecting a request
+// declaring a larger Content-Length before it is read, and the response at the limit of the protocol.
+func SizeLimitHandler(validator middleware.Validator, protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	limits := validator.SizeLimits
+	if limits == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if maxBytes := limits.MaxRequestBytes(protocol, r.URL.Path); maxBytes > 0 {
+			if r.ContentLength > maxBytes {
+				log.Ctx(r.Context()).Warnf("%s request too large, client: %s, size: %d", protocol, middleware.HTTPClientIP(r, validator.TrustedProxies), r.ContentLength)
+				validator.CountRejection(middleware.RejectTooLarge)
+				rejectResponse(w, validator.Cfg.RestFormat, protocol, middleware.ErrRequestTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		}
+		if maxBytes := limits.MaxResponseBytes(protocol); maxBytes > 0 {
+			w = &limitedResponseWriter{ResponseWriter: w, ctx: r.Context(), protocol: protocol, format: validator.Cfg.RestFormat, limit: maxBytes}
+		}
+		next(w, r)
+	}
+}
+
+// limitedResponseWriter replaces a response declaring a Content-Length over the limit by an
+// error and aborts a streamed response once it exceeds the limit.
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	protocol    types.Protocol
+	format      string
+	limit       int64
+	written     int64
+	wroteHeader bool
+	exceeded    bool
+}
+
+func (w *limitedResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if length, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64); err == nil && length > w.limit {
+		log.Ctx(w.ctx).Warnf("%s upstream response too large, size: %d", w.protocol, length)
+		w.exceeded = true
+		for key := range w.Header() {
+			w.Header().Del(key)
+		}
+		rejectResponse(w.ResponseWriter, w.format, w.protocol, middleware.ErrResponseTooLarge)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *limitedResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.exceeded {
+		return 0, middleware.ErrResponseTooLarge
+	}
+	if w.written+int64(len(p)) > w.limit {
+		log.Ctx(w.ctx).Warnf("%s upstream response too large, aborted after %d bytes", w.protocol, w.written)
+		// the status is sent already, the client sees a broken connection instead of a truncated response
+		panic(http.ErrAbortHandler)
+	}
+	w.written += int64(len(p))
+	return w.ResponseWriter.Write(p)
+}
+
+// bodyRejection returns the rejection of a request whose body could not be read.
+func bodyRejection(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return middleware.WrapRejection(middleware.CodeRequestTooLarge, err, "read body")
+	}
+	return middleware.WrapRejection(middleware.CodeInvalidRequest, err, "read body")
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/tracing"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// TracingHandler starts the span of a request of a protocol, continuing the trace propagated
+// by the client. The stages of the request are spans of their own started by the handlers.
+func TracingHandler(protocol types.Protocol, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.StartServer(tracing.ExtractHTTP(r.Context(), r.Header), string(protocol),
+			semconv.HTTPMethod(r.Method), semconv.HTTPTarget(r.URL.Path))
+		defer span.End()
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(sw, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPStatusCode(sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	}
+}
+
+// TracingStreamInterceptor starts the span of a gRPC call, continuing the trace propagated
+// by the client.
+func TracingStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		ctx, span := tracing.StartServer(tracing.ExtractGRPC(ss.Context()), string(types.GRPCProtocol),
+			semconv.RPCSystemGRPC, semconv.RPCMethod(info.FullMethod))
+		defer span.End()
+		err := next(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+		tracing.Fail(span, err)
+		return err
+	}
+}
+
+// checkTx runs a tx check in a span of its own, the decoding and the checks of a tx being
+// the costliest part of the validation.
+func checkTx(ctx context.Context, check func() error) error {
+	_, span := tracing.Start(ctx, tracing.StageCheckTx)
+	defer span.End()
+	err := check()
+	tracing.Fail(span, err)
+	return err
+}
+
+// direct selects the upstream node of a request in a span of its own.
+func direct(ctx, serverCtx context.Context, director middleware.Director, height int64) (*middleware.RedirectClient, error) {
+	_, span := tracing.Start(ctx, tracing.StageDirector)
+	defer span.End()
+	client, err := director(serverCtx, height)
+	if err != nil {
+		tracing.Fail(span, err)
+		return nil, err
+	}
+	span.SetAttributes(semconv.NetPeerName(client.URI()))
+	return client, nil
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "firewall"
+
+// Verdicts of the requests.
+const (
+	// VerdictForwarded is a request forwarded to an upstream node which answered.
+	VerdictForwarded = "forwarded"
+	// VerdictUpstreamError is a request forwarded to an upstream node which failed to answer.
+	VerdictUpstreamError = "upstream_error"
+	// VerdictAllowed is a request accepted and answered by the firewall, without redirect.
+	VerdictAllowed = "allowed"
+	// VerdictRejected is a request rejected by the firewall.
+	VerdictRejected = "rejected"
+)
+
+// RouteOther labels the routes the firewall does not serve, and RouteBatch the JSON-RPC batches.
+const (
+	RouteOther = "other"
+	RouteBatch = "batch"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Requests by protocol, route and verdict.",
+	}, []string{"protocol", "route", "verdict"})
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Request latency by protocol, route and verdict.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"protocol", "route", "verdict"})
+	RequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "requests_in_flight",
+		Help:      "Requests being served by protocol.",
+	}, []string{"protocol"})
+	Rejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejections_total",
+		Help:      "Rejections by reason.",
+	}, []string{"reason"})
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests over a rate limit by protocol and route class.",
+	}, []string{"protocol", "class"})
+	UpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of the requests forwarded to an upstream node.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream"})
+	UpstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Requests forwarded to an upstream node which failed or answered a server error.",
+	}, []string{"upstream"})
+	UpstreamInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_in_flight",
+		Help:      "Requests being forwarded to an upstream node.",
+	}, []string{"upstream"})
+	NodeUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_up",
+		Help:      "Whether an upstream node answered the last health check, by node and node type.",
+	}, []string{"node", "type"})
+	NodeHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_height",
+		Help:      "Latest block height of an upstream node at the last health check.",
+	}, []string{"node", "type"})
+	NodeHeightLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_height_lag",
+		Help:      "Blocks an upstream node is behind the highest node of its protocol.",
+	}, []string{"node", "type"})
+	MempoolTxs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mempool_txs",
+		Help:      "Txs in the fullest upstream mempool.",
+	})
+	MempoolBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mempool_bytes",
+		Help:      "Bytes in the fullest upstream mempool.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Requests, RequestDuration, RequestsInFlight, Rejections, RateLimited,
+		UpstreamDuration, UpstreamErrors, UpstreamInFlight,
+		NodeUp, NodeHeight, NodeHeightLag, MempoolTxs, MempoolBytes,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Request is the state of a request recorded once it is served.
+type Request struct {
+	Protocol  string
+	Route     string
+	Start     time.Time
+	Forwarded bool
+	Failed    bool
+	// Upstream is the URI of the upstream node the request is forwarded to.
+	Upstream string
+}
+
+type requestKey struct{}
+
+// WithRequest returns a context carrying the state of the request.
+func WithRequest(ctx context.Context, request *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// RequestFromContext returns the state of the request carried by ctx.
+func RequestFromContext(ctx context.Context) (*Request, bool) {
+	request, ok := ctx.Value(requestKey{}).(*Request)
+	return request, ok
+}
+
+// Observe records a request served, rejected tells whether the firewall answered an error.
+func (r *Request) Observe(rejected bool) {
+	verdict := VerdictAllowed
+	switch {
+	case r.Forwarded && r.Failed:
+		verdict = VerdictUpstreamError
+	case r.Forwarded:
+		verdict = VerdictForwarded
+	case rejected:
+		verdict = VerdictRejected
+	}
+	Requests.WithLabelValues(r.Protocol, r.Route, verdict).Inc()
+	RequestDuration.WithLabelValues(r.Protocol, r.Route, verdict).Observe(time.Since(r.Start).Seconds())
+}
+
+// ObserveUpstream records a request forwarded to an upstream node, marking the request
+// carried by ctx as forwarded.
+func ObserveUpstream(ctx context.Context, upstream string, start time.Time, failed bool) {
+	UpstreamDuration.WithLabelValues(upstream).Observe(time.Since(start).Seconds())
+	if failed {
+		UpstreamErrors.WithLabelValues(upstream).Inc()
+	}
+	if request, ok := RequestFromContext(ctx); ok {
+		request.Forwarded, request.Failed, request.Upstream = true, failed, upstream
+	}
+}
@@ -0,0 +1,46 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
+)
+
+func TestRequestVerdict(t *testing.T) {
+	observe := func(forwarded, failed, rejected bool) {
+		request := &metrics.Request{Protocol: "rest", Route: "/cosmos/bank/v1beta1/balances/{address}", Start: time.Now()}
+		ctx := metrics.WithRequest(context.Background(), request)
+		if forwarded {
+			metrics.ObserveUpstream(ctx, "http://127.0.0.1:1317", time.Now(), failed)
+		}
+		request.Observe(rejected)
+	}
+	count := func(verdict string) float64 {
+		return testutil.ToFloat64(metrics.Requests.WithLabelValues("rest", "/cosmos/bank/v1beta1/balances/{address}", verdict))
+	}
+	observe(true, false, true)
+	observe(true, true, true)
+	observe(false, false, true)
+	observe(false, false, false)
+	// a request forwarded is not rejected by the firewall whatever the upstream answers
+	assert.Equal(t, float64(1), count(metrics.VerdictForwarded))
+	assert.Equal(t, float64(1), count(metrics.VerdictUpstreamError))
+	assert.Equal(t, float64(1), count(metrics.VerdictRejected))
+	assert.Equal(t, float64(1), count(metrics.VerdictAllowed))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.UpstreamErrors.WithLabelValues("http://127.0.0.1:1317")))
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `firewall_requests_total{protocol="rest",route="/cosmos/bank/v1beta1/balances/{address}",verdict="forwarded"} 1`)
+	assert.Contains(t, string(body), "firewall_upstream_request_duration_seconds_bucket")
+}
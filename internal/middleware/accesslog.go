@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+)
+
+// RequestIDHeader is the header of the request id, RequestIDMetadata its gRPC metadata key.
+const (
+	RequestIDHeader   = "X-Request-ID"
+	RequestIDMetadata = "x-request-id"
+)
+
+// maxRequestIDLength bounds the length of a request id accepted from a client.
+const maxRequestIDLength = 128
+
+// AccessRecord is a line of the access log. Method is the HTTP method or the full gRPC method,
+// Route the route label of the metrics and Status the HTTP status or the gRPC status code.
+type AccessRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	ClientIP  string    `json:"client_ip"`
+	Protocol  string    `json:"protocol"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path,omitempty"`
+	Route     string    `json:"route"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	LatencyMs float64   `json:"latency_ms"`
+	Upstream  string    `json:"upstream,omitempty"`
+}
+
+// AccessLogger appends the access log as JSON lines, rotating it by size and time, see config.AccessLog.
+type AccessLogger struct {
+	*jsonLog
+}
+
+func NewAccessLogger(cfg config.AccessLog) *AccessLogger {
+	return &AccessLogger{jsonLog: newJSONLog("access", cfg.Rotation.Open(cfg.File))}
+}
+
+// Record appends a record to the access log.
+func (a *AccessLogger) Record(record AccessRecord) {
+	a.append(record)
+}
+
+// RequestID returns the request id sent by the client, or a new one when it sent none or
+// one which is too long or not made of printable ASCII.
+func RequestID(sent string) string {
+	if isValidRequestID(sent) {
+		return sent
+	}
+	bz := make([]byte, 16)
+	// the reader of crypto/rand does not fail on the supported platforms
+	_, _ = rand.Read(bz)
+	return hex.EncodeToString(bz)
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request id carried by ctx, empty without one.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,90 @@
+package middleware_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestRequestID(t *testing.T) {
+	assert.Equal(t, "a1b2-c3d4", middleware.RequestID("a1b2-c3d4"))
+
+	generated := middleware.RequestID("")
+	assert.Len(t, generated, 32)
+	assert.NotEqual(t, generated, middleware.RequestID(""))
+	for _, sent := range []string{"with space", "line\nbreak", "nön-ascii", strings.Repeat("x", 129)} {
+		id := middleware.RequestID(sent)
+		assert.NotEqual(t, sent, id)
+		assert.Len(t, id, 32)
+	}
+
+	ctx := middleware.WithRequestID(context.Background(), generated)
+	assert.Equal(t, generated, middleware.RequestIDFromContext(ctx))
+	assert.Empty(t, middleware.RequestIDFromContext(context.Background()))
+}
+
+func TestAccessLog(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AccessLog.Enable = true
+	cfg.AccessLog.File = filepath.Join(t.TempDir(), "access.jsonl")
+	require.NoError(t, cfg.AccessLog.ValidateBasic())
+	validator := middleware.NewValidator(cfg)
+	require.NotNil(t, validator.AccessLogger)
+
+	validator.AccessLogger.Record(middleware.AccessRecord{
+		Time:      time.Now().UTC(),
+		RequestID: "req-1",
+		ClientIP:  "10.0.0.1",
+		Protocol:  "rest",
+		Method:    "GET",
+		Path:      "/cosmos/bank/v1beta1/balances/fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy",
+		Route:     "/cosmos/bank/v1beta1/balances/{address}",
+		Status:    200,
+		Bytes:     128,
+		LatencyMs: 1.5,
+		Upstream:  "http://127.0.0.1:1317",
+	})
+	validator.AccessLogger.Record(middleware.AccessRecord{
+		Time:      time.Now().UTC(),
+		RequestID: "req-2",
+		ClientIP:  "10.0.0.2",
+		Protocol:  "grpc",
+		Method:    "/cosmos.tx.v1beta1.Service/BroadcastTx",
+		Route:     "/cosmos.tx.v1beta1.Service/BroadcastTx",
+		Status:    3,
+	})
+
+	file, err := os.Open(cfg.AccessLog.File)
+	require.NoError(t, err)
+	defer file.Close()
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+
+	assert.Equal(t, "req-1", records[0]["request_id"])
+	assert.Equal(t, "/cosmos/bank/v1beta1/balances/{address}", records[0]["route"])
+	assert.Equal(t, float64(128), records[0]["bytes"])
+	assert.Equal(t, 1.5, records[0]["latency_ms"])
+	assert.Equal(t, "http://127.0.0.1:1317", records[0]["upstream"])
+
+	assert.Equal(t, "req-2", records[1]["request_id"])
+	assert.Equal(t, float64(3), records[1]["status"])
+	assert.NotContains(t, records[1], "path")
+	assert.NotContains(t, records[1], "upstream")
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+var (
+	ErrInvalidAPIKey     = NewRejection(CodeUnauthenticated, "invalid api key")
+	ErrRouteNotPermitted = NewRejection(CodeRouteNotPermitted, "route is not permitted for the api key tier")
+)
+
+// APIKey is an entry of the key file, Hash is the hex encoded sha256 of the key.
+type APIKey struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	Tier string `json:"tier"`
+}
+
+// Identity is the client a request is accounted to: the name of its API key, or its IP
+// for anonymous clients, and the tier serving it.
+type Identity struct {
+	Client string
+	Tier   string
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// HashAPIKey returns the hash of a key as stored in the key file.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// Authenticator resolves API keys and the tokens issued by the Challenger to tiers,
+// the key file is reloaded when it changes.
+type Authenticator struct {
+	cfg        config.Auth
+	keys       atomic.Value // map[string]APIKey by hash
+	modTime    time.Time
+	challenger *Challenger
+}
+
+func NewAuthenticator(cfg config.Auth, registry codectypes.InterfaceRegistry) (*Authenticator, error) {
+	authenticator := &Authenticator{cfg: cfg}
+	if cfg.Challenge.Enable {
+		authenticator.challenger = NewChallenger(cfg.Challenge, registry)
+	}
+	if err := authenticator.Reload(); err != nil {
+		return nil, err
+	}
+	return authenticator, nil
+}
+
+// Reload reads the key file, the keys in use are kept when the file is invalid.
+func (a *Authenticator) Reload() error {
+	info, err := os.Stat(a.cfg.KeyFile)
+	if err != nil {
+		return errors.Wrapf(err, "stat api key file")
+	}
+	bz, err := os.ReadFile(a.cfg.KeyFile)
+	if err != nil {
+		return errors.Wrapf(err, "read api key file")
+	}
+	var apiKeys []APIKey
+	if err = json.Unmarshal(bz, &apiKeys); err != nil {
+		return errors.Wrapf(err, "unmarshal api key file")
+	}
+	keys := make(map[string]APIKey, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		// viper lowercases the tier names of the config
+		apiKey.Tier = strings.ToLower(apiKey.Tier)
+		if _, ok := a.cfg.Tiers[apiKey.Tier]; !ok {
+			return errors.Errorf("unknown tier %s of api key %s", apiKey.Tier, apiKey.Name)
+		}
+		hash, err := hex.DecodeString(apiKey.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return errors.Errorf("invalid hash of api key %s", apiKey.Name)
+		}
+		keys[strings.ToLower(apiKey.Hash)] = apiKey
+	}
+	a.keys.Store(keys)
+	a.modTime = info.ModTime()
+	return nil
+}
+
+// Watch reloads the key file when its modification time changes, until ctx is done.
+func (a *Authenticator) Watch(ctx context.Context) {
+	if a.cfg.ReloadSecond <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(a.cfg.ReloadSecond) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(a.cfg.KeyFile)
+			if err != nil || info.ModTime().Equal(a.modTime) {
+				continue
+			}
+			if err = a.Reload(); err != nil {
+				log.Errorf("reload api key file: %s", err.Error())
+				continue
+			}
+			log.Infof("reloaded api key file %s", a.cfg.KeyFile)
+		}
+	}
+}
+
+// Authenticate returns the identity of the holder of an API key or token, or the anonymous
+// identity of client when no key is given.
+func (a *Authenticator) Authenticate(key, client string) (Identity, error) {
+	if key == "" {
+		return Identity{Client: client, Tier: a.cfg.DefaultTier}, nil
+	}
+	if apiKey, ok := a.keys.Load().(map[string]APIKey)[HashAPIKey(key)]; ok {
+		return Identity{Client: "key:" + apiKey.Name, Tier: apiKey.Tier}, nil
+	}
+	if a.challenger != nil {
+		if address, ok := a.challenger.Address(key); ok {
+			return Identity{Client: "address:" + address, Tier: a.cfg.Challenge.Tier}, nil
+		}
+	}
+	return Identity{}, ErrInvalidAPIKey
+}
+
+// Challenger returns the challenger of the address authentication, nil when disabled.
+func (a *Authenticator) Challenger() *Challenger {
+	return a.challenger
+}
+
+// HTTPAPIKey returns the API key of an HTTP request from the configured header or query param.
+func (a *Authenticator) HTTPAPIKey(r *http.Request) string {
+	if a.cfg.Header != "" {
+		if key := r.Header.Get(a.cfg.Header); key != "" {
+			return key
+		}
+	}
+	if a.cfg.QueryParam != "" {
+		return r.URL.Query().Get(a.cfg.QueryParam)
+	}
+	return ""
+}
+
+// StripHTTPAPIKey removes the API key from an HTTP request before it is forwarded.
+func (a *Authenticator) StripHTTPAPIKey(r *http.Request) {
+	if a.cfg.Header != "" {
+		r.Header.Del(a.cfg.Header)
+	}
+	if query := r.URL.Query(); a.cfg.QueryParam != "" && query.Has(a.cfg.QueryParam) {
+		query.Del(a.cfg.QueryParam)
+		r.URL.RawQuery = query.Encode()
+	}
+}
+
+// GRPCAPIKey returns the API key of a gRPC call from the metadata named after the configured header.
+func (a *Authenticator) GRPCAPIKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(a.cfg.Header); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// CheckRoute checks the tier of the identity permits the route of the protocol and its class.
+func (a *Authenticator) CheckRoute(identity Identity, protocol types.Protocol, class types.RouteClass, route string) error {
+	tier := a.cfg.Tiers[identity.Tier]
+	if class == types.BroadcastRoute && !tier.Broadcast {
+		return ErrRouteNotPermitted
+	}
+	patterns, ok := tier.Routes[string(protocol)]
+	if !ok || len(patterns) == 0 {
+		return nil
+	}
+	for _, pattern := range patterns {
+		if matchMethod(pattern, route) {
+			return nil
+		}
+	}
+	return ErrRouteNotPermitted
+}
@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+func TestAuthenticator(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys := func(name, key, tier string) {
+		content := fmt.Sprintf(`[{"name":%q,"hash":%q,"tier":%q}]`, name, middleware.HashAPIKey(key), tier)
+		require.NoError(t, os.WriteFile(keyFile, []byte(content), 0o600))
+	}
+	writeKeys("partner-a", "secret-a", "partner")
+
+	cfg := config.DefaultConfig().Auth
+	cfg.Enable = true
+	cfg.KeyFile = keyFile
+	cfg.Tiers = map[string]config.Tier{
+		"anonymous": {Broadcast: false, Routes: map[string][]string{string(types.RESTProtocol): {"/cosmos/bank/*"}}},
+		"partner": {Broadcast: true, Rules: map[string]config.RateLimitRule{
+			string(types.RESTProtocol): {RequestsPerSecond: 1, Burst: 5},
+		}},
+	}
+	authenticator, err := middleware.NewAuthenticator(cfg, nil)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/cosmos/staking/v1beta1/validators?api_key=secret-a", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	identity, err := authenticator.Authenticate(authenticator.HTTPAPIKey(r), "1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, middleware.Identity{Client: "key:partner-a", Tier: "partner"}, identity)
+	assert.NoError(t, authenticator.CheckRoute(identity, types.RESTProtocol, types.QueryRoute, r.URL.Path))
+	assert.NoError(t, authenticator.CheckRoute(identity, types.RESTProtocol, types.BroadcastRoute, "/cosmos/tx/v1beta1/txs"))
+	authenticator.StripHTTPAPIKey(r)
+	assert.Empty(t, r.URL.RawQuery)
+
+	anonymous, err := authenticator.Authenticate("", "1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, middleware.Identity{Client: "1.2.3.4", Tier: "anonymous"}, anonymous)
+	assert.NoError(t, authenticator.CheckRoute(anonymous, types.RESTProtocol, types.QueryRoute, "/cosmos/bank/v1beta1/balances/fx1"))
+	assert.ErrorIs(t, authenticator.CheckRoute(anonymous, types.RESTProtocol, types.QueryRoute, "/cosmos/staking/v1beta1/validators"), middleware.ErrRouteNotPermitted)
+	assert.ErrorIs(t, authenticator.CheckRoute(anonymous, types.RESTProtocol, types.BroadcastRoute, "/cosmos/tx/v1beta1/txs"), middleware.ErrRouteNotPermitted)
+	assert.NoError(t, authenticator.CheckRoute(anonymous, types.GRPCProtocol, types.QueryRoute, "/cosmos.bank.v1beta1.Query/Balance"))
+
+	_, err = authenticator.Authenticate("unknown", "1.2.3.4")
+	assert.ErrorIs(t, err, middleware.ErrInvalidAPIKey)
+
+	// the tier rules apply to the key, the rate limit rules are disabled
+	limiter := middleware.NewRateLimiter(config.RateLimit{}, cfg.Tiers, nil)
+	for i := 0; i < 5; i++ {
+		ok, _ := limiter.Allow(identity, types.RESTProtocol, types.QueryRoute, 1)
+		assert.True(t, ok)
+	}
+	ok, _ := limiter.Allow(identity, types.RESTProtocol, types.QueryRoute, 1)
+	assert.False(t, ok)
+	ok, _ = limiter.Allow(anonymous, types.RESTProtocol, types.QueryRoute, 100)
+	assert.True(t, ok)
+
+	writeKeys("partner-b", "secret-b", "partner")
+	require.NoError(t, authenticator.Reload())
+	_, err = authenticator.Authenticate("secret-a", "1.2.3.4")
+	assert.ErrorIs(t, err, middleware.ErrInvalidAPIKey)
+	_, err = authenticator.Authenticate("secret-b", "1.2.3.4")
+	assert.NoError(t, err)
+
+	writeKeys("partner-c", "secret-c", "unknown")
+	assert.Error(t, authenticator.Reload())
+	_, err = authenticator.Authenticate("secret-b", "1.2.3.4")
+	assert.NoError(t, err)
+}
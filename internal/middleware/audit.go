@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/gogo/protobuf/proto"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// Verdicts of the txs in the audit log.
+const (
+	AuditAdmitted = "admitted"
+	AuditRejected = "rejected"
+)
+
+// AuditRecord is a line of the audit log, describing a tx as far as it decodes.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	TxHash    string    `json:"tx_hash"`
+	Protocol  string    `json:"protocol"`
+	Route     string    `json:"route"`
+	ClientIP  string    `json:"client_ip"`
+	Signers   []string  `json:"signers"`
+	MsgTypes  []string  `json:"msg_types"`
+	Fee       string    `json:"fee"`
+	Gas       uint64    `json:"gas"`
+	Verdict   string    `json:"verdict"`
+	Rule      string    `json:"rule,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Auditor appends the audit log as JSON lines, rotating it by size and time, see config.Audit.
+type Auditor struct {
+	*jsonLog
+}
+
+func NewAuditor(cfg config.Audit) *Auditor {
+	return &Auditor{jsonLog: newJSONLog("audit", cfg.Rotation.Open(cfg.File))}
+}
+
+// Record appends a record to the audit log.
+func (a *Auditor) Record(record AuditRecord) {
+	a.append(record)
+}
+
+// AuditTxBytes records in the audit log a tx admitted, or rejected with err, under the request
+// id carried by ctx.
+func (v Validator) AuditTxBytes(ctx context.Context, protocol types.Protocol, route, client string, txBytes []byte, err error) {
+	if v.Auditor == nil {
+		return
+	}
+	record := newAuditRecord(ctx, protocol, route, client, err)
+	record.TxHash = fmt.Sprintf("%X", tmhash.Sum(txBytes))
+	txRaw := tx.TxRaw{}
+	if proto.Unmarshal(txBytes, &txRaw) == nil {
+		txBody, authInfo := tx.TxBody{}, tx.AuthInfo{}
+		if proto.Unmarshal(txRaw.BodyBytes, &txBody) != nil {
+			txBody = tx.TxBody{}
+		}
+		if proto.Unmarshal(txRaw.AuthInfoBytes, &authInfo) == nil {
+			describeTxFee(&record, authInfo)
+		} else {
+			authInfo = tx.AuthInfo{}
+		}
+		v.describeTx(&record, txBody, authInfo)
+	}
+	v.Auditor.Record(record)
+}
+
+// AuditTx records in the audit log a decoded tx admitted, or rejected with err.
+func (v Validator) AuditTx(ctx context.Context, protocol types.Protocol, route, client string, decodedTx *tx.Tx, err error) {
+	if v.Auditor == nil {
+		return
+	}
+	record := newAuditRecord(ctx, protocol, route, client, err)
+	txRaw := tx.TxRaw{Signatures: decodedTx.Signatures}
+	txBody, authInfo := tx.TxBody{}, tx.AuthInfo{}
+	if decodedTx.Body != nil {
+		txRaw.BodyBytes, _ = proto.Marshal(decodedTx.Body)
+		txBody = *decodedTx.Body
+	}
+	if decodedTx.AuthInfo != nil {
+		txRaw.AuthInfoBytes, _ = proto.Marshal(decodedTx.AuthInfo)
+		authInfo = *decodedTx.AuthInfo
+		describeTxFee(&record, authInfo)
+	}
+	v.describeTx(&record, txBody, authInfo)
+	if txBytes, err := proto.Marshal(&txRaw); err == nil {
+		record.TxHash = fmt.Sprintf("%X", tmhash.Sum(txBytes))
+	}
+	v.Auditor.Record(record)
+}
+
+// AuditEthereumRawTx records in the audit log a raw ethereum tx admitted, or rejected with
+// err. The fee is the most the tx may pay, in wei.
+func (v Validator) AuditEthereumRawTx(ctx context.Context, protocol types.Protocol, route, client string, rawTx []byte, err error) {
+	if v.Auditor == nil {
+		return
+	}
+	record := newAuditRecord(ctx, protocol, route, client, err)
+	ethTx := new(ethtypes.Transaction)
+	if ethTx.UnmarshalBinary(rawTx) == nil {
+		record.TxHash = ethTx.Hash().Hex()
+		record.MsgTypes = append(record.MsgTypes, MsgEthereumTxTypeURL)
+		if sender, err := ethereumTxSender(ethTx); err == nil {
+			record.Signers = append(record.Signers, sdk.AccAddress(sender.Bytes()).String())
+		}
+		record.Fee = new(big.Int).Mul(ethTx.GasFeeCap(), new(big.Int).SetUint64(ethTx.Gas())).String() + "wei"
+		record.Gas = ethTx.Gas()
+	}
+	v.Auditor.Record(record)
+}
+
+func newAuditRecord(ctx context.Context, protocol types.Protocol, route, client string, err error) AuditRecord {
+	record := AuditRecord{
+		Time:      time.Now().UTC(),
+		RequestID: RequestIDFromContext(ctx),
+		Protocol:  string(protocol),
+		Route:     route,
+		ClientIP:  client,
+		Signers:   []string{},
+		MsgTypes:  []string{},
+		Verdict:   AuditAdmitted,
+	}
+	if err != nil {
+		record.Verdict, record.Rule, record.Error = AuditRejected, string(CodeOf(AsRejection(CodeInvalidTx, err))), err.Error()
+	}
+	return record
+}
+
+// describeTx records the message types of a tx and its signers: the senders of its ethereum
+// txs and the addresses of its signer info public keys. The signers named by the messages are
+// not trusted, GetSigners panics on malformed addresses.
+func (v Validator) describeTx(record *AuditRecord, txBody tx.TxBody, authInfo tx.AuthInfo) {
+	for _, message := range txBody.Messages {
+		record.MsgTypes = append(record.MsgTypes, message.TypeUrl)
+	}
+	signers := make(map[string]struct{})
+	if proven, _, err := v.ProvenTxSigners(txBody); err == nil {
+		for signer := range proven {
+			signers[signer] = struct{}{}
+		}
+	}
+	if addresses, err := v.signerInfoAddresses(authInfo); err == nil {
+		for _, address := range addresses {
+			signers[address] = struct{}{}
+		}
+	}
+	for signer := range signers {
+		record.Signers = append(record.Signers, signer)
+	}
+	sort.Strings(record.Signers)
+}
+
+func describeTxFee(record *AuditRecord, authInfo tx.AuthInfo) {
+	if authInfo.Fee == nil {
+		return
+	}
+	record.Fee, record.Gas = authInfo.Fee.Amount.String(), authInfo.Fee.GasLimit
+}
@@ -0,0 +1,119 @@
+package middleware_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	cryptotypes "github.com/cosmos/cosmos-sdk/crypto/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	vestingtypes "github.com/cosmos/cosmos-sdk/x/auth/vesting/types"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+func TestAuditLog(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Audit.Enable = true
+	cfg.Audit.File = filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, cfg.Audit.ValidateBasic())
+	validator := middleware.NewValidator(cfg)
+
+	decodedTx := newTestTx(t, 2, 200000, 1)
+	decodedTx.AuthInfo.Fee.Amount = sdk.NewCoins(sdk.NewInt64Coin("FX", 4000))
+	validator.AuditTx(middleware.WithRequestID(context.Background(), "req-1"), types.GRPCProtocol, "/cosmos.tx.v1beta1.Service/Simulate", "10.0.0.1", decodedTx, nil)
+
+	bodyBytes, err := proto.Marshal(decodedTx.Body)
+	require.NoError(t, err)
+	authInfoBytes, err := proto.Marshal(decodedTx.AuthInfo)
+	require.NoError(t, err)
+	txBytes, err := proto.Marshal(&tx.TxRaw{BodyBytes: bodyBytes, AuthInfoBytes: authInfoBytes, Signatures: decodedTx.Signatures})
+	require.NoError(t, err)
+	validator.AuditTxBytes(context.Background(), types.JSONRPCProtocol, "broadcast_tx_sync", "10.0.0.2", txBytes,
+		errors.Wrapf(middleware.ErrBanned, "signer %s", "fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy"))
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0x2407900b68B18dBcf9ee9dC43110Ad422695305c")
+	ethTx, err := ethtypes.SignNewTx(key, ethtypes.LatestSignerForChainID(big.NewInt(testEVMChainID)),
+		&ethtypes.LegacyTx{GasPrice: big.NewInt(5), Gas: 21000, To: &to, Value: big.NewInt(1)})
+	require.NoError(t, err)
+	rawTx, err := ethTx.MarshalBinary()
+	require.NoError(t, err)
+	validator.AuditEthereumRawTx(context.Background(), types.EVMRPCProtocol, "eth_sendRawTransaction", "10.0.0.3", rawTx,
+		middleware.NewRejection(middleware.CodeFeeTooLow, "ethereum tx gas price is too low"))
+
+	file, err := os.Open(cfg.Audit.File)
+	require.NoError(t, err)
+	defer file.Close()
+	var records []middleware.AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record middleware.AuditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 3)
+
+	// the signers are the addresses of the signer info public keys
+	signers := []string{sdk.AccAddress(decodedTx.AuthInfo.SignerInfos[0].PublicKey.GetCachedValue().(cryptotypes.PubKey).Address()).String()}
+	msgTypes := []string{"/cosmos.bank.v1beta1.MsgSend", "/cosmos.bank.v1beta1.MsgSend"}
+	assert.Equal(t, middleware.AuditAdmitted, records[0].Verdict)
+	assert.Equal(t, "grpc", records[0].Protocol)
+	assert.Equal(t, "req-1", records[0].RequestID)
+	assert.Equal(t, signers, records[0].Signers)
+	assert.Equal(t, msgTypes, records[0].MsgTypes)
+	assert.Equal(t, "4000FX", records[0].Fee)
+	assert.Equal(t, uint64(200000), records[0].Gas)
+	assert.Empty(t, records[0].Rule)
+	// the hash of a decoded tx is the hash of its canonical encoding
+	assert.Equal(t, records[0].TxHash, records[1].TxHash)
+
+	assert.Equal(t, middleware.AuditRejected, records[1].Verdict)
+	assert.Equal(t, string(middleware.CodeBanned), records[1].Rule)
+	assert.Equal(t, "10.0.0.2", records[1].ClientIP)
+	assert.Equal(t, signers, records[1].Signers)
+
+	assert.Equal(t, ethTx.Hash().Hex(), records[2].TxHash)
+	assert.Equal(t, string(middleware.CodeFeeTooLow), records[2].Rule)
+	assert.Equal(t, "105000wei", records[2].Fee)
+	assert.Len(t, records[2].Signers, 1)
+}
+
+func TestAuditLogMalformedSigner(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Audit.Enable = true
+	cfg.Audit.File = filepath.Join(t.TempDir(), "audit.jsonl")
+	validator := middleware.NewValidator(cfg)
+
+	// GetSigners panics on the malformed address, the audit log does not call it
+	decodedTx := newTestTx(t, 1, 200000, 1)
+	msg, err := codectypes.NewAnyWithValue(&vestingtypes.MsgCreatePeriodicVestingAccount{FromAddress: "garbage", ToAddress: "fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy"})
+	require.NoError(t, err)
+	decodedTx.Body.Messages = []*codectypes.Any{msg}
+	assert.NotPanics(t, func() {
+		validator.AuditTx(context.Background(), types.GRPCProtocol, "/cosmos.tx.v1beta1.Service/Simulate", "10.0.0.1", decodedTx, nil)
+	})
+
+	bz, err := os.ReadFile(cfg.Audit.File)
+	require.NoError(t, err)
+	var record middleware.AuditRecord
+	require.NoError(t, json.Unmarshal(bz, &record))
+	assert.Equal(t, []string{"/cosmos.vesting.v1beta1.MsgCreatePeriodicVestingAccount"}, record.MsgTypes)
+	assert.Equal(t, []string{sdk.AccAddress(decodedTx.AuthInfo.SignerInfos[0].PublicKey.GetCachedValue().(cryptotypes.PubKey).Address()).String()}, record.Signers)
+}
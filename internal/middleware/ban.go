@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
+)
+
+// Reasons of the rejections counted towards a ban.
+const (
+	RejectInvalidTx      = "invalid tx"
+	RejectInvalidRequest = "invalid request"
+	RejectRouteDenied    = "route denied"
+	RejectInvalidAPIKey  = "invalid api key"
+	RejectRateLimited    = "rate limited"
+	RejectSignerLimited  = "signer limited"
+)
+
+// Reasons of the rejections not held against the client.
+const (
+	RejectIPDenied    = "ip denied"
+	RejectBanned      = "banned"
+	RejectProofOfWork = "proof of work"
+	RejectTooLarge    = "too large"
+	RejectOverloaded  = "overloaded"
+	RejectMempoolFull = "mempool full"
+)
+
+const (
+	banKeyIPPrefix     = "ip:"
+	banKeySignerPrefix = "signer:"
+)
+
+var ErrBanned = NewRejection(CodeBanned, "banned for repeated rejections")
+
+// Banner bans, fail2ban style, the client IPs and signers whose requests keep being
+// rejected, for a duration growing with every ban of the same offender.
+type Banner struct {
+	cfg config.Ban
+
+	mu        sync.Mutex
+	offenders map[string]*offender
+	lastSweep time.Time
+}
+
+type offender struct {
+	rejections slidingWindow
+	bans       int
+	reason     string
+	bannedAt   time.Time
+	until      time.Time
+}
+
+// Ban is a ban in effect.
+type Ban struct {
+	Key      string    `json:"key"`
+	Reason   string    `json:"reason"`
+	Bans     int       `json:"bans"`
+	BannedAt time.Time `json:"banned_at"`
+	Until    time.Time `json:"until"`
+}
+
+func NewBanner(cfg config.Ban) *Banner {
+	return &Banner{cfg: cfg, offenders: make(map[string]*offender), lastSweep: time.Now()}
+}
+
+// IPBanKey returns the ban key of a client IP.
+func IPBanKey(ip string) string {
+	return banKeyIPPrefix + ip
+}
+
+// SignerBanKey returns the ban key of the bech32 address of a signer.
+func SignerBanKey(address string) string {
+	return banKeySignerPrefix + address
+}
+
+// Reject counts a rejection of the offender and bans it once the threshold is crossed.
+// Rejections of a banned offender are not counted.
+func (b *Banner) Reject(ctx context.Context, key, reason string) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sweep(now)
+	o, ok := b.offenders[key]
+	if !ok {
+		o = &offender{rejections: slidingWindow{window: time.Duration(b.cfg.WindowSecond) * time.Second}}
+		b.offenders[key] = o
+	}
+	if now.Before(o.until) {
+		return
+	}
+	if o.bans > 0 && now.Sub(o.bannedAt) >= time.Duration(b.cfg.ForgetSecond)*time.Second {
+		o.bans = 0
+	}
+	o.rejections.expire(now)
+	o.rejections.events = append(o.rejections.events, now)
+	if len(o.rejections.events) < b.cfg.Threshold {
+		return
+	}
+	duration := b.duration(o.bans)
+	o.rejections.events = nil
+	o.bans++
+	o.reason = reason
+	o.bannedAt = now
+	o.until = now.Add(duration)
+	log.Ctx(ctx).Warnf("banned %s for %s after %d rejections, last rejection: %s", key, duration, b.cfg.Threshold, reason)
+}
+
+// duration returns the duration of the ban following the given number of bans.
+func (b *Banner) duration(bans int) time.Duration {
+	seconds := float64(b.cfg.BanSecond) * math.Pow(b.cfg.Multiplier, float64(bans))
+	if max := float64(b.cfg.MaxBanSecond); seconds > max {
+		seconds = max
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Banned returns the end of the ban of the offender, false when it is not banned.
+func (b *Banner) Banned(key string) (time.Time, bool) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if o, ok := b.offenders[key]; ok && now.Before(o.until) {
+		return o.until, true
+	}
+	return time.Time{}, false
+}
+
+// Bans returns the bans in effect, ordered by key.
+func (b *Banner) Bans() []Ban {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bans := make([]Ban, 0)
+	for key, o := range b.offenders {
+		if now.Before(o.until) {
+			bans = append(bans, Ban{Key: key, Reason: o.reason, Bans: o.bans, BannedAt: o.bannedAt, Until: o.until})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Key < bans[j].Key })
+	return bans
+}
+
+// Unban lifts the ban of the offender and forgets its rejections and previous bans,
+// false when it is not banned.
+func (b *Banner) Unban(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.offenders[key]
+	if !ok || !time.Now().Before(o.until) {
+		return false
+	}
+	delete(b.offenders, key)
+	log.Infof("unbanned %s", key)
+	return true
+}
+
+// sweep drops the offenders without rejections in their window whose bans are forgotten.
+func (b *Banner) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < time.Minute {
+		return
+	}
+	b.lastSweep = now
+	forget := time.Duration(b.cfg.ForgetSecond) * time.Second
+	for key, o := range b.offenders {
+		if o.rejections.expire(now); len(o.rejections.events) > 0 || now.Before(o.until) {
+			continue
+		}
+		if o.bans == 0 || now.Sub(o.bannedAt) >= forget {
+			delete(b.offenders, key)
+		}
+	}
+}
+
+// RecordRejection counts a rejected request of a client IP towards its ban.
+func (v Validator) RecordRejection(ctx context.Context, client, reason string) {
+	v.CountRejection(reason)
+	if v.Banner == nil {
+		return
+	}
+	v.Banner.Reject(ctx, IPBanKey(client), reason)
+}
+
+// CountRejection counts a rejection in the metrics without holding it against the client.
+func (v Validator) CountRejection(reason string) {
+	metrics.Rejections.WithLabelValues(reason).Inc()
+}
+
+// CheckClientBan returns the end of the ban of a client IP, false when it is not banned.
+func (v Validator) CheckClientBan(client string) (time.Time, bool) {
+	if v.Banner == nil {
+		return time.Time{}, false
+	}
+	return v.Banner.Banned(IPBanKey(client))
+}
+
+// checkSignerBans rejects a tx of a banned signer. Only signers proven by their signature
+// are banned, see ProvenTxSigners.
+func (v Validator) checkSignerBans(signers map[string][]string) error {
+	if v.Banner == nil || !v.Cfg.Ban.Signers {
+		return nil
+	}
+	for signer := range signers {
+		if until, banned := v.Banner.Banned(SignerBanKey(signer)); banned {
+			return errors.Wrapf(ErrBanned, "signer %s until %s", signer, until.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// rejectSigners counts a rejected tx towards the bans of its signers.
+func (v Validator) rejectSigners(ctx context.Context, signers map[string][]string, reason string) {
+	if v.Banner == nil || !v.Cfg.Ban.Signers {
+		return
+	}
+	for signer := range signers {
+		v.Banner.Reject(ctx, SignerBanKey(signer), reason)
+	}
+}
+
+// rejectTxBytesSigners counts a tx rejected by validation towards the bans of its proven
+// signers, as far as the tx decodes.
+func (v Validator) rejectTxBytesSigners(ctx context.Context, txBytes []byte) {
+	if v.Banner == nil || !v.Cfg.Ban.Signers {
+		return
+	}
+	if maxTxBytes := v.Cfg.Chain.MaximumTxBytes; maxTxBytes > 0 && len(txBytes) > maxTxBytes {
+		return
+	}
+	txRaw := tx.TxRaw{}
+	if err := proto.Unmarshal(txBytes, &txRaw); err != nil {
+		return
+	}
+	txBody := tx.TxBody{}
+	if err := proto.Unmarshal(txRaw.BodyBytes, &txBody); err != nil {
+		return
+	}
+	signers, _, err := v.ProvenTxSigners(txBody)
+	if err != nil {
+		return
+	}
+	v.rejectSigners(ctx, signers, RejectInvalidTx)
+}
+
+// rejectEthereumRawTxSender counts a raw ethereum tx rejected by validation towards the
+// ban of its sender, as far as the tx decodes.
+func (v Validator) rejectEthereumRawTxSender(ctx context.Context, rawTx []byte) {
+	if v.Banner == nil || !v.Cfg.Ban.Signers {
+		return
+	}
+	ethTx := new(ethtypes.Transaction)
+	if err := ethTx.UnmarshalBinary(rawTx); err != nil {
+		return
+	}
+	sender, err := ethereumTxSender(ethTx)
+	if err != nil {
+		return
+	}
+	v.rejectSigners(ctx, map[string][]string{sdk.AccAddress(sender.Bytes()).String(): {MsgEthereumTxTypeURL}}, RejectInvalidTx)
+}
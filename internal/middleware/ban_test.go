@@ -0,0 +1,117 @@
+package middleware_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestBanner(t *testing.T) {
+	cfg := config.DefaultConfig().Ban
+	cfg.Enable = true
+	cfg.Threshold = 3
+	cfg.BanSecond = 1
+	cfg.MaxBanSecond = 3
+	banner := middleware.NewBanner(cfg)
+	key := middleware.IPBanKey("1.2.3.4")
+
+	for i := 0; i < 2; i++ {
+		banner.Reject(context.Background(), key, middleware.RejectInvalidTx)
+	}
+	_, banned := banner.Banned(key)
+	assert.False(t, banned)
+	banner.Reject(context.Background(), key, middleware.RejectRateLimited)
+	until, banned := banner.Banned(key)
+	require.True(t, banned)
+	assert.WithinDuration(t, time.Now().Add(time.Second), until, 100*time.Millisecond)
+	bans := banner.Bans()
+	require.Len(t, bans, 1)
+	assert.Equal(t, key, bans[0].Key)
+	assert.Equal(t, middleware.RejectRateLimited, bans[0].Reason)
+	assert.Equal(t, 1, bans[0].Bans)
+
+	// the second ban lasts twice as long
+	time.Sleep(until.Sub(time.Now()) + 10*time.Millisecond)
+	_, banned = banner.Banned(key)
+	assert.False(t, banned)
+	for i := 0; i < 3; i++ {
+		banner.Reject(context.Background(), key, middleware.RejectInvalidTx)
+	}
+	until, banned = banner.Banned(key)
+	require.True(t, banned)
+	assert.WithinDuration(t, time.Now().Add(2*time.Second), until, 100*time.Millisecond)
+
+	assert.True(t, banner.Unban(key))
+	assert.False(t, banner.Unban(key))
+	assert.Empty(t, banner.Bans())
+	// the previous bans are forgotten
+	for i := 0; i < 3; i++ {
+		banner.Reject(context.Background(), key, middleware.RejectInvalidTx)
+	}
+	until, _ = banner.Banned(key)
+	assert.WithinDuration(t, time.Now().Add(time.Second), until, 100*time.Millisecond)
+}
+
+func TestSignerBan(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Chain.EVM.ChainID = testEVMChainID
+	cfg.Ban.Enable = true
+	cfg.Ban.Threshold = 2
+	cfg.Ban.Signers = true
+	validator := middleware.NewValidator(cfg)
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0x2407900b68B18dBcf9ee9dC43110Ad422695305c")
+	signer := ethtypes.LatestSignerForChainID(big.NewInt(testEVMChainID))
+	rawTx := func(gas uint64) []byte {
+		ethTx, err := ethtypes.SignNewTx(key, signer, &ethtypes.LegacyTx{GasPrice: big.NewInt(500000000000), Gas: gas, To: &to, Value: big.NewInt(1)})
+		require.NoError(t, err)
+		bz, err := ethTx.MarshalBinary()
+		require.NoError(t, err)
+		return bz
+	}
+	require.NoError(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx(21000)))
+	for i := 0; i < 2; i++ {
+		assert.Error(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx(1000)))
+	}
+	assert.ErrorIs(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx(21000)), middleware.ErrBanned)
+	bans := validator.Banner.Bans()
+	require.Len(t, bans, 1)
+	assert.Equal(t, middleware.RejectInvalidTx, bans[0].Reason)
+
+	// client IPs are banned on the rejections recorded by the handlers
+	for i := 0; i < 2; i++ {
+		validator.RecordRejection(context.Background(), "1.2.3.4", middleware.RejectRouteDenied)
+	}
+	_, banned := validator.CheckClientBan("1.2.3.4")
+	assert.True(t, banned)
+	_, banned = validator.CheckClientBan("1.2.3.5")
+	assert.False(t, banned)
+}
+
+func TestSignerBanUnprovenSigners(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Ban.Enable = true
+	cfg.Ban.Threshold = 2
+	cfg.Ban.Signers = true
+	cfg.Chain.MinimumFee = "1FX"
+	validator := middleware.NewValidator(cfg)
+
+	// the signers named by cosmos messages are not proven, their rejected txs ban nobody
+	txBytes := newTestTxBytes(t, newTestTx(t, 1, 200000, 1))
+	for i := 0; i < 3; i++ {
+		assert.Error(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.1", txBytes))
+	}
+	assert.Empty(t, validator.Banner.Bans())
+}
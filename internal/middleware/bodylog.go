@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// Redacted replaces the value of a redacted field in a logged body.
+const Redacted = "[REDACTED]"
+
+// BodyLogger resolves the body log mode of the routes and renders the bodies logged, see config.BodyLog.
+type BodyLogger struct {
+	cfg        config.BodyLog
+	routers    *Routers
+	cdc        *codec.ProtoCodec
+	redact     map[string]bool
+	routes     map[types.Protocol]map[string]string
+	restRoutes []restRouteBodyLog
+}
+
+type restRouteBodyLog struct {
+	pattern types.PathPattern
+	mode    string
+}
+
+func NewBodyLogger(cfg config.BodyLog, routers *Routers) *BodyLogger {
+	bodyLogger := &BodyLogger{
+		cfg:     cfg,
+		routers: routers,
+		cdc:     codec.NewProtoCodec(routers.InterfaceRegistry()),
+		redact:  make(map[string]bool, len(cfg.RedactFields)),
+		routes:  make(map[types.Protocol]map[string]string),
+	}
+	for _, field := range cfg.RedactFields {
+		bodyLogger.redact[field] = true
+	}
+	for _, route := range cfg.Routes {
+		protocol := types.Protocol(route.Protocol)
+		if protocol == types.RESTProtocol {
+			bodyLogger.restRoutes = append(bodyLogger.restRoutes, restRouteBodyLog{pattern: types.NewPathPattern(route.Route), mode: route.Mode})
+			continue
+		}
+		if bodyLogger.routes[protocol] == nil {
+			bodyLogger.routes[protocol] = make(map[string]string)
+		}
+		bodyLogger.routes[protocol][route.Route] = route.Mode
+	}
+	return bodyLogger
+}
+
+// Mode returns the body log mode of a request calling routes, the mode of the first route
+// overriding it or the configured mode.
+func (b *BodyLogger) Mode(protocol types.Protocol, routes []string) string {
+	for _, route := range routes {
+		if protocol == types.RESTProtocol {
+			for _, restRoute := range b.restRoutes {
+				if restRoute.pattern.Match(route) {
+					return restRoute.mode
+				}
+			}
+			continue
+		}
+		if mode, ok := b.routes[protocol][route]; ok {
+			return mode
+		}
+	}
+	return b.cfg.Mode
+}
+
+// Sample reports whether a body is logged in the sampled mode.
+func (b *BodyLogger) Sample() bool {
+	return rand.Float64() < b.cfg.SampleRatio
+}
+
+// Render renders a body for the log: a JSON body, or a gRPC body of a known method, as JSON
+// with the txs it carries decoded and the fields redacted. Any other body is rendered in
+// base64 without fields to redact, and by its size and hash otherwise, as its fields could
+// not be redacted.
+func (b *BodyLogger) Render(protocol types.Protocol, routes []string, body []byte) string {
+	rendered, ok := b.renderJSON(protocol, routes, body)
+	if !ok {
+		if len(b.redact) > 0 {
+			return fmt.Sprintf("[UNRENDERED %d bytes, sha256 %x]", len(body), sha256.Sum256(body))
+		}
+		rendered = base64.StdEncoding.EncodeToString(body)
+	}
+	if b.cfg.MaxBytes > 0 && len(rendered) > b.cfg.MaxBytes {
+		return fmt.Sprintf("%s... (%d bytes truncated)", rendered[:b.cfg.MaxBytes], len(rendered)-b.cfg.MaxBytes)
+	}
+	return rendered
+}
+
+func (b *BodyLogger) renderJSON(protocol types.Protocol, routes []string, body []byte) (string, bool) {
+	if protocol == types.GRPCProtocol {
+		if len(routes) != 1 {
+			return "", false
+		}
+		msg, ok := b.routers.NewGRPCRequest(routes[0])
+		if !ok || proto.Unmarshal(body, msg) != nil {
+			return "", false
+		}
+		var err error
+		if body, err = b.cdc.MarshalJSON(msg); err != nil {
+			return "", false
+		}
+	}
+	value, ok := decodeJSON(body)
+	if !ok {
+		return "", false
+	}
+	rendered, err := json.Marshal(b.redactFields(b.decodeTxs(value)))
+	if err != nil {
+		return "", false
+	}
+	return string(rendered), true
+}
+
+// decodeTxs replaces the txs carried by a JSON body by their JSON rendering: the tx_bytes of
+// the cosmos-sdk requests, the tx param of the tendermint broadcast methods and the raw tx of
+// eth_sendRawTransaction. A tx which does not decode is kept as it is.
+func (b *BodyLogger) decodeTxs(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		method, _ := value["method"].(string)
+		for key, field := range value {
+			switch {
+			case key == "tx_bytes":
+				value[key] = b.decodeTx(field)
+			case key == "params" && (strings.HasPrefix(method, "broadcast_tx_") || method == "check_tx"):
+				value[key] = b.decodeTxParams(field, b.decodeTx)
+			case key == "params" && method == "eth_sendRawTransaction":
+				value[key] = b.decodeTxParams(field, decodeEthereumTx)
+			default:
+				value[key] = b.decodeTxs(field)
+			}
+		}
+	case []interface{}:
+		for i, element := range value {
+			value[i] = b.decodeTxs(element)
+		}
+	}
+	return value
+}
+
+func (b *BodyLogger) decodeTxParams(params interface{}, decode func(interface{}) interface{}) interface{} {
+	switch params := params.(type) {
+	case map[string]interface{}:
+		if txParam, ok := params["tx"]; ok {
+			params["tx"] = decode(txParam)
+		}
+	case []interface{}:
+		if len(params) > 0 {
+			params[0] = decode(params[0])
+		}
+	}
+	return params
+}
+
+// decodeTx returns the JSON rendering of a base64 encoded tx.
+func (b *BodyLogger) decodeTx(value interface{}) interface{} {
+	encoded, ok := value.(string)
+	if !ok {
+		return value
+	}
+	txBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return value
+	}
+	txRaw := tx.TxRaw{}
+	if proto.Unmarshal(txBytes, &txRaw) != nil {
+		return value
+	}
+	decodedTx := tx.Tx{Body: &tx.TxBody{}, AuthInfo: &tx.AuthInfo{}, Signatures: txRaw.Signatures}
+	if proto.Unmarshal(txRaw.BodyBytes, decodedTx.Body) != nil || proto.Unmarshal(txRaw.AuthInfoBytes, decodedTx.AuthInfo) != nil {
+		return value
+	}
+	rendered, err := b.cdc.MarshalJSON(&decodedTx)
+	if err != nil {
+		return value
+	}
+	if decoded, ok := decodeJSON(rendered); ok {
+		return decoded
+	}
+	return value
+}
+
+// decodeEthereumTx returns the JSON rendering of a hex encoded ethereum tx.
+func decodeEthereumTx(value interface{}) interface{} {
+	encoded, ok := value.(string)
+	if !ok {
+		return value
+	}
+	rawTx, err := hexutil.Decode(encoded)
+	if err != nil {
+		return value
+	}
+	ethTx := new(ethtypes.Transaction)
+	if ethTx.UnmarshalBinary(rawTx) != nil {
+		return value
+	}
+	rendered, err := ethTx.MarshalJSON()
+	if err != nil {
+		return value
+	}
+	if decoded, ok := decodeJSON(rendered); ok {
+		return decoded
+	}
+	return value
+}
+
+func (b *BodyLogger) redactFields(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if b.redact[key] {
+				value[key] = Redacted
+				continue
+			}
+			value[key] = b.redactFields(field)
+		}
+	case []interface{}:
+		for i, element := range value {
+			value[i] = b.redactFields(element)
+		}
+	}
+	return value
+}
+
+// decodeJSON decodes a JSON document keeping its numbers as they are.
+func decodeJSON(bz []byte) (interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(bz))
+	decoder.UseNumber()
+	var value interface{}
+	if decoder.Decode(&value) != nil || decoder.More() {
+		return nil, false
+	}
+	return value, true
+}
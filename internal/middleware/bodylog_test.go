@@ -0,0 +1,118 @@
+package middleware_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+func newBodyLogger(t *testing.T, cfg config.BodyLog) *middleware.BodyLogger {
+	t.Helper()
+	require.NoError(t, cfg.ValidateBasic())
+	routers, err := middleware.NewRouters(config.DefaultConfig().Chain.ChainID)
+	require.NoError(t, err)
+	return middleware.NewBodyLogger(cfg, routers)
+}
+
+func TestBodyLogMode(t *testing.T) {
+	cfg := config.DefaultConfig().BodyLog
+	cfg.Mode = config.BodyLogSampled
+	cfg.Routes = []config.RouteBodyLog{
+		{Protocol: "rest", Route: "/cosmos/tx/v1beta1/txs", Mode: config.BodyLogOnReject},
+		{Protocol: "jsonrpc", Route: "/broadcast_tx_sync", Mode: config.BodyLogFull},
+		{Protocol: "grpc", Route: "/cosmos.bank.v1beta1.Query/Balance", Mode: config.BodyLogOff},
+	}
+	bodyLogger := newBodyLogger(t, cfg)
+
+	assert.Equal(t, config.BodyLogOnReject, bodyLogger.Mode(types.RESTProtocol, []string{"/cosmos/tx/v1beta1/txs"}))
+	assert.Equal(t, config.BodyLogSampled, bodyLogger.Mode(types.RESTProtocol, []string{"/cosmos/bank/v1beta1/balances/fx1"}))
+	assert.Equal(t, config.BodyLogFull, bodyLogger.Mode(types.JSONRPCProtocol, []string{"/status", "/broadcast_tx_sync"}))
+	assert.Equal(t, config.BodyLogOff, bodyLogger.Mode(types.GRPCProtocol, []string{"/cosmos.bank.v1beta1.Query/Balance"}))
+	assert.Equal(t, config.BodyLogSampled, bodyLogger.Mode(types.EVMRPCProtocol, []string{"eth_call"}))
+
+	cfg.Routes = []config.RouteBodyLog{{Protocol: "rest", Route: "/cosmos/tx/v1beta1/txs", Mode: "always"}}
+	assert.Error(t, cfg.ValidateBasic())
+}
+
+func TestBodyLogRender(t *testing.T) {
+	cfg := config.DefaultConfig().BodyLog
+	cfg.Mode = config.BodyLogFull
+	cfg.MaxBytes = 0
+	bodyLogger := newBodyLogger(t, cfg)
+
+	decodedTx := newTestTx(t, 1, 200000, 1)
+	decodedTx.Body.Memo = "secret memo"
+	bodyBytes, err := proto.Marshal(decodedTx.Body)
+	require.NoError(t, err)
+	authInfoBytes, err := proto.Marshal(decodedTx.AuthInfo)
+	require.NoError(t, err)
+	txBytes, err := proto.Marshal(&tx.TxRaw{BodyBytes: bodyBytes, AuthInfoBytes: authInfoBytes, Signatures: decodedTx.Signatures})
+	require.NoError(t, err)
+
+	body := fmt.Sprintf(`{"tx_bytes":%q,"mode":"BROADCAST_MODE_SYNC"}`, base64.StdEncoding.EncodeToString(txBytes))
+	rendered := bodyLogger.Render(types.RESTProtocol, []string{"/cosmos/tx/v1beta1/txs"}, []byte(body))
+	assert.Contains(t, rendered, `"/cosmos.bank.v1beta1.MsgSend"`)
+	assert.Contains(t, rendered, `"gas_limit":"200000"`)
+	assert.Contains(t, rendered, `"memo":"[REDACTED]"`)
+	assert.NotContains(t, rendered, "secret memo")
+
+	grpcBody, err := proto.Marshal(&tx.BroadcastTxRequest{TxBytes: txBytes, Mode: tx.BroadcastMode_BROADCAST_MODE_SYNC})
+	require.NoError(t, err)
+	rendered = bodyLogger.Render(types.GRPCProtocol, []string{"/cosmos.tx.v1beta1.Service/BroadcastTx"}, grpcBody)
+	assert.Contains(t, rendered, `"memo":"[REDACTED]"`)
+	assert.Contains(t, rendered, `"BROADCAST_MODE_SYNC"`)
+
+	body = fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"broadcast_tx_sync","params":{"tx":%q}}`, base64.StdEncoding.EncodeToString(txBytes))
+	rendered = bodyLogger.Render(types.JSONRPCProtocol, []string{"/broadcast_tx_sync"}, []byte(body))
+	assert.Contains(t, rendered, `"/cosmos.bank.v1beta1.MsgSend"`)
+	assert.NotContains(t, rendered, "secret memo")
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0x2407900b68B18dBcf9ee9dC43110Ad422695305c")
+	ethTx, err := ethtypes.SignNewTx(key, ethtypes.LatestSignerForChainID(big.NewInt(testEVMChainID)),
+		&ethtypes.LegacyTx{GasPrice: big.NewInt(5), Gas: 21000, To: &to, Value: big.NewInt(1)})
+	require.NoError(t, err)
+	rawTx, err := ethTx.MarshalBinary()
+	require.NoError(t, err)
+	body = fmt.Sprintf(`[{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":[%q]}]`, hexutil.Encode(rawTx))
+	rendered = bodyLogger.Render(types.EVMRPCProtocol, []string{"eth_sendRawTransaction"}, []byte(body))
+	var requests []struct {
+		Params []map[string]interface{} `json:"params"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(rendered), &requests))
+	require.Len(t, requests, 1)
+	assert.Equal(t, ethTx.Hash().Hex(), requests[0].Params[0]["hash"])
+
+	// large numbers are kept as they are
+	assert.Equal(t, `{"amount":123456789012345678901234567890}`, bodyLogger.Render(types.RESTProtocol, nil, []byte(`{"amount": 123456789012345678901234567890}`)))
+	// the fields of other bodies can not be redacted, they are rendered by their size and hash
+	assert.Equal(t, fmt.Sprintf("[UNRENDERED 8 bytes, sha256 %x]", sha256.Sum256([]byte("not json"))),
+		bodyLogger.Render(types.RESTProtocol, nil, []byte("not json")))
+	assert.NotContains(t, bodyLogger.Render(types.GRPCProtocol, []string{"/cosmos.tx.v1beta1.Service/BroadcastTx"}, []byte("secret memo")), "secret memo")
+	// or in base64 without fields to redact
+	unredacted := cfg
+	unredacted.RedactFields = nil
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("not json")), newBodyLogger(t, unredacted).Render(types.RESTProtocol, nil, []byte("not json")))
+
+	cfg.MaxBytes = 16
+	rendered = newBodyLogger(t, cfg).Render(types.RESTProtocol, nil, []byte(`{"key":"`+strings.Repeat("v", 32)+`"}`))
+	assert.Equal(t, `{"key":"vvvvvvvv... (26 bytes truncated)`, rendered)
+}
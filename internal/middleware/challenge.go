@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	cryptotypes "github.com/cosmos/cosmos-sdk/crypto/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+)
+
+// ADR036MsgSignDataType is the amino type of the ADR-036 off-chain message.
+const ADR036MsgSignDataType = "sign/MsgSignData"
+
+var (
+	ErrInvalidChallenge  = NewRejection(CodeUnauthenticated, "invalid or expired challenge")
+	ErrTooManyChallenges = NewRejection(CodeRateLimited, "too many outstanding challenges")
+)
+
+// Challenger authenticates chain addresses by a challenge signed as an ADR-036 message
+// and issues the tokens granting the challenge tier to them.
+type Challenger struct {
+	cfg config.ChallengeAuth
+	cdc codec.JSONCodec
+
+	mu         sync.Mutex
+	challenges map[string]addressExpiry // by challenge
+	pending    map[string]int           // outstanding challenges by address
+	tokens     map[string]addressExpiry // by token hash
+	addresses  map[string]string        // token hash by address
+	lastSweep  time.Time
+}
+
+type addressExpiry struct {
+	address   string
+	expiresAt time.Time
+}
+
+// NewChallenger decodes public keys with the application's interface registry, so that
+// the key types of the chain, e.g. eth_secp256k1, are supported.
+func NewChallenger(cfg config.ChallengeAuth, registry codectypes.InterfaceRegistry) *Challenger {
+	return &Challenger{
+		cfg:        cfg,
+		cdc:        codec.NewProtoCodec(registry),
+		challenges: make(map[string]addressExpiry),
+		pending:    make(map[string]int),
+		tokens:     make(map[string]addressExpiry),
+		addresses:  make(map[string]string),
+		lastSweep:  time.Now(),
+	}
+}
+
+// NewChallenge returns a one-time challenge for the address, an account address of the
+// chain, to sign. The outstanding challenges are capped in total and per address.
+func (c *Challenger) NewChallenge(address string) (string, time.Time, error) {
+	if _, err := accountAddressBytes(address); err != nil {
+		return "", time.Time{}, err
+	}
+	nonce, err := randomHex()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(time.Duration(c.cfg.ChallengeSecond) * time.Second)
+	challenge := fmt.Sprintf("cosmos-firewall authentication\naddress: %s\nnonce: %s\nexpires: %s",
+		address, nonce, expiresAt.UTC().Format(time.RFC3339))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	if len(c.challenges) >= c.cfg.MaxChallenges || c.pending[address] >= c.cfg.MaxChallengesPerAddress {
+		// the expired challenges may still be counted until the next sweep
+		c.sweepChallenges(time.Now())
+	}
+	if len(c.challenges) >= c.cfg.MaxChallenges {
+		return "", time.Time{}, ErrTooManyChallenges
+	}
+	if c.pending[address] >= c.cfg.MaxChallengesPerAddress {
+		return "", time.Time{}, errors.Wrapf(ErrTooManyChallenges, "address %s", address)
+	}
+	c.challenges[challenge] = addressExpiry{address: address, expiresAt: expiresAt}
+	c.pending[address]++
+	return challenge, expiresAt, nil
+}
+
+// IssueToken verifies the ADR-036 signature of the challenge by the key of the address and
+// returns a token, which replaces the previous token of the address. pubKey is the proto JSON
+// of the key, e.g. {"@type":"/cosmos.crypto.secp256k1.PubKey","key":"..."}. A challenge is
+// answered once.
+func (c *Challenger) IssueToken(address, challenge string, pubKey json.RawMessage, signature []byte) (string, time.Time, error) {
+	c.mu.Lock()
+	issued, ok := c.challenges[challenge]
+	if ok {
+		c.deleteChallenge(challenge, issued)
+	}
+	c.mu.Unlock()
+	if !ok || issued.address != address || time.Now().After(issued.expiresAt) {
+		return "", time.Time{}, ErrInvalidChallenge
+	}
+
+	var key cryptotypes.PubKey
+	if err := c.cdc.UnmarshalInterfaceJSON(pubKey, &key); err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "unmarshal public key")
+	}
+	addressBytes, err := accountAddressBytes(address)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if !bytes.Equal(key.Address(), addressBytes) {
+		return "", time.Time{}, errors.New("public key does not match the address")
+	}
+	if !key.VerifySignature(ADR036SignBytes(address, []byte(challenge)), signature) {
+		return "", time.Time{}, errors.New("invalid signature")
+	}
+
+	token, err := randomHex()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(time.Duration(c.cfg.TokenSecond) * time.Second)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	if previous, ok := c.addresses[address]; ok {
+		delete(c.tokens, previous)
+	}
+	tokenHash := HashAPIKey(token)
+	c.tokens[tokenHash] = addressExpiry{address: address, expiresAt: expiresAt}
+	c.addresses[address] = tokenHash
+	return token, expiresAt, nil
+}
+
+// Address returns the address a token was issued to.
+func (c *Challenger) Address(token string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	issued, ok := c.tokens[HashAPIKey(token)]
+	if !ok || time.Now().After(issued.expiresAt) {
+		return "", false
+	}
+	return issued.address, true
+}
+
+// ADR036SignBytes returns the amino JSON sign bytes of an ADR-036 message signing data,
+// as produced by wallets signing arbitrary data, e.g. Keplr's signArbitrary.
+func ADR036SignBytes(signer string, data []byte) []byte {
+	signDoc := map[string]interface{}{
+		"account_number": "0",
+		"chain_id":       "",
+		"fee":            map[string]interface{}{"amount": []interface{}{}, "gas": "0"},
+		"memo":           "",
+		"msgs": []interface{}{map[string]interface{}{
+			"type":  ADR036MsgSignDataType,
+			"value": map[string]interface{}{"data": base64.StdEncoding.EncodeToString(data), "signer": signer},
+		}},
+		"sequence": "0",
+	}
+	bz, err := json.Marshal(signDoc)
+	if err != nil {
+		panic(err)
+	}
+	return sdk.MustSortJSON(bz)
+}
+
+// accountAddressBytes decodes a bech32 account address of the chain.
+func accountAddressBytes(address string) ([]byte, error) {
+	hrp, addressBytes, err := bech32.DecodeAndConvert(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid address")
+	}
+	if prefix := sdk.GetConfig().GetBech32AccountAddrPrefix(); hrp != prefix {
+		return nil, errors.Errorf("invalid address prefix %s, expected %s", hrp, prefix)
+	}
+	return addressBytes, nil
+}
+
+// deleteChallenge drops a challenge, answered or expired.
+func (c *Challenger) deleteChallenge(challenge string, issued addressExpiry) {
+	delete(c.challenges, challenge)
+	if c.pending[issued.address]--; c.pending[issued.address] <= 0 {
+		delete(c.pending, issued.address)
+	}
+}
+
+// sweepChallenges drops the expired challenges.
+func (c *Challenger) sweepChallenges(now time.Time) {
+	for challenge, issued := range c.challenges {
+		if now.After(issued.expiresAt) {
+			c.deleteChallenge(challenge, issued)
+		}
+	}
+}
+
+// sweep drops expired challenges and tokens.
+func (c *Challenger) sweep() {
+	now := time.Now()
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+	c.sweepChallenges(now)
+	for tokenHash, issued := range c.tokens {
+		if now.After(issued.expiresAt) {
+			delete(c.tokens, tokenHash)
+			delete(c.addresses, issued.address)
+		}
+	}
+}
+
+func randomHex() (string, error) {
+	bz := make([]byte, 32)
+	if _, err := rand.Read(bz); err != nil {
+		return "", errors.Wrapf(err, "read random bytes")
+	}
+	return hex.EncodeToString(bz), nil
+}
@@ -0,0 +1,118 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestChallenger(t *testing.T) {
+	registry := middleware.NewValidator(config.DefaultConfig()).Routers.InterfaceRegistry()
+	cfg := config.DefaultConfig().Auth.Challenge
+	cfg.Enable = true
+	challenger := middleware.NewChallenger(cfg, registry)
+
+	privKey := secp256k1.GenPrivKey()
+	address, err := bech32.ConvertAndEncode("fx", privKey.PubKey().Address())
+	require.NoError(t, err)
+	pubKey, err := codec.NewProtoCodec(registry).MarshalInterfaceJSON(privKey.PubKey())
+	require.NoError(t, err)
+
+	_, _, err = challenger.NewChallenge("fx1invalid")
+	assert.Error(t, err)
+	// the account addresses of other chains are not authenticated
+	otherChainAddress, err := bech32.ConvertAndEncode("cosmos", privKey.PubKey().Address())
+	require.NoError(t, err)
+	_, _, err = challenger.NewChallenge(otherChainAddress)
+	assert.ErrorContains(t, err, "invalid address prefix cosmos")
+
+	challenge, _, err := challenger.NewChallenge(address)
+	require.NoError(t, err)
+	signature, err := privKey.Sign(middleware.ADR036SignBytes(address, []byte(challenge)))
+	require.NoError(t, err)
+
+	otherKey := secp256k1.GenPrivKey()
+	otherPubKey, err := codec.NewProtoCodec(registry).MarshalInterfaceJSON(otherKey.PubKey())
+	require.NoError(t, err)
+	_, _, err = challenger.IssueToken(address, challenge, otherPubKey, signature)
+	assert.ErrorContains(t, err, "does not match")
+	// a challenge is answered once
+	_, _, err = challenger.IssueToken(address, challenge, pubKey, signature)
+	assert.ErrorIs(t, err, middleware.ErrInvalidChallenge)
+
+	challenge, _, err = challenger.NewChallenge(address)
+	require.NoError(t, err)
+	_, _, err = challenger.IssueToken(address, challenge, pubKey, signature)
+	assert.ErrorContains(t, err, "invalid signature")
+
+	challenge, _, err = challenger.NewChallenge(address)
+	require.NoError(t, err)
+	signature, err = privKey.Sign(middleware.ADR036SignBytes(address, []byte(challenge)))
+	require.NoError(t, err)
+	token, _, err := challenger.IssueToken(address, challenge, pubKey, signature)
+	require.NoError(t, err)
+	tokenAddress, ok := challenger.Address(token)
+	assert.True(t, ok)
+	assert.Equal(t, address, tokenAddress)
+	_, ok = challenger.Address("unknown")
+	assert.False(t, ok)
+
+	// a new token replaces the previous token of the address
+	challenge, _, err = challenger.NewChallenge(address)
+	require.NoError(t, err)
+	signature, err = privKey.Sign(middleware.ADR036SignBytes(address, []byte(challenge)))
+	require.NoError(t, err)
+	newToken, _, err := challenger.IssueToken(address, challenge, pubKey, signature)
+	require.NoError(t, err)
+	_, ok = challenger.Address(token)
+	assert.False(t, ok)
+	tokenAddress, ok = challenger.Address(newToken)
+	assert.True(t, ok)
+	assert.Equal(t, address, tokenAddress)
+}
+
+func TestADR036SignBytes(t *testing.T) {
+	assert.Equal(t,
+		`{"account_number":"0","chain_id":"","fee":{"amount":[],"gas":"0"},"memo":"","msgs":[{"type":"sign/MsgSignData","value":{"data":"aGVsbG8=","signer":"fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy"}}],"sequence":"0"}`,
+		string(middleware.ADR036SignBytes("fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy", []byte("hello"))))
+}
+
+func TestChallengerMaxChallenges(t *testing.T) {
+	registry := middleware.NewValidator(config.DefaultConfig()).Routers.InterfaceRegistry()
+	cfg := config.DefaultConfig().Auth.Challenge
+	cfg.Enable = true
+	cfg.MaxChallenges = 3
+	cfg.MaxChallengesPerAddress = 2
+	challenger := middleware.NewChallenger(cfg, registry)
+
+	addresses := make([]string, 3)
+	for i := range addresses {
+		address, err := bech32.ConvertAndEncode("fx", secp256k1.GenPrivKey().PubKey().Address())
+		require.NoError(t, err)
+		addresses[i] = address
+	}
+	challenge, _, err := challenger.NewChallenge(addresses[0])
+	require.NoError(t, err)
+	_, _, err = challenger.NewChallenge(addresses[0])
+	require.NoError(t, err)
+	_, _, err = challenger.NewChallenge(addresses[0])
+	assert.ErrorIs(t, err, middleware.ErrTooManyChallenges)
+
+	_, _, err = challenger.NewChallenge(addresses[1])
+	require.NoError(t, err)
+	_, _, err = challenger.NewChallenge(addresses[2])
+	assert.ErrorIs(t, err, middleware.ErrTooManyChallenges)
+
+	// an answered challenge, even wrongly, frees its slot
+	_, _, err = challenger.IssueToken(addresses[0], challenge, nil, nil)
+	assert.Error(t, err)
+	_, _, err = challenger.NewChallenge(addresses[2])
+	assert.NoError(t, err)
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// HTTPClientIP returns the IP of the client of an HTTP request, honouring
+// X-Forwarded-For and X-Real-IP only when the peer is a trusted proxy.
+func HTTPClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	return clientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"), r.Header.Get("X-Real-IP"), trustedProxies)
+}
+
+// GRPCClientIP returns the IP of the client of a gRPC call, honouring the
+// x-forwarded-for and x-real-ip metadata only when the peer is a trusted proxy.
+func GRPCClientIP(ctx context.Context, trustedProxies []*net.IPNet) string {
+	var remoteAddr, realIP string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-real-ip"); len(values) > 0 {
+		realIP = values[0]
+	}
+	return clientIP(remoteAddr, md.Get("x-forwarded-for"), realIP, trustedProxies)
+}
+
+func clientIP(remoteAddr string, forwardedFor []string, realIP string, trustedProxies []*net.IPNet) string {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrusted(ip, trustedProxies) {
+		return ip
+	}
+	// walk X-Forwarded-For from the nearest hop, the first untrusted hop is the client
+	var hops []string
+	for _, value := range forwardedFor {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		ip = hops[i]
+		if !isTrusted(ip, trustedProxies) {
+			return ip
+		}
+	}
+	if len(hops) == 0 && net.ParseIP(strings.TrimSpace(realIP)) != nil {
+		return strings.TrimSpace(realIP)
+	}
+	return ip
+}
+
+func isTrusted(ip string, networks []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && containsIP(networks, parsed)
+}
@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+var ErrOverloaded = NewRejection(CodeOverloaded, "upstream overloaded")
+
+// latencyDecay is the weight of the latest request in the average latency of an upstream.
+const latencyDecay = 0.1
+
+// ConcurrencyLimiter bounds the requests in flight to each upstream node, in total and per
+// route class, and sheds the load of an upstream cheapest to retry first, see config.Concurrency.
+type ConcurrencyLimiter struct {
+	cfg config.Concurrency
+
+	mu        sync.Mutex
+	upstreams map[string]*upstreamLoad
+}
+
+type upstreamLoad struct {
+	inFlight int
+	classes  map[types.RouteClass]int
+	// health is the health checks in flight in the reserved slots
+	health int
+	queued int
+	// latency is the moving average of the request latency in seconds
+	latency float64
+	// released is closed, and replaced, when a request releases its slot
+	released chan struct{}
+}
+
+// UpstreamLoad is the load of an upstream node.
+type UpstreamLoad struct {
+	Upstream string                   `json:"upstream"`
+	InFlight int                      `json:"in_flight"`
+	Classes  map[types.RouteClass]int `json:"classes"`
+	Queued   int                      `json:"queued"`
+	Latency  time.Duration            `json:"latency"`
+}
+
+func NewConcurrencyLimiter(cfg config.Concurrency) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{cfg: cfg, upstreams: make(map[string]*upstreamLoad)}
+}
+
+// Acquire takes an in-flight slot of the upstream for a request of the route class and
+// returns the function releasing it. A request over a bound waits in the queue unless it is
+// shed. Health checks take one of the slots reserved for them, and are admitted like the
+// other requests of their class once these are taken.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, upstream string, class types.RouteClass, health bool) (func(), error) {
+	l.mu.Lock()
+	load, ok := l.upstreams[upstream]
+	if !ok {
+		load = &upstreamLoad{classes: make(map[types.RouteClass]int), released: make(chan struct{})}
+		l.upstreams[upstream] = load
+	}
+	if health && load.health < l.cfg.HealthReserved {
+		defer l.mu.Unlock()
+		return l.take(load, class, true), nil
+	}
+	if l.admit(load, class) {
+		defer l.mu.Unlock()
+		return l.take(load, class, false), nil
+	}
+	if l.shed(load, class) || load.queued >= l.cfg.QueueSize {
+		l.mu.Unlock()
+		return nil, ErrOverloaded
+	}
+	load.queued++
+	timer := time.NewTimer(time.Duration(l.cfg.QueueTimeoutMillis) * time.Millisecond)
+	defer timer.Stop()
+	for {
+		released := load.released
+		l.mu.Unlock()
+		var err error
+		select {
+		case <-released:
+		case <-timer.C:
+			err = ErrOverloaded
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		l.mu.Lock()
+		if err != nil {
+			load.queued--
+			l.mu.Unlock()
+			return nil, err
+		}
+		if l.admit(load, class) {
+			load.queued--
+			defer l.mu.Unlock()
+			return l.take(load, class, false), nil
+		}
+	}
+}
+
+// Loads returns the load of the upstreams.
+func (l *ConcurrencyLimiter) Loads() []UpstreamLoad {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	loads := make([]UpstreamLoad, 0, len(l.upstreams))
+	for upstream, load := range l.upstreams {
+		classes := make(map[types.RouteClass]int, len(load.classes))
+		for class, n := range load.classes {
+			classes[class] = n
+		}
+		loads = append(loads, UpstreamLoad{
+			Upstream: upstream,
+			InFlight: load.inFlight,
+			Classes:  classes,
+			Queued:   load.queued,
+			Latency:  time.Duration(load.latency * float64(time.Second)),
+		})
+	}
+	return loads
+}
+
+func (l *ConcurrencyLimiter) admit(load *upstreamLoad, class types.RouteClass) bool {
+	if limit := l.cfg.ClassMaxInFlight[string(class)]; limit > 0 && load.classes[class] >= limit {
+		return false
+	}
+	return load.inFlight < l.threshold(load, class)
+}
+
+// shed reports whether a request is rejected without waiting in the queue, only queries over
+// their threshold are, as they are the cheapest to retry.
+func (l *ConcurrencyLimiter) shed(load *upstreamLoad, class types.RouteClass) bool {
+	return class == types.QueryRoute && load.inFlight >= l.threshold(load, class)
+}
+
+// threshold returns the requests in flight to the upstream over which a request of the route
+// class is not admitted.
+func (l *ConcurrencyLimiter) threshold(load *upstreamLoad, class types.RouteClass) int {
+	maxInFlight := float64(l.cfg.MaxInFlight)
+	switch class {
+	case types.BroadcastRoute:
+		return l.cfg.MaxInFlight
+	case types.SimulateRoute:
+		return int(math.Max(1, maxInFlight*(1+l.cfg.ShedRatio)/2))
+	}
+	threshold := maxInFlight * l.cfg.ShedRatio
+	if target := float64(l.cfg.TargetLatencyMillis) / 1000; target > 0 && load.latency > target {
+		threshold *= target / load.latency
+	}
+	return int(math.Max(1, threshold))
+}
+
+// take takes a slot of the upstream, one reserved for health checks when reserved is set.
+func (l *ConcurrencyLimiter) take(load *upstreamLoad, class types.RouteClass, reserved bool) func() {
+	load.inFlight++
+	load.classes[class]++
+	if reserved {
+		load.health++
+	}
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			latency := time.Since(start).Seconds()
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			load.inFlight--
+			load.classes[class]--
+			if reserved {
+				load.health--
+			}
+			if load.latency == 0 {
+				load.latency = latency
+			} else {
+				load.latency += latencyDecay * (latency - load.latency)
+			}
+			close(load.released)
+			load.released = make(chan struct{})
+		})
+	}
+}
+
+// AcquireUpstream takes an in-flight slot of the upstream for a request of the route class,
+// a no-op without concurrency limits.
+func (v Validator) AcquireUpstream(ctx context.Context, upstream string, class types.RouteClass, health bool) (func(), error) {
+	if v.Concurrency == nil {
+		return func() {}, nil
+	}
+	return v.Concurrency.Acquire(ctx, upstream, class, health)
+}
@@ -0,0 +1,110 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	cfg := config.DefaultConfig().Concurrency
+	cfg.Enable = true
+	cfg.MaxInFlight = 4
+	cfg.ClassMaxInFlight = map[string]int{string(types.SimulateRoute): 1}
+	cfg.QueueSize = 1
+	cfg.QueueTimeoutMillis = 50
+	cfg.ShedRatio = 0.5
+	cfg.TargetLatencyMillis = 0
+	cfg.HealthReserved = 1
+	limiter := middleware.NewConcurrencyLimiter(cfg)
+	ctx := context.Background()
+	upstream := "http://127.0.0.1:26657"
+
+	// queries are shed once the upstream is half full
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := limiter.Acquire(ctx, upstream, types.QueryRoute, false)
+		require.NoError(t, err)
+		releases = append(releases, release)
+	}
+	_, err := limiter.Acquire(ctx, upstream, types.QueryRoute, false)
+	assert.ErrorIs(t, err, middleware.ErrOverloaded)
+	// other upstreams are not affected
+	release, err := limiter.Acquire(ctx, "http://127.0.0.1:1317", types.QueryRoute, false)
+	require.NoError(t, err)
+	release()
+
+	// simulations are limited by their route class, then wait in the queue
+	release, err = limiter.Acquire(ctx, upstream, types.SimulateRoute, false)
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = limiter.Acquire(ctx, upstream, types.SimulateRoute, false)
+	assert.ErrorIs(t, err, middleware.ErrOverloaded)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	queued, err := limiter.Acquire(ctx, upstream, types.SimulateRoute, false)
+	require.NoError(t, err)
+	releases = append(releases, queued)
+
+	// broadcasts are admitted up to the maximum, health checks in their reserved slots
+	broadcast, err := limiter.Acquire(ctx, upstream, types.BroadcastRoute, false)
+	require.NoError(t, err)
+	releases = append(releases, broadcast)
+	_, err = limiter.Acquire(ctx, upstream, types.BroadcastRoute, false)
+	assert.ErrorIs(t, err, middleware.ErrOverloaded)
+	health, err := limiter.Acquire(ctx, upstream, types.QueryRoute, true)
+	require.NoError(t, err)
+	releases = append(releases, health)
+	_, err = limiter.Acquire(ctx, upstream, types.QueryRoute, true)
+	assert.ErrorIs(t, err, middleware.ErrOverloaded)
+
+	for _, release := range releases {
+		release()
+		// releasing twice is a no-op
+		release()
+	}
+	loads := limiter.Loads()
+	require.Len(t, loads, 2)
+	for _, load := range loads {
+		assert.Zero(t, load.InFlight)
+		assert.Zero(t, load.Queued)
+	}
+}
+
+func TestConcurrencyLimiterLatency(t *testing.T) {
+	cfg := config.DefaultConfig().Concurrency
+	cfg.Enable = true
+	cfg.MaxInFlight = 8
+	cfg.ShedRatio = 1
+	cfg.TargetLatencyMillis = 10
+	limiter := middleware.NewConcurrencyLimiter(cfg)
+	ctx := context.Background()
+	upstream := "http://127.0.0.1:26657"
+
+	// the upstream answers in 4 times the target latency, a quarter of the queries are admitted
+	release, err := limiter.Acquire(ctx, upstream, types.QueryRoute, false)
+	require.NoError(t, err)
+	time.Sleep(40 * time.Millisecond)
+	release()
+	var releases []func()
+	for {
+		release, err := limiter.Acquire(ctx, upstream, types.QueryRoute, false)
+		if err != nil {
+			break
+		}
+		releases = append(releases, release)
+	}
+	assert.LessOrEqual(t, len(releases), 2)
+	_, err = limiter.Acquire(ctx, upstream, types.BroadcastRoute, false)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"strings"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	evmtypes "github.com/evmos/ethermint/x/evm/types"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+)
+
+const (
+	MsgEthereumTxTypeURL              = "/ethermint.evm.v1.MsgEthereumTx"
+	ExtensionOptionsEthereumTxTypeURL = "/ethermint.evm.v1.ExtensionOptionsEthereumTx"
+)
+
+// evmInterfaceRegistry resolves the TxData implementations packed into MsgEthereumTx.Data.
+var evmInterfaceRegistry = func() codectypes.InterfaceRegistry {
+	registry := codectypes.NewInterfaceRegistry()
+	evmtypes.RegisterInterfaces(registry)
+	return registry
+}()
+
+// IsEthereumTx reports whether the tx body is flagged as an ethereum tx by ethermint's extension option.
+func IsEthereumTx(txBody tx.TxBody) bool {
+	for _, option := range txBody.ExtensionOptions {
+		if option.TypeUrl == ExtensionOptionsEthereumTxTypeURL {
+			return true
+		}
+	}
+	return false
+}
+
+// UnpackEthereumTxData decodes a MsgEthereumTx Any and the legacy, access list or dynamic fee tx embedded in it.
+func UnpackEthereumTxData(message *codectypes.Any) (evmtypes.TxData, error) {
+	msg := evmtypes.MsgEthereumTx{}
+	if err := proto.Unmarshal(message.Value, &msg); err != nil {
+		return nil, WrapRejection(CodeInvalidTx, err, "proto unmarshal MsgEthereumTx")
+	}
+	if msg.Data == nil {
+		return nil, NewRejection(CodeInvalidTx, "ethereum tx data is empty")
+	}
+	var txData evmtypes.TxData
+	if err := evmInterfaceRegistry.UnpackAny(msg.Data, &txData); err != nil {
+		return nil, WrapRejection(CodeInvalidTx, err, "unpack ethereum tx data")
+	}
+	return txData, nil
+}
+
+// checkEthereumTx mirrors ethermint's basic validation of the cosmos envelope of an ethereum tx:
+// the outer tx carries no signatures, signer infos, memo or timeout and only MsgEthereumTx messages.
+func (v Validator) checkEthereumTx(txRaw tx.TxRaw, txBody tx.TxBody) error {
+	if len(txRaw.Signatures) > 0 {
+		return NewRejection(CodeInvalidSignature, "ethereum tx signatures must be empty")
+	}
+	authInfo := tx.AuthInfo{}
+	if err := proto.Unmarshal(txRaw.AuthInfoBytes, &authInfo); err != nil {
+		return WrapRejection(CodeInvalidTx, err, "proto unmarshal authInfo")
+	}
+	if len(authInfo.SignerInfos) > 0 {
+		return NewRejection(CodeInvalidSignerInfo, "ethereum tx signer infos must be empty")
+	}
+	if authInfo.Fee == nil {
+		return NewRejection(CodeInvalidFee, "ethereum tx fee is empty")
+	}
+	if len(txBody.ExtensionOptions) != 1 || len(txBody.NonCriticalExtensionOptions) > 0 {
+		return NewRejection(CodeExtensionDenied, "ethereum tx must have exactly one extension option")
+	}
+	if err := v.checkExtensionOptions(txBody.ExtensionOptions, v.Cfg.Chain.AllowedExtensionOptions, v.Cfg.Chain.ExtensionOptions); err != nil {
+		return err
+	}
+	if txBody.Memo != "" || txBody.TimeoutHeight != 0 {
+		return NewRejection(CodeInvalidTx, "ethereum tx memo and timeout height must be empty")
+	}
+	if len(txBody.Messages) <= 0 {
+		return NewRejection(CodeNoMessages, "transaction message is empty")
+	}
+	if err := v.checkMessageLimits(txBody.Messages); err != nil {
+		return err
+	}
+	if !v.IsGRPCRouterAllowed(MsgEthereumTxTypeURL) {
+		return NewRejection(CodeMessageDenied, "unsupported transaction message type")
+	}
+	var gasLimit uint64
+	for _, message := range txBody.Messages {
+		if message.TypeUrl != MsgEthereumTxTypeURL {
+			return NewRejection(CodeMessageDenied, "ethereum tx only supports MsgEthereumTx messages")
+		}
+		txData, err := v.checkEthereumMsg(message)
+		if err != nil {
+			return err
+		}
+		if txData.GetGas() > math.MaxUint64-gasLimit {
+			return NewRejection(CodeGasTooHigh, "ethereum tx gas limit overflows")
+		}
+		gasLimit += txData.GetGas()
+	}
+	if authInfo.Fee.GasLimit != gasLimit {
+		return NewRejection(CodeInvalidTx, "ethereum tx gas limit mismatch")
+	}
+	return nil
+}
+
+func (v Validator) checkEthereumMsg(message *codectypes.Any) (evmtypes.TxData, error) {
+	txData, err := UnpackEthereumTxData(message)
+	if err != nil {
+		return nil, err
+	}
+	if err = txData.Validate(); err != nil {
+		return nil, WrapRejection(CodeInvalidTx, err, "invalid ethereum tx data")
+	}
+	if err = CheckEthereumTxData(txData, v.Cfg.Chain.EVM); err != nil {
+		return nil, err
+	}
+	return txData, nil
+}
+
+// CheckEthereumTxData applies the EVM policy to a decoded ethereum tx.
+func CheckEthereumTxData(txData evmtypes.TxData, evm config.EVM) error {
+	if evm.ChainID != 0 {
+		chainID := txData.GetChainID()
+		if chainID == nil || chainID.Sign() == 0 {
+			if !evm.AllowUnprotectedTxs {
+				return NewRejection(CodeReplayUnprotected, "ethereum tx is not replay-protected (EIP-155)")
+			}
+		} else if !chainID.IsUint64() || chainID.Uint64() != evm.ChainID {
+			return Rejectf(CodeChainIDMismatch, "invalid ethereum chain id, expect: %d, actual: %s", evm.ChainID, chainID.String())
+		}
+	}
+	if txData.GetGas() < evm.MinimumGasLimit {
+		return NewRejection(CodeGasTooLow, "ethereum tx gas limit is too small")
+	}
+	if evm.MaximumGasLimit > 0 && txData.GetGas() > evm.MaximumGasLimit {
+		return NewRejection(CodeGasTooHigh, "ethereum tx gas limit is too large")
+	}
+	if minGasPrice := evm.GetMinGasPrice(); minGasPrice != nil && bigLT(txData.GetGasFeeCap(), minGasPrice) {
+		return NewRejection(CodeFeeTooLow, "ethereum tx gas price is too low")
+	}
+	if minGasTipCap := evm.GetMinGasTipCap(); minGasTipCap != nil && bigLT(txData.GetGasTipCap(), minGasTipCap) {
+		return NewRejection(CodeFeeTooLow, "ethereum tx gas tip cap is too low")
+	}
+	to := txData.GetTo()
+	if to == nil {
+		if !evm.ContractCreation {
+			return NewRejection(CodeContractCreationDenied, "ethereum contract creation is not allowed")
+		}
+		return nil
+	}
+	for _, address := range evm.DeniedToAddresses {
+		if strings.EqualFold(to.Hex(), address) {
+			return NewRejection(CodeRecipientDenied, "ethereum tx recipient is denied")
+		}
+	}
+	return nil
+}
+
+// IsEVMRPCMethodAllowed reports whether an ethereum JSON-RPC method passes the configured deny and allow lists.
+// A pattern ending in "*" matches every method with that prefix, e.g. "eth_*".
+func (v Validator) IsEVMRPCMethodAllowed(method string) bool {
+	for _, pattern := range v.Cfg.EVMRPC.DeniedMethods {
+		if matchMethod(pattern, method) {
+			return false
+		}
+	}
+	for _, pattern := range v.Cfg.EVMRPC.AllowedMethods {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckEthereumRawTx decodes an RLP (legacy) or EIP-2718 typed transaction sent by eth_sendRawTransaction.
+func (v Validator) CheckEthereumRawTx(rawTx []byte) error {
+	_, err := v.checkEthereumRawTx(rawTx)
+	return err
+}
+
+// CheckBroadcastEthereumRawTx validates a raw tx sent by eth_sendRawTransaction, rejects it
+// when its sender is banned or the upstream mempools are full, and charges it to the signer
+// limits of its sender.
+func (v Validator) CheckBroadcastEthereumRawTx(ctx context.Context, rawTx []byte) error {
+	ethTx, err := v.checkEthereumRawTx(rawTx)
+	if err != nil {
+		v.rejectEthereumRawTxSender(ctx, rawTx)
+		return err
+	}
+	if v.SignerLimiter == nil && v.Banner == nil {
+		return v.checkMempool(false)
+	}
+	sender, err := ethereumTxSender(ethTx)
+	if err != nil {
+		return err
+	}
+	signers := map[string][]string{sdk.AccAddress(sender.Bytes()).String(): {MsgEthereumTxTypeURL}}
+	if err = v.checkSignerBans(signers); err != nil {
+		return err
+	}
+	if err = v.checkMempool(false); err != nil {
+		return err
+	}
+	if v.SignerLimiter == nil {
+		return nil
+	}
+	if err = v.SignerLimiter.Allow(signers); err != nil {
+		v.rejectSigners(ctx, signers, RejectSignerLimited)
+		return err
+	}
+	return nil
+}
+
+func (v Validator) checkEthereumRawTx(rawTx []byte) (*ethtypes.Transaction, error) {
+	ethTx := new(ethtypes.Transaction)
+	if err := ethTx.UnmarshalBinary(rawTx); err != nil {
+		return nil, WrapRejection(CodeInvalidTx, err, "decode ethereum raw tx")
+	}
+	txData, err := evmtypes.NewTxDataFromTx(ethTx)
+	if err != nil {
+		return nil, WrapRejection(CodeInvalidTx, err, "convert ethereum raw tx")
+	}
+	if err = txData.Validate(); err != nil {
+		return nil, WrapRejection(CodeInvalidTx, err, "invalid ethereum tx data")
+	}
+	if err = CheckEthereumTxData(txData, v.Cfg.Chain.EVM); err != nil {
+		return nil, err
+	}
+	return ethTx, nil
+}
+
+// CheckEVMLogsBlockRange limits the number of blocks scanned by a single eth_getLogs request.
+func (v Validator) CheckEVMLogsBlockRange(fromBlock, toBlock int64) error {
+	if toBlock < fromBlock {
+		return errors.New("invalid block range, fromBlock is greater than toBlock")
+	}
+	maxRange := v.Cfg.EVMRPC.MaxGetLogsBlockRange
+	if maxRange > 0 && uint64(toBlock-fromBlock) > maxRange {
+		return Rejectf(CodeQueryLimitExceeded, "block range exceeds limit %d", maxRange)
+	}
+	return nil
+}
+
+// CheckEVMCallGas limits the gas of eth_call and eth_estimateGas requests.
+func (v Validator) CheckEVMCallGas(gas uint64) error {
+	if v.Cfg.EVMRPC.MaxCallGas > 0 && gas > v.Cfg.EVMRPC.MaxCallGas {
+		return Rejectf(CodeQueryLimitExceeded, "call gas exceeds limit %d", v.Cfg.EVMRPC.MaxCallGas)
+	}
+	return nil
+}
+
+func matchMethod(pattern, method string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(method, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == method
+}
+
+func bigLT(x, y *big.Int) bool {
+	if x == nil {
+		return y.Sign() > 0
+	}
+	return x.Cmp(y) < 0
+}
@@ -0,0 +1,121 @@
+package middleware_test
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	evmtypes "github.com/evmos/ethermint/x/evm/types"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+const testEVMChainID = 530
+
+func newLegacyTx(chainID int64, gasPrice int64, gasLimit uint64, to string) *evmtypes.LegacyTx {
+	price := sdk.NewInt(gasPrice)
+	amount := sdk.NewInt(1)
+	return &evmtypes.LegacyTx{
+		GasPrice: &price,
+		GasLimit: gasLimit,
+		To:       to,
+		Amount:   &amount,
+		V:        big.NewInt(chainID*2 + 35).Bytes(),
+	}
+}
+
+func newEthereumTxBytes(t *testing.T, txData evmtypes.TxData, signatures [][]byte) []byte {
+	return newEthereumMsgsTxBytes(t, txData.GetGas(), signatures, txData)
+}
+
+func newEthereumMsgsTxBytes(t *testing.T, gasLimit uint64, signatures [][]byte, txDatas ...evmtypes.TxData) []byte {
+	msgs := make([]*codectypes.Any, 0, len(txDatas))
+	for _, txData := range txDatas {
+		data, err := evmtypes.PackTxData(txData)
+		require.NoError(t, err)
+		msg, err := codectypes.NewAnyWithValue(&evmtypes.MsgEthereumTx{Data: data})
+		require.NoError(t, err)
+		msgs = append(msgs, msg)
+	}
+	option, err := codectypes.NewAnyWithValue(&evmtypes.ExtensionOptionsEthereumTx{})
+	require.NoError(t, err)
+	bodyBytes, err := proto.Marshal(&tx.TxBody{Messages: msgs, ExtensionOptions: []*codectypes.Any{option}})
+	require.NoError(t, err)
+	authInfoBytes, err := proto.Marshal(&tx.AuthInfo{Fee: &tx.Fee{GasLimit: gasLimit}})
+	require.NoError(t, err)
+	txBytes, err := proto.Marshal(&tx.TxRaw{BodyBytes: bodyBytes, AuthInfoBytes: authInfoBytes, Signatures: signatures})
+	require.NoError(t, err)
+	return txBytes
+}
+
+func TestCheckEthereumTxData(t *testing.T) {
+	to := "0x2407900b68B18dBcf9ee9dC43110Ad422695305c"
+	evm := config.DefaultConfig().Chain.EVM
+	evm.ChainID = testEVMChainID
+	evm.MinimumGasPrice = "500000000000"
+	evm.DeniedToAddresses = []string{"0x0000000000000000000000000000000000001004"}
+
+	assert.NoError(t, middleware.CheckEthereumTxData(newLegacyTx(testEVMChainID, 500000000000, 21000, to), evm))
+	assert.Error(t, middleware.CheckEthereumTxData(newLegacyTx(1, 500000000000, 21000, to), evm))
+	assert.Error(t, middleware.CheckEthereumTxData(newLegacyTx(testEVMChainID, 500000000000, 20000, to), evm))
+	assert.Error(t, middleware.CheckEthereumTxData(newLegacyTx(testEVMChainID, 1, 21000, to), evm))
+	assert.Error(t, middleware.CheckEthereumTxData(newLegacyTx(testEVMChainID, 500000000000, 21000, "0x0000000000000000000000000000000000001004"), evm))
+
+	unprotected := newLegacyTx(testEVMChainID, 500000000000, 21000, to)
+	unprotected.V = big.NewInt(27).Bytes()
+	assert.Error(t, middleware.CheckEthereumTxData(unprotected, evm))
+	evm.AllowUnprotectedTxs = true
+	assert.NoError(t, middleware.CheckEthereumTxData(unprotected, evm))
+
+	assert.NoError(t, middleware.CheckEthereumTxData(newLegacyTx(testEVMChainID, 500000000000, 21000, ""), evm))
+	evm.ContractCreation = false
+	assert.Error(t, middleware.CheckEthereumTxData(newLegacyTx(testEVMChainID, 500000000000, 21000, ""), evm))
+
+	chainID, tipCap, feeCap := sdk.NewInt(testEVMChainID), sdk.NewInt(1), sdk.NewInt(500000000000)
+	dynamicFeeTx := &evmtypes.DynamicFeeTx{ChainID: &chainID, GasTipCap: &tipCap, GasFeeCap: &feeCap, GasLimit: 21000, To: to}
+	assert.NoError(t, middleware.CheckEthereumTxData(dynamicFeeTx, evm))
+	evm.MinimumGasTipCap = "2"
+	assert.Error(t, middleware.CheckEthereumTxData(dynamicFeeTx, evm))
+}
+
+func TestCheckEthereumTxBytes(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Chain.EVM.ChainID = testEVMChainID
+	validator := middleware.NewValidator(cfg)
+
+	txData := newLegacyTx(testEVMChainID, 500000000000, 21000, "0x2407900b68B18dBcf9ee9dC43110Ad422695305c")
+	assert.NoError(t, validator.CheckTxBytes(context.Background(), newEthereumTxBytes(t, txData, nil)))
+	assert.Error(t, validator.CheckTxBytes(context.Background(), newEthereumTxBytes(t, txData, [][]byte{make([]byte, 65)})))
+	assert.Error(t, validator.CheckTxBytes(context.Background(), newEthereumTxBytes(t, newLegacyTx(1, 500000000000, 21000, ""), nil)))
+
+	// the gas limits of the messages wrap around to the fee gas limit
+	wrapping := newLegacyTx(testEVMChainID, 500000000000, math.MaxUint64, "0x2407900b68B18dBcf9ee9dC43110Ad422695305c")
+	assert.NoError(t, validator.CheckTxBytes(context.Background(), newEthereumMsgsTxBytes(t, 42000, nil, txData, txData)))
+	assert.Error(t, validator.CheckTxBytes(context.Background(), newEthereumMsgsTxBytes(t, 20999, nil, wrapping, newLegacyTx(testEVMChainID, 500000000000, 21000, ""))))
+}
+
+func TestEVMRPCPolicy(t *testing.T) {
+	validator := middleware.Validator{Cfg: config.DefaultConfig()}
+
+	assert.True(t, validator.IsEVMRPCMethodAllowed("eth_blockNumber"))
+	assert.True(t, validator.IsEVMRPCMethodAllowed("net_version"))
+	assert.False(t, validator.IsEVMRPCMethodAllowed("eth_sendTransaction"))
+	assert.False(t, validator.IsEVMRPCMethodAllowed("debug_traceTransaction"))
+	assert.False(t, validator.IsEVMRPCMethodAllowed("personal_unlockAccount"))
+
+	assert.NoError(t, validator.CheckEVMLogsBlockRange(100, 100+config.DefaultEVMRPCMaxGetLogsBlockRange))
+	assert.Error(t, validator.CheckEVMLogsBlockRange(100, 101+config.DefaultEVMRPCMaxGetLogsBlockRange))
+	assert.Error(t, validator.CheckEVMLogsBlockRange(100, 99))
+	assert.NoError(t, validator.CheckEVMCallGas(config.DefaultEVMRPCMaxCallGas))
+	assert.Error(t, validator.CheckEVMCallGas(config.DefaultEVMRPCMaxCallGas+1))
+
+	assert.Error(t, validator.CheckEthereumRawTx([]byte{0x01, 0x02}))
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	ethermint "github.com/evmos/ethermint/types"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+const (
+	ExtensionOptionsWeb3TxTypeURL      = "/ethermint.types.v1.ExtensionOptionsWeb3Tx"
+	ExtensionOptionDynamicFeeTxTypeURL = "/ethermint.types.v1.ExtensionOptionDynamicFeeTx"
+)
+
+// checkExtensionOptions rejects options whose type url is not in the allowlist, unless the
+// deprecated allowAny is set, and validates the content of the options known to the firewall.
+func (v Validator) checkExtensionOptions(options []*codectypes.Any, allowed []string, allowAny int) error {
+	for _, option := range options {
+		if allowAny == 0 && !containsTypeURL(allowed, option.TypeUrl) {
+			return Rejectf(CodeExtensionDenied, "extension option %s is not allowed", option.TypeUrl)
+		}
+		switch option.TypeUrl {
+		case ExtensionOptionsEthereumTxTypeURL:
+			if len(option.Value) > 0 {
+				return NewRejection(CodeExtensionDenied, "ExtensionOptionsEthereumTx must be empty")
+			}
+		case ExtensionOptionsWeb3TxTypeURL:
+			if _, err := v.unpackWeb3TxOption(option); err != nil {
+				return err
+			}
+		case ExtensionOptionDynamicFeeTxTypeURL:
+			dynamicFee := ethermint.ExtensionOptionDynamicFeeTx{}
+			if err := proto.Unmarshal(option.Value, &dynamicFee); err != nil {
+				return WrapRejection(CodeInvalidTx, err, "proto unmarshal ExtensionOptionDynamicFeeTx")
+			}
+			if dynamicFee.MaxPriorityPrice.IsNil() || dynamicFee.MaxPriorityPrice.IsNegative() {
+				return NewRejection(CodeInvalidFee, "invalid max priority price")
+			}
+		}
+	}
+	return nil
+}
+
+// unpackWeb3TxOption decodes the option attached to EIP-712 signed txs and checks the
+// typed data chain id and the fee payer fields.
+func (v Validator) unpackWeb3TxOption(option *codectypes.Any) (*ethermint.ExtensionOptionsWeb3Tx, error) {
+	web3Tx := &ethermint.ExtensionOptionsWeb3Tx{}
+	if err := proto.Unmarshal(option.Value, web3Tx); err != nil {
+		return nil, WrapRejection(CodeInvalidTx, err, "proto unmarshal ExtensionOptionsWeb3Tx")
+	}
+	if evmChainID := v.Cfg.Chain.EVM.ChainID; evmChainID != 0 && web3Tx.TypedDataChainID != evmChainID {
+		return nil, Rejectf(CodeChainIDMismatch, "invalid typed data chain id, expect: %d, actual: %d", evmChainID, web3Tx.TypedDataChainID)
+	}
+	if web3Tx.FeePayer == "" {
+		return nil, NewRejection(CodeInvalidFeePayer, "fee payer is empty")
+	}
+	if _, _, err := bech32.DecodeAndConvert(web3Tx.FeePayer); err != nil {
+		return nil, WrapRejection(CodeInvalidFeePayer, err, "invalid fee payer")
+	}
+	if len(web3Tx.FeePayerSig) > 0 && len(web3Tx.FeePayerSig) != 65 {
+		return nil, NewRejection(CodeInvalidFeePayer, "fee payer signature format error")
+	}
+	return web3Tx, nil
+}
+
+// checkWeb3TxFeePayer requires the fee payer of an EIP-712 signed tx to be the first
+// signer of the first message, as ethermint's EIP-712 ante handler does.
+func (v Validator) checkWeb3TxFeePayer(txBody tx.TxBody) error {
+	for _, option := range txBody.ExtensionOptions {
+		if option.TypeUrl != ExtensionOptionsWeb3TxTypeURL {
+			continue
+		}
+		web3Tx, err := v.unpackWeb3TxOption(option)
+		if err != nil {
+			return err
+		}
+		_, feePayer, err := bech32.DecodeAndConvert(web3Tx.FeePayer)
+		if err != nil {
+			return WrapRejection(CodeInvalidFeePayer, err, "invalid fee payer %s", web3Tx.FeePayer)
+		}
+		if len(txBody.Messages) == 0 {
+			return NewRejection(CodeInvalidTx, "tx without messages")
+		}
+		var msg sdk.Msg
+		if err = v.Routers.InterfaceRegistry().UnpackAny(txBody.Messages[0], &msg); err != nil {
+			return WrapRejection(CodeInvalidTx, err, "unpack message")
+		}
+		signers, err := msgSigners(msg)
+		if err != nil {
+			return WrapRejection(CodeInvalidTx, err, "message signers")
+		}
+		if len(signers) == 0 || !bytes.Equal(signers[0], feePayer) {
+			return NewRejection(CodeInvalidFeePayer, "fee payer does not match the first signer")
+		}
+	}
+	return nil
+}
+
+// msgSigners returns the signers of a message, or an error instead of the panic of
+// GetSigners on a malformed signer address.
+func msgSigners(msg sdk.Msg) (signers []sdk.AccAddress, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("invalid signer of %s: %v", sdk.MsgTypeURL(msg), r)
+		}
+	}()
+	return msg.GetSigners(), nil
+}
+
+func containsTypeURL(typeURLs []string, typeURL string) bool {
+	for _, url := range typeURLs {
+		if strings.EqualFold(url, typeURL) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"testing"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	vestingtypes "github.com/cosmos/cosmos-sdk/x/auth/vesting/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	ethermint "github.com/evmos/ethermint/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestCheckTxBodyExtensionOptions(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Chain.EVM.ChainID = testEVMChainID
+	validator := middleware.NewValidator(cfg)
+
+	sender := "fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy"
+	msg, err := codectypes.NewAnyWithValue(&banktypes.MsgSend{FromAddress: sender, ToAddress: sender, Amount: sdk.NewCoins(sdk.NewInt64Coin("FX", 1))})
+	require.NoError(t, err)
+	web3Tx, err := codectypes.NewAnyWithValue(&ethermint.ExtensionOptionsWeb3Tx{TypedDataChainID: testEVMChainID, FeePayer: sender})
+	require.NoError(t, err)
+	txBody := tx.TxBody{Messages: []*codectypes.Any{msg}, ExtensionOptions: []*codectypes.Any{web3Tx}}
+
+	assert.NoError(t, validator.CheckTxBody(txBody))
+	cfg.Chain.AllowedExtensionOptions = []string{middleware.ExtensionOptionsEthereumTxTypeURL}
+	assert.Error(t, validator.CheckTxBody(txBody))
+	cfg.Chain.AllowedExtensionOptions = append(cfg.Chain.AllowedExtensionOptions, middleware.ExtensionOptionsWeb3TxTypeURL)
+	assert.NoError(t, validator.CheckTxBody(txBody))
+
+	web3Tx, err = codectypes.NewAnyWithValue(&ethermint.ExtensionOptionsWeb3Tx{TypedDataChainID: 1, FeePayer: sender})
+	require.NoError(t, err)
+	assert.Error(t, validator.CheckTxBody(tx.TxBody{Messages: []*codectypes.Any{msg}, ExtensionOptions: []*codectypes.Any{web3Tx}}))
+
+	assert.Error(t, validator.CheckTxBody(tx.TxBody{Messages: []*codectypes.Any{msg}, NonCriticalExtensionOptions: []*codectypes.Any{web3Tx}}))
+
+	// the deprecated non-critical-extension-options allows any option
+	dynamicFee, err := codectypes.NewAnyWithValue(&ethermint.ExtensionOptionDynamicFeeTx{MaxPriorityPrice: sdk.NewInt(1)})
+	require.NoError(t, err)
+	assert.Error(t, validator.CheckTxBody(tx.TxBody{Messages: []*codectypes.Any{msg}, NonCriticalExtensionOptions: []*codectypes.Any{dynamicFee}}))
+	cfg.Chain.NonCriticalExtensionOptions = 1
+	assert.NoError(t, validator.CheckTxBody(tx.TxBody{Messages: []*codectypes.Any{msg}, NonCriticalExtensionOptions: []*codectypes.Any{dynamicFee}}))
+}
+
+func TestCheckTxWeb3FeePayer(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Chain.EVM.ChainID = testEVMChainID
+	validator := middleware.NewValidator(cfg)
+
+	decodedTx := newTestTx(t, 1, 200000, 1)
+	web3Tx, err := codectypes.NewAnyWithValue(&ethermint.ExtensionOptionsWeb3Tx{TypedDataChainID: testEVMChainID, FeePayer: "fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy"})
+	require.NoError(t, err)
+	decodedTx.Body.ExtensionOptions = []*codectypes.Any{web3Tx}
+	assert.NoError(t, validator.CheckTx(decodedTx))
+
+	web3Tx, err = codectypes.NewAnyWithValue(&ethermint.ExtensionOptionsWeb3Tx{TypedDataChainID: testEVMChainID, FeePayer: "fx1uvsrzdsq7ya54zv34fqgssdgpfsww0hnz2drsg"})
+	require.NoError(t, err)
+	decodedTx.Body.ExtensionOptions = []*codectypes.Any{web3Tx}
+	assert.Error(t, validator.CheckTx(decodedTx))
+
+	// a malformed signer address is rejected instead of panicking in GetSigners
+	decodedTx = newTestTx(t, 1, 200000, 1)
+	msg, err := codectypes.NewAnyWithValue(&vestingtypes.MsgCreatePeriodicVestingAccount{FromAddress: "garbage", ToAddress: "fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy"})
+	require.NoError(t, err)
+	decodedTx.Body.Messages = []*codectypes.Any{msg}
+	decodedTx.Body.ExtensionOptions = []*codectypes.Any{web3Tx}
+	assert.NotPanics(t, func() {
+		assert.Error(t, validator.CheckTx(decodedTx))
+	})
+
+	decodedTx.Body.Messages = nil
+	assert.NotPanics(t, func() {
+		assert.Error(t, validator.CheckTx(decodedTx))
+	})
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+)
+
+var (
+	ErrIPDenied      = NewRejection(CodeIPDenied, "client ip is not allowed")
+	ErrCountryDenied = NewRejection(CodeIPDenied, "client country is not allowed")
+)
+
+// IPFilter decides whether a client IP may connect from the allow and deny lists and
+// the country of the IP in a MaxMind database.
+type IPFilter struct {
+	cfg      config.AccessControl
+	state    atomic.Value // *ipFilterState
+	modTimes map[string]time.Time
+}
+
+type ipFilterState struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+	geoIP *maxminddb.Reader
+}
+
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+func NewIPFilter(cfg config.AccessControl) (*IPFilter, error) {
+	filter := &IPFilter{cfg: cfg, modTimes: make(map[string]time.Time)}
+	if err := filter.Reload(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Reload reads the list files and the database, the state in use is kept on error.
+func (f *IPFilter) Reload() error {
+	allow, err := f.loadList(f.cfg.AllowList, f.cfg.AllowFile)
+	if err != nil {
+		return errors.Wrapf(err, "load allow list")
+	}
+	deny, err := f.loadList(f.cfg.DenyList, f.cfg.DenyFile)
+	if err != nil {
+		return errors.Wrapf(err, "load deny list")
+	}
+	state := &ipFilterState{allow: allow, deny: deny}
+	if f.cfg.GeoIPDatabase != "" {
+		bz, err := os.ReadFile(f.cfg.GeoIPDatabase)
+		if err != nil {
+			return errors.Wrapf(err, "read geoip database")
+		}
+		// the database is read into memory so that a reload never unmaps a reader in use
+		if state.geoIP, err = maxminddb.FromBytes(bz); err != nil {
+			return errors.Wrapf(err, "open geoip database")
+		}
+	}
+	f.state.Store(state)
+	for _, file := range []string{f.cfg.AllowFile, f.cfg.DenyFile, f.cfg.GeoIPDatabase} {
+		if info, err := os.Stat(file); err == nil {
+			f.modTimes[file] = info.ModTime()
+		}
+	}
+	return nil
+}
+
+func (f *IPFilter) loadList(static []string, file string) ([]*net.IPNet, error) {
+	entries := append([]string{}, static...)
+	if file != "" {
+		bz, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(bz))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			if line = strings.TrimSpace(line); line != "" {
+				entries = append(entries, line)
+			}
+		}
+	}
+	return config.ParseCIDRs(entries)
+}
+
+// Watch reloads the filter when a file changes, until ctx is done.
+func (f *IPFilter) Watch(ctx context.Context) {
+	if f.cfg.ReloadSecond <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(f.cfg.ReloadSecond) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !f.changed() {
+				continue
+			}
+			if err := f.Reload(); err != nil {
+				log.Errorf("reload access control: %s", err.Error())
+				continue
+			}
+			log.Info("reloaded access control")
+		}
+	}
+}
+
+func (f *IPFilter) changed() bool {
+	for _, file := range []string{f.cfg.AllowFile, f.cfg.DenyFile, f.cfg.GeoIPDatabase} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Equal(f.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check denies IPs of the deny list, IPs missing from a non-empty allow list and IPs of
+// a denied country or, when allowed countries are set, of any other or unknown country.
+func (f *IPFilter) Check(ctx context.Context, ip string) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ErrIPDenied
+	}
+	state := f.state.Load().(*ipFilterState)
+	if containsIP(state.deny, parsed) {
+		return ErrIPDenied
+	}
+	if len(state.allow) > 0 && !containsIP(state.allow, parsed) {
+		return ErrIPDenied
+	}
+	if state.geoIP == nil || (len(f.cfg.AllowedCountries) == 0 && len(f.cfg.DeniedCountries) == 0) {
+		return nil
+	}
+	var record geoIPRecord
+	if err := state.geoIP.Lookup(parsed, &record); err != nil {
+		log.Ctx(ctx).Warnf("geoip lookup %s: %s", ip, err.Error())
+	}
+	country := record.Country.ISOCode
+	if country == "" {
+		country = record.RegisteredCountry.ISOCode
+	}
+	if country != "" && containsCountry(f.cfg.DeniedCountries, country) {
+		return ErrCountryDenied
+	}
+	if len(f.cfg.AllowedCountries) > 0 && (country == "" || !containsCountry(f.cfg.AllowedCountries, country)) {
+		return ErrCountryDenied
+	}
+	return nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCountry(countries []string, country string) bool {
+	for _, c := range countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package middleware_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestIPFilter(t *testing.T) {
+	denyFile := filepath.Join(t.TempDir(), "deny.txt")
+	require.NoError(t, os.WriteFile(denyFile, []byte("# scanners\n192.0.2.0/24\n2001:db8::/32 # documentation\n"), 0o600))
+
+	cfg := config.DefaultConfig().AccessControl
+	cfg.Enable = true
+	cfg.DenyList = []string{"198.51.100.7"}
+	cfg.DenyFile = denyFile
+	filter, err := middleware.NewIPFilter(cfg)
+	require.NoError(t, err)
+
+	assert.NoError(t, filter.Check(context.Background(), "203.0.113.1"))
+	assert.ErrorIs(t, filter.Check(context.Background(), "198.51.100.7"), middleware.ErrIPDenied)
+	assert.ErrorIs(t, filter.Check(context.Background(), "192.0.2.10"), middleware.ErrIPDenied)
+	assert.ErrorIs(t, filter.Check(context.Background(), "2001:db8::1"), middleware.ErrIPDenied)
+	assert.ErrorIs(t, filter.Check(context.Background(), "not-an-ip"), middleware.ErrIPDenied)
+
+	require.NoError(t, os.WriteFile(denyFile, []byte("203.0.113.0/24\n"), 0o600))
+	require.NoError(t, filter.Reload())
+	assert.NoError(t, filter.Check(context.Background(), "192.0.2.10"))
+	assert.ErrorIs(t, filter.Check(context.Background(), "203.0.113.1"), middleware.ErrIPDenied)
+
+	// an invalid file keeps the lists in use
+	require.NoError(t, os.WriteFile(denyFile, []byte("invalid\n"), 0o600))
+	assert.Error(t, filter.Reload())
+	assert.ErrorIs(t, filter.Check(context.Background(), "203.0.113.1"), middleware.ErrIPDenied)
+
+	cfg.AllowList = []string{"10.0.0.0/8"}
+	cfg.DenyList = []string{"10.0.0.1"}
+	cfg.DenyFile = ""
+	filter, err = middleware.NewIPFilter(cfg)
+	require.NoError(t, err)
+	assert.NoError(t, filter.Check(context.Background(), "10.1.2.3"))
+	assert.ErrorIs(t, filter.Check(context.Background(), "10.0.0.1"), middleware.ErrIPDenied)
+	assert.ErrorIs(t, filter.Check(context.Background(), "11.0.0.1"), middleware.ErrIPDenied)
+
+	cfg.GeoIPDatabase = filepath.Join(t.TempDir(), "missing.mmdb")
+	_, err = middleware.NewIPFilter(cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// jsonLog appends records as JSON lines to a file, rotated as set by its logger.Rotation.
+type jsonLog struct {
+	name   string
+	writer io.WriteCloser
+}
+
+func newJSONLog(name string, writer io.WriteCloser) *jsonLog {
+	return &jsonLog{name: name, writer: writer}
+}
+
+func (l *jsonLog) append(record interface{}) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("marshal %s record: %s", l.name, err.Error())
+		return
+	}
+	if _, err = l.writer.Write(append(line, '\n')); err != nil {
+		log.Errorf("write %s record: %s", l.name, err.Error())
+	}
+}
+
+// Watch closes the log, stopping its rotation, once ctx is done.
+func (l *jsonLog) Watch(ctx context.Context) {
+	<-ctx.Done()
+	if err := l.writer.Close(); err != nil {
+		log.Errorf("close %s log: %s", l.name, err.Error())
+	}
+}
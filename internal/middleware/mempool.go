@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+)
+
+var ErrMempoolFull = NewRejection(CodeMempoolFull, "mempool full, retry later")
+
+// MempoolGuard holds back broadcasts while the upstream mempools fill up, see config.Mempool.
+type MempoolGuard struct {
+	cfg config.Mempool
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewMempoolGuard(cfg config.Mempool) *MempoolGuard {
+	return &MempoolGuard{cfg: cfg, tokens: math.Max(1, cfg.ThrottleRate), last: time.Now()}
+}
+
+// Allow admits a broadcast given the number of txs and bytes in the mempool, broadcasts
+// with priority are always admitted.
+func (g *MempoolGuard) Allow(txs, bytes int64, priority bool) error {
+	if priority {
+		return nil
+	}
+	if overThreshold(txs, g.cfg.RejectTxs) || overThreshold(bytes, g.cfg.RejectBytes) {
+		return errors.Wrapf(ErrMempoolFull, "%d txs, %d bytes in mempool", txs, bytes)
+	}
+	if !overThreshold(txs, g.cfg.ThrottleTxs) && !overThreshold(bytes, g.cfg.ThrottleBytes) {
+		return nil
+	}
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tokens = math.Min(math.Max(1, g.cfg.ThrottleRate), g.tokens+now.Sub(g.last).Seconds()*g.cfg.ThrottleRate)
+	g.last = now
+	if g.tokens < 1 {
+		return errors.Wrapf(ErrMempoolFull, "broadcasts throttled, %d txs, %d bytes in mempool", txs, bytes)
+	}
+	g.tokens--
+	return nil
+}
+
+// RetryAfter returns how long a client held back should wait, until the mempools are polled again.
+func (g *MempoolGuard) RetryAfter() time.Duration {
+	return time.Duration(g.cfg.PollSecond) * time.Second
+}
+
+func overThreshold(n, threshold int64) bool {
+	return threshold > 0 && n >= threshold
+}
+
+// checkMempool applies the mempool backpressure to a broadcast, a no-op until the mempool
+// size of the upstream nodes is known.
+func (v Validator) checkMempool(priority bool) error {
+	if v.Mempool == nil || v.MempoolSize == nil {
+		return nil
+	}
+	txs, bytes := v.MempoolSize()
+	return v.Mempool.Allow(txs, bytes, priority)
+}
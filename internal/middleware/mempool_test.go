@@ -0,0 +1,95 @@
+package middleware_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	distributiontypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestMempoolGuard(t *testing.T) {
+	cfg := config.DefaultConfig().Mempool
+	cfg.Enable = true
+	cfg.ThrottleTxs = 100
+	cfg.ThrottleBytes = 0
+	cfg.ThrottleRate = 2
+	cfg.RejectTxs = 200
+	cfg.RejectBytes = 1 << 20
+	guard := middleware.NewMempoolGuard(cfg)
+
+	assert.NoError(t, guard.Allow(99, 0, false))
+	// over the reject thresholds only priority txs are admitted
+	assert.ErrorIs(t, guard.Allow(200, 0, false), middleware.ErrMempoolFull)
+	assert.ErrorIs(t, guard.Allow(0, 1<<20, false), middleware.ErrMempoolFull)
+	assert.NoError(t, guard.Allow(200, 1<<20, true))
+	// over the throttle threshold broadcasts are limited to the throttle rate
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, guard.Allow(150, 0, false))
+	}
+	assert.ErrorIs(t, guard.Allow(150, 0, false), middleware.ErrMempoolFull)
+	assert.NoError(t, guard.Allow(150, 0, true))
+	assert.NoError(t, guard.Allow(99, 0, false))
+}
+
+func TestMempoolBroadcast(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Chain.EVM.ChainID = testEVMChainID
+	cfg.Mempool.Enable = true
+	validator := middleware.NewValidator(cfg)
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0x2407900b68B18dBcf9ee9dC43110Ad422695305c")
+	ethTx, err := ethtypes.SignNewTx(key, ethtypes.LatestSignerForChainID(big.NewInt(testEVMChainID)),
+		&ethtypes.LegacyTx{GasPrice: big.NewInt(500000000000), Gas: 21000, To: &to, Value: big.NewInt(1)})
+	require.NoError(t, err)
+	rawTx, err := ethTx.MarshalBinary()
+	require.NoError(t, err)
+
+	// the mempool size is unknown without upstream nodes
+	require.NoError(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx))
+	var txs int64
+	validator.MempoolSize = func() (int64, int64) {
+		return txs, 0
+	}
+	require.NoError(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx))
+	txs = cfg.Mempool.RejectTxs
+	assert.ErrorIs(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx), middleware.ErrMempoolFull)
+	// invalid txs are still reported as such
+	assert.NotErrorIs(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx[:len(rawTx)-1]), middleware.ErrMempoolFull)
+}
+
+func TestMempoolWhiteRoutersPriority(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Mempool.Enable = true
+	cfg.Chain.WhiteRouters = []string{"/cosmos.bank.v1beta1.MsgSend"}
+	validator := middleware.NewValidator(cfg)
+	validator.MempoolSize = func() (int64, int64) {
+		return cfg.Mempool.RejectTxs, 0
+	}
+
+	// the txs whose messages are all white routers have priority
+	assert.NoError(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.1", newTestTxBytes(t, newTestTx(t, 2, 200000, 1))))
+
+	// a white router message does not give priority to the other messages of its tx
+	mixedTx := newTestTx(t, 1, 200000, 1)
+	msg, err := codectypes.NewAnyWithValue(&distributiontypes.MsgWithdrawDelegatorReward{
+		DelegatorAddress: "fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy",
+		ValidatorAddress: "fxvaloper1pmlwpl22294jeh06zvx39y5txnxnaezfvg8h3h",
+	})
+	require.NoError(t, err)
+	mixedTx.Body.Messages = append(mixedTx.Body.Messages, msg)
+	mixedTx.AuthInfo.Fee.Amount = sdk.NewCoins(sdk.NewInt64Coin("FX", 4000))
+	assert.ErrorIs(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.1", newTestTxBytes(t, mixedTx)), middleware.ErrMempoolFull)
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"math/bits"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+)
+
+var (
+	ErrStampRequired = NewRejection(CodeProofOfWork, "proof of work stamp required")
+	ErrInvalidStamp  = NewRejection(CodeProofOfWork, "invalid proof of work stamp")
+)
+
+// powLoadWindow is the number of seconds the broadcast rate is measured over.
+const powLoadWindow = 10
+
+// PoW requires hashcash style stamps, bound to the hash of the tx, on broadcasts while the
+// broadcast rate is above the load threshold. Challenges are derived from a secret and the
+// challenge epoch, the difficulty of a challenge is fixed when it is first used.
+type PoW struct {
+	cfg    config.PoW
+	secret []byte
+
+	mu       sync.Mutex
+	counts   [powLoadWindow]int64
+	seconds  [powLoadWindow]int64
+	current  powChallenge
+	previous powChallenge
+}
+
+type powChallenge struct {
+	epoch      int64
+	challenge  string
+	difficulty int
+}
+
+// PoWChallenge is the proof of work challenge in use.
+type PoWChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	Required   bool      `json:"required"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func NewPoW(cfg config.PoW) (*PoW, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.Wrapf(err, "read random bytes")
+	}
+	return &PoW{cfg: cfg, secret: secret}, nil
+}
+
+// Challenge returns the challenge in use and whether stamps are currently required.
+func (p *PoW) Challenge() PoWChallenge {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rotate(now)
+	return PoWChallenge{
+		Challenge:  p.current.challenge,
+		Difficulty: p.current.difficulty,
+		Required:   p.required(p.rate(now.Unix())),
+		ExpiresAt:  time.Unix((p.current.epoch+1)*p.cfg.ChallengeSecond, 0),
+	}
+}
+
+// Verify counts a broadcast towards the load and, when stamps are required, checks one of
+// the stamps solves the current or the previous challenge for the tx hash.
+func (p *PoW) Verify(stamps []string, txHash []byte) error {
+	now := time.Now()
+	p.mu.Lock()
+	p.observe(now.Unix())
+	p.rotate(now)
+	required := p.required(p.rate(now.Unix()))
+	challenges := []powChallenge{p.current, p.previous}
+	p.mu.Unlock()
+	if !required {
+		return nil
+	}
+	if len(stamps) == 0 {
+		return ErrStampRequired
+	}
+	hash := strings.ToUpper(hex.EncodeToString(txHash))
+	for _, stamp := range stamps {
+		challenge, nonce, ok := strings.Cut(stamp, ":")
+		if !ok {
+			continue
+		}
+		for _, c := range challenges {
+			if c.challenge != "" && c.challenge == challenge && LeadingZeroBits(StampHash(challenge, hash, nonce)) >= c.difficulty {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidStamp
+}
+
+func (p *PoW) observe(now int64) {
+	i := now % powLoadWindow
+	if p.seconds[i] != now {
+		p.seconds[i], p.counts[i] = now, 0
+	}
+	p.counts[i]++
+}
+
+// rate returns the broadcasts per second over the load window.
+func (p *PoW) rate(now int64) float64 {
+	var n int64
+	for i := range p.counts {
+		if now-p.seconds[i] < powLoadWindow {
+			n += p.counts[i]
+		}
+	}
+	return float64(n) / powLoadWindow
+}
+
+func (p *PoW) required(rate float64) bool {
+	return p.cfg.LoadThreshold == 0 || rate > p.cfg.LoadThreshold
+}
+
+// difficulty adds a bit to the minimum difficulty every time the rate doubles over the threshold.
+func (p *PoW) difficulty(rate float64) int {
+	difficulty := p.cfg.MinDifficulty
+	if p.cfg.LoadThreshold > 0 && rate > p.cfg.LoadThreshold {
+		difficulty += int(math.Log2(rate / p.cfg.LoadThreshold))
+	}
+	if difficulty > p.cfg.MaxDifficulty {
+		difficulty = p.cfg.MaxDifficulty
+	}
+	return difficulty
+}
+
+// rotate renews the challenge when its epoch is over.
+func (p *PoW) rotate(now time.Time) {
+	epoch := now.Unix() / p.cfg.ChallengeSecond
+	if p.current.challenge != "" && p.current.epoch == epoch {
+		return
+	}
+	p.previous = powChallenge{}
+	if p.current.challenge != "" && p.current.epoch == epoch-1 {
+		p.previous = p.current
+	}
+	mac := hmac.New(sha256.New, p.secret)
+	_ = binary.Write(mac, binary.BigEndian, epoch)
+	p.current = powChallenge{
+		epoch:      epoch,
+		challenge:  hex.EncodeToString(mac.Sum(nil)[:16]),
+		difficulty: p.difficulty(p.rate(now.Unix())),
+	}
+}
+
+// StampHash returns the hash of a stamp of a challenge for the upper case hex hash of a tx.
+func StampHash(challenge, txHash, nonce string) []byte {
+	hash := sha256.Sum256([]byte(challenge + ":" + txHash + ":" + nonce))
+	return hash[:]
+}
+
+// LeadingZeroBits returns the number of leading zero bits of a hash.
+func LeadingZeroBits(hash []byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,53 @@
+package middleware_test
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestPoW(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.PoW.Enable = true
+	cfg.PoW.LoadThreshold = 0
+	cfg.PoW.MinDifficulty = 8
+	validator := middleware.NewValidator(cfg)
+	txBytes := []byte("tx bytes")
+
+	challenge := validator.PoW.Challenge()
+	require.True(t, challenge.Required)
+	assert.Equal(t, 8, challenge.Difficulty)
+	assert.ErrorIs(t, validator.CheckBroadcastStamp(nil, txBytes), middleware.ErrStampRequired)
+
+	txHash := strings.ToUpper(hex.EncodeToString(tmhash.Sum(txBytes)))
+	stamp := ""
+	for nonce := 0; ; nonce++ {
+		if middleware.LeadingZeroBits(middleware.StampHash(challenge.Challenge, txHash, strconv.Itoa(nonce))) >= challenge.Difficulty {
+			stamp = challenge.Challenge + ":" + strconv.Itoa(nonce)
+			break
+		}
+	}
+	assert.NoError(t, validator.CheckBroadcastStamp([]string{"invalid", stamp}, txBytes))
+	// the stamp is bound to the tx hash and the challenge
+	assert.ErrorIs(t, validator.CheckBroadcastStamp([]string{stamp}, []byte("other tx bytes")), middleware.ErrInvalidStamp)
+	assert.ErrorIs(t, validator.CheckBroadcastStamp([]string{"unknown" + stamp[len(challenge.Challenge):]}, txBytes), middleware.ErrInvalidStamp)
+
+	cfg.PoW.LoadThreshold = 100
+	validator = middleware.NewValidator(cfg)
+	assert.False(t, validator.PoW.Challenge().Required)
+	assert.NoError(t, validator.CheckBroadcastStamp(nil, txBytes))
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, middleware.LeadingZeroBits([]byte{0x80, 0x00}))
+	assert.Equal(t, 11, middleware.LeadingZeroBits([]byte{0x00, 0x10}))
+	assert.Equal(t, 16, middleware.LeadingZeroBits([]byte{0x00, 0x00}))
+}
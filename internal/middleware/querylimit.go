@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos/cosmos-sdk/types/query"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// jsonRPCPerPageIndex is the position of per_page in the positional params of the paginated JSON-RPC routes.
+var jsonRPCPerPageIndex = map[string]int{
+	"tx_search":    3,
+	"block_search": 2,
+	"validators":   2,
+}
+
+var eventQueryConjunction = regexp.MustCompile(`(?i)\s+AND\s+`)
+
+var pageRequestType = reflect.TypeOf(&query.PageRequest{})
+
+// restCountTotalKeys are the query string keys of the count_total of a REST page request.
+var restCountTotalKeys = []string{"pagination.count_total", "pagination.countTotal"}
+
+// CheckPageRequest checks the limit and count_total of a page request, clamping them when
+// configured, and reports whether the request was changed.
+func (v Validator) CheckPageRequest(page *query.PageRequest) (bool, error) {
+	cfg := v.Cfg.QueryLimit
+	if !cfg.Enable || page == nil {
+		return false, nil
+	}
+	changed := false
+	if page.Limit > cfg.MaxPaginationLimit {
+		if !cfg.Clamp {
+			return false, Rejectf(CodeQueryLimitExceeded, "pagination limit %d exceeds %d", page.Limit, cfg.MaxPaginationLimit)
+		}
+		page.Limit, changed = cfg.MaxPaginationLimit, true
+	}
+	if page.CountTotal && !cfg.AllowCountTotal {
+		if !cfg.Clamp {
+			return false, NewRejection(CodeQueryLimitExceeded, "pagination count_total is not allowed")
+		}
+		page.CountTotal, changed = false, true
+	}
+	return changed, nil
+}
+
+// CheckEventQuery limits the number of conditions of a tendermint event query.
+func (v Validator) CheckEventQuery(eventQuery string) error {
+	cfg := v.Cfg.QueryLimit
+	if !cfg.Enable || strings.TrimSpace(eventQuery) == "" {
+		return nil
+	}
+	if conditions := len(eventQueryConjunction.Split(eventQuery, -1)); conditions > cfg.MaxEventConditions {
+		return Rejectf(CodeQueryLimitExceeded, "event query has %d conditions, exceeds %d", conditions, cfg.MaxEventConditions)
+	}
+	return nil
+}
+
+// CheckRESTQuery checks the pagination and the events of the query string of a REST request,
+// the query string is rewritten when its pagination is clamped.
+func (v Validator) CheckRESTQuery(u *url.URL) error {
+	if !v.Cfg.QueryLimit.Enable || u.RawQuery == "" {
+		return nil
+	}
+	values := u.Query()
+	page := &query.PageRequest{}
+	var err error
+	limitKey := "pagination.limit"
+	if limit := values.Get(limitKey); limit != "" {
+		if page.Limit, err = strconv.ParseUint(limit, 10, 64); err != nil {
+			return errors.Errorf("invalid pagination limit: %s", limit)
+		}
+	}
+	// the gateway accepts both spellings of count_total, count is requested by any true value
+	for _, key := range restCountTotalKeys {
+		for _, countTotal := range values[key] {
+			requested, err := strconv.ParseBool(countTotal)
+			if err != nil {
+				return errors.Errorf("invalid pagination count_total: %s", countTotal)
+			}
+			page.CountTotal = page.CountTotal || requested
+		}
+	}
+	if err = v.checkEvents(values["events"]); err != nil {
+		return err
+	}
+	changed, err := v.CheckPageRequest(page)
+	if err != nil || !changed {
+		return err
+	}
+	if values.Has(limitKey) {
+		values.Set(limitKey, strconv.FormatUint(page.Limit, 10))
+	}
+	if !page.CountTotal {
+		for _, key := range restCountTotalKeys {
+			values.Del(key)
+		}
+	}
+	u.RawQuery = values.Encode()
+	return nil
+}
+
+// CheckGRPCQuery decodes the request of a gRPC query method of the app and checks its page
+// requests and events, returning the request re-encoded when its pagination is clamped.
+func (v Validator) CheckGRPCQuery(fullMethodName string, payload []byte) ([]byte, error) {
+	if !v.Cfg.QueryLimit.Enable {
+		return payload, nil
+	}
+	msg, ok := v.Routers.NewGRPCRequest(fullMethodName)
+	if !ok {
+		return payload, nil
+	}
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s request", fullMethodName)
+	}
+	if eventsRequest, ok := msg.(*txtypes.GetTxsEventRequest); ok {
+		if err := v.checkEvents(eventsRequest.Events); err != nil {
+			return nil, err
+		}
+	}
+	changed := false
+	value := reflect.Indirect(reflect.ValueOf(msg))
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Type() != pageRequestType || field.IsNil() {
+			continue
+		}
+		pageChanged, err := v.CheckPageRequest(field.Interface().(*query.PageRequest))
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || pageChanged
+	}
+	if !changed {
+		return payload, nil
+	}
+	return proto.Marshal(msg)
+}
+
+// CheckJSONRPCParams checks the per_page and the event query of a call of a paginated JSON-RPC
+// route, given by name or by position, returning the params re-encoded when per_page is clamped.
+func (v Validator) CheckJSONRPCParams(method string, params json.RawMessage) (json.RawMessage, error) {
+	perPageIndex, ok := jsonRPCPerPageIndex[method]
+	if !v.Cfg.QueryLimit.Enable || !ok || len(params) == 0 {
+		return params, nil
+	}
+	var named map[string]json.RawMessage
+	var positional []json.RawMessage
+	var perPage, eventQuery json.RawMessage
+	if err := json.Unmarshal(params, &named); err == nil {
+		perPage, eventQuery = named["per_page"], named["query"]
+	} else if err = json.Unmarshal(params, &positional); err == nil {
+		if len(positional) > perPageIndex {
+			perPage = positional[perPageIndex]
+		}
+		if method != "validators" && len(positional) > 0 {
+			eventQuery = positional[0]
+		}
+	} else {
+		return nil, errors.Wrapf(err, "invalid %s params", method)
+	}
+	if len(eventQuery) > 0 && method != "validators" {
+		var q string
+		if err := json.Unmarshal(eventQuery, &q); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s query", method)
+		}
+		if err := v.CheckEventQuery(q); err != nil {
+			return nil, err
+		}
+	}
+	if len(perPage) == 0 || string(perPage) == "null" {
+		return params, nil
+	}
+	quoted := strings.HasPrefix(string(perPage), `"`)
+	clamped, changed, err := v.checkPerPage(strings.Trim(string(perPage), `"`))
+	if err != nil || !changed {
+		return params, err
+	}
+	if quoted {
+		clamped = strconv.Quote(clamped)
+	}
+	if named != nil {
+		named["per_page"] = json.RawMessage(clamped)
+		return json.Marshal(named)
+	}
+	positional[perPageIndex] = json.RawMessage(clamped)
+	return json.Marshal(positional)
+}
+
+// CheckJSONRPCURIQuery checks the per_page and the event query of a GET request to a paginated
+// JSON-RPC route, the query string is rewritten when per_page is clamped.
+func (v Validator) CheckJSONRPCURIQuery(method string, u *url.URL) error {
+	if _, ok := jsonRPCPerPageIndex[method]; !v.Cfg.QueryLimit.Enable || !ok {
+		return nil
+	}
+	values := u.Query()
+	if method != "validators" {
+		if err := v.CheckEventQuery(strings.Trim(values.Get("query"), `"`)); err != nil {
+			return err
+		}
+	}
+	perPage := values.Get("per_page")
+	if perPage == "" {
+		return nil
+	}
+	clamped, changed, err := v.checkPerPage(strings.Trim(perPage, `"`))
+	if err != nil || !changed {
+		return err
+	}
+	values.Set("per_page", clamped)
+	u.RawQuery = values.Encode()
+	return nil
+}
+
+func (v Validator) checkPerPage(perPage string) (string, bool, error) {
+	cfg := v.Cfg.QueryLimit
+	n, err := strconv.Atoi(perPage)
+	if err != nil {
+		return "", false, errors.Errorf("invalid per_page: %s", perPage)
+	}
+	if n <= cfg.MaxPerPage {
+		return perPage, false, nil
+	}
+	if !cfg.Clamp {
+		return "", false, Rejectf(CodeQueryLimitExceeded, "per_page %d exceeds %d", n, cfg.MaxPerPage)
+	}
+	return strconv.Itoa(cfg.MaxPerPage), true, nil
+}
+
+// checkEvents limits the number of conditions of the events of a GetTxsEvent request.
+func (v Validator) checkEvents(events []string) error {
+	cfg := v.Cfg.QueryLimit
+	conditions := 0
+	for _, event := range events {
+		conditions += len(eventQueryConjunction.Split(event, -1))
+	}
+	if conditions > cfg.MaxEventConditions {
+		return Rejectf(CodeQueryLimitExceeded, "events have %d conditions, exceeds %d", conditions, cfg.MaxEventConditions)
+	}
+	return nil
+}
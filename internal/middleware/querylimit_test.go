@@ -0,0 +1,112 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/types/query"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestQueryLimitREST(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.QueryLimit.Enable = true
+	validator := middleware.NewValidator(cfg)
+
+	u, err := url.Parse("/cosmos/staking/v1beta1/delegations/fxvaloper1?pagination.limit=1000000")
+	require.NoError(t, err)
+	assert.Error(t, validator.CheckRESTQuery(u))
+	u, err = url.Parse("/cosmos/staking/v1beta1/delegations/fxvaloper1?pagination.limit=100")
+	require.NoError(t, err)
+	assert.NoError(t, validator.CheckRESTQuery(u))
+	u, err = url.Parse("/cosmos/staking/v1beta1/delegations/fxvaloper1?pagination.count_total=true")
+	require.NoError(t, err)
+	assert.Error(t, validator.CheckRESTQuery(u))
+	// both spellings of count_total are checked
+	u, err = url.Parse("/cosmos/staking/v1beta1/delegations/fxvaloper1?pagination.count_total=false&pagination.countTotal=true")
+	require.NoError(t, err)
+	assert.Error(t, validator.CheckRESTQuery(u))
+	u, err = url.Parse("/cosmos/tx/v1beta1/txs?events=a.b='1'%20AND%20c.d='2'&events=e.f='3'%20AND%20g.h='4'%20AND%20i.j='5'&events=k.l='6'")
+	require.NoError(t, err)
+	assert.Error(t, validator.CheckRESTQuery(u))
+
+	validator.Cfg.QueryLimit.Clamp = true
+	u, err = url.Parse("/cosmos/staking/v1beta1/delegations/fxvaloper1?pagination.limit=1000000&pagination.countTotal=true")
+	require.NoError(t, err)
+	require.NoError(t, validator.CheckRESTQuery(u))
+	assert.Equal(t, "200", u.Query().Get("pagination.limit"))
+	assert.False(t, u.Query().Has("pagination.countTotal"))
+	u, err = url.Parse("/cosmos/staking/v1beta1/delegations/fxvaloper1?pagination.count_total=false&pagination.countTotal=true")
+	require.NoError(t, err)
+	require.NoError(t, validator.CheckRESTQuery(u))
+	assert.False(t, u.Query().Has("pagination.count_total"))
+	assert.False(t, u.Query().Has("pagination.countTotal"))
+}
+
+func TestQueryLimitGRPC(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.QueryLimit.Enable = true
+	validator := middleware.NewValidator(cfg)
+
+	method := "/cosmos.staking.v1beta1.Query/ValidatorDelegations"
+	payload, err := proto.Marshal(&stakingtypes.QueryValidatorDelegationsRequest{
+		ValidatorAddr: "fxvaloper1",
+		Pagination:    &query.PageRequest{Limit: 1000000, CountTotal: true},
+	})
+	require.NoError(t, err)
+	_, err = validator.CheckGRPCQuery(method, payload)
+	assert.Error(t, err)
+
+	validator.Cfg.QueryLimit.Clamp = true
+	clamped, err := validator.CheckGRPCQuery(method, payload)
+	require.NoError(t, err)
+	var req stakingtypes.QueryValidatorDelegationsRequest
+	require.NoError(t, proto.Unmarshal(clamped, &req))
+	assert.Equal(t, "fxvaloper1", req.ValidatorAddr)
+	assert.Equal(t, uint64(200), req.Pagination.Limit)
+	assert.False(t, req.Pagination.CountTotal)
+
+	// the conditions of the events are limited even when clamping
+	payload, err = proto.Marshal(&txtypes.GetTxsEventRequest{Events: []string{"a.b='1'", "c.d='2'", "e.f='3'", "g.h='4'", "i.j='5'", "k.l='6'"}})
+	require.NoError(t, err)
+	_, err = validator.CheckGRPCQuery("/cosmos.tx.v1beta1.Service/GetTxsEvent", payload)
+	assert.Error(t, err)
+}
+
+func TestQueryLimitJSONRPC(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.QueryLimit.Enable = true
+	validator := middleware.NewValidator(cfg)
+
+	_, err := validator.CheckJSONRPCParams("tx_search", json.RawMessage(`{"query":"tx.height=1","per_page":"100"}`))
+	assert.Error(t, err)
+	_, err = validator.CheckJSONRPCParams("validators", json.RawMessage(`["1","1",100]`))
+	assert.Error(t, err)
+	_, err = validator.CheckJSONRPCParams("block_search", json.RawMessage(`["a='1' AND b='2' and c='3' AND d='4' AND e='5' AND f='6'"]`))
+	assert.Error(t, err)
+	params := json.RawMessage(`["tx.height=1",false,"1","30"]`)
+	checked, err := validator.CheckJSONRPCParams("tx_search", params)
+	require.NoError(t, err)
+	assert.Equal(t, params, checked)
+
+	validator.Cfg.QueryLimit.Clamp = true
+	checked, err = validator.CheckJSONRPCParams("tx_search", json.RawMessage(`{"query":"tx.height=1","per_page":"100"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"query":"tx.height=1","per_page":"50"}`, string(checked))
+	checked, err = validator.CheckJSONRPCParams("validators", json.RawMessage(`["1","1",100]`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `["1","1",50]`, string(checked))
+
+	u, err := url.Parse("/tx_search?query=%22tx.height=1%22&per_page=100")
+	require.NoError(t, err)
+	require.NoError(t, validator.CheckJSONRPCURIQuery("tx_search", u))
+	assert.Equal(t, "50", u.Query().Get("per_page"))
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// bucketIdleTimeout is how long a full bucket is kept after its client's last request.
+const bucketIdleTimeout = 10 * time.Minute
+
+type RateLimiter struct {
+	rules map[string]config.RateLimitRule
+	tiers map[string]config.Tier
+	costs *RouteCosts
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket holds the tokens of a client, negative while it pays off a request which
+// cost more than the burst.
+type tokenBucket struct {
+	tokens float64
+	rate   float64
+	last   time.Time
+}
+
+// NewRateLimiter creates the buckets of the rate limit rules, when enabled, and of the
+// rules of the API key tiers, which take precedence.
+func NewRateLimiter(cfg config.RateLimit, tiers map[string]config.Tier, routers *Routers) *RateLimiter {
+	var rules map[string]config.RateLimitRule
+	if cfg.Enable {
+		rules = cfg.Rules
+	}
+	return &RateLimiter{
+		rules:     rules,
+		tiers:     tiers,
+		costs:     NewRouteCosts(cfg, routers),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Cost returns the number of tokens charged for a request to the route, see RouteCosts.Cost.
+func (l *RateLimiter) Cost(protocol types.Protocol, route string) float64 {
+	return l.costs.Cost(protocol, route)
+}
+
+// Allow takes n tokens from the bucket of the client for the protocol and route class.
+// When the bucket is short it returns false and how long the client should wait.
+// A request costing more than the burst needs a full bucket and leaves it in debt for
+// the rest of its cost, so that it is charged in full.
+func (l *RateLimiter) Allow(identity Identity, protocol types.Protocol, class types.RouteClass, n float64) (bool, time.Duration) {
+	_, ok, retryAfter := l.AllowClasses(identity, protocol, map[types.RouteClass]float64{class: n})
+	return ok, retryAfter
+}
+
+// AllowClasses takes the cost of a request per route class from the buckets of the client,
+// as Allow does, either from all of them or from none: when a bucket is short nothing is
+// taken and the first short route class, in name order, is returned.
+func (l *RateLimiter) AllowClasses(identity Identity, protocol types.Protocol, costs map[types.RouteClass]float64) (types.RouteClass, bool, time.Duration) {
+	type charge struct {
+		class types.RouteClass
+		rule  config.RateLimitRule
+		n     float64
+	}
+	classes := make([]types.RouteClass, 0, len(costs))
+	for class := range costs {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+	// the classes falling back to the rule of the protocol share its bucket
+	charges := make(map[string]*charge, len(classes))
+	bucketKeys := make([]string, 0, len(classes))
+	for _, class := range classes {
+		key, rule, ok := l.rule(identity.Tier, protocol, class)
+		if !ok || rule.RequestsPerSecond <= 0 {
+			continue
+		}
+		bucketKey := key + "|" + identity.Client
+		if c, ok := charges[bucketKey]; ok {
+			c.n += costs[class]
+			continue
+		}
+		charges[bucketKey] = &charge{class: class, rule: rule, n: costs[class]}
+		bucketKeys = append(bucketKeys, bucketKey)
+	}
+	if len(bucketKeys) == 0 {
+		return "", true, 0
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	for _, bucketKey := range bucketKeys {
+		c := charges[bucketKey]
+		capacity := float64(c.rule.Burst)
+		if capacity <= 0 {
+			capacity = math.Max(1, c.rule.RequestsPerSecond)
+		}
+		bucket, ok := l.buckets[bucketKey]
+		if !ok {
+			bucket = &tokenBucket{tokens: capacity, last: now}
+			l.buckets[bucketKey] = bucket
+		}
+		bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*c.rule.RequestsPerSecond)
+		bucket.rate, bucket.last = c.rule.RequestsPerSecond, now
+		if needed := math.Min(c.n, capacity); bucket.tokens < needed {
+			return c.class, false, time.Duration((needed - bucket.tokens) / c.rule.RequestsPerSecond * float64(time.Second))
+		}
+	}
+	for _, bucketKey := range bucketKeys {
+		l.buckets[bucketKey].tokens -= charges[bucketKey].n
+	}
+	return "", true, 0
+}
+
+// rule returns the rule of the route class, falling back to the rule of the protocol,
+// from the rules of the tier and then from the rate limit rules.
+func (l *RateLimiter) rule(tier string, protocol types.Protocol, class types.RouteClass) (string, config.RateLimitRule, bool) {
+	keys := []string{config.RateLimitRuleKey(protocol, class), string(protocol)}
+	if tierRules := l.tiers[tier].Rules; len(tierRules) > 0 {
+		for _, key := range keys {
+			if rule, ok := tierRules[key]; ok {
+				return "tier:" + tier + "|" + key, rule, true
+			}
+		}
+	}
+	for _, key := range keys {
+		if rule, ok := l.rules[key]; ok {
+			return key, rule, true
+		}
+	}
+	return "", config.RateLimitRule{}, false
+}
+
+// sweep drops buckets of clients that have been idle long enough to be refilled, once
+// their debt is paid off.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.buckets {
+		idle := now.Sub(bucket.last)
+		if idle > bucketIdleTimeout && bucket.tokens+idle.Seconds()*bucket.rate >= 0 {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package middleware_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := middleware.NewRateLimiter(config.RateLimit{Enable: true, Rules: map[string]config.RateLimitRule{
+		string(types.RESTProtocol): {RequestsPerSecond: 1, Burst: 3},
+		config.RateLimitRuleKey(types.RESTProtocol, types.BroadcastRoute): {RequestsPerSecond: 0.5, Burst: 1},
+	}}, nil, nil)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow(middleware.Identity{Client: "10.0.0.1"}, types.RESTProtocol, types.QueryRoute, 1)
+		assert.True(t, ok)
+	}
+	ok, retryAfter := limiter.Allow(middleware.Identity{Client: "10.0.0.1"}, types.RESTProtocol, types.QueryRoute, 1)
+	assert.False(t, ok)
+	assert.True(t, retryAfter > 0)
+	ok, _ = limiter.Allow(middleware.Identity{Client: "10.0.0.2"}, types.RESTProtocol, types.QueryRoute, 1)
+	assert.True(t, ok)
+
+	ok, _ = limiter.Allow(middleware.Identity{Client: "10.0.0.1"}, types.RESTProtocol, types.BroadcastRoute, 1)
+	assert.True(t, ok)
+	ok, retryAfter = limiter.Allow(middleware.Identity{Client: "10.0.0.1"}, types.RESTProtocol, types.BroadcastRoute, 1)
+	assert.False(t, ok)
+	assert.True(t, retryAfter.Seconds() > 1)
+
+	ok, _ = limiter.Allow(middleware.Identity{Client: "10.0.0.1"}, types.GRPCProtocol, types.QueryRoute, 100)
+	assert.True(t, ok)
+}
+
+func TestRouteCosts(t *testing.T) {
+	costs := middleware.NewRouteCosts(config.RateLimit{DefaultCost: 2, Costs: []config.RouteCost{
+		{Protocol: string(types.JSONRPCProtocol), Route: "/tx_search", Cost: 30},
+		{Protocol: string(types.RESTProtocol), Route: "GET /cosmos/tx/v1beta1/txs", Cost: 25},
+		{Protocol: string(types.RESTProtocol), Route: "/cosmos/bank/v1beta1/balances/{address}", Cost: 3},
+		{Protocol: string(types.EVMRPCProtocol), Route: "eth_getLogs", Cost: 40},
+	}}, nil)
+
+	assert.Equal(t, float64(30), costs.Cost(types.JSONRPCProtocol, "/tx_search"))
+	assert.Equal(t, float64(2), costs.Cost(types.JSONRPCProtocol, "/status"))
+	assert.Equal(t, float64(25), costs.Cost(types.RESTProtocol, "GET /cosmos/tx/v1beta1/txs"))
+	assert.Equal(t, float64(25), costs.Cost(types.RESTProtocol, "get /cosmos/tx/v1beta1/txs?events=a"))
+	assert.Equal(t, float64(2), costs.Cost(types.RESTProtocol, "POST /cosmos/tx/v1beta1/txs"))
+	assert.Equal(t, float64(3), costs.Cost(types.RESTProtocol, "GET /cosmos/bank/v1beta1/balances/fx1abc"))
+	assert.Equal(t, float64(2), costs.Cost(types.RESTProtocol, "GET /cosmos/bank/v1beta1/balances/fx1abc/by_denom"))
+	assert.Equal(t, float64(40), costs.Cost(types.EVMRPCProtocol, "eth_getLogs"))
+	assert.Equal(t, float64(5), costs.Cost(types.EVMRPCProtocol, "eth_call"))
+	assert.Equal(t, float64(2), costs.Cost(types.GRPCProtocol, "/cosmos.tx.v1beta1.Service/GetTxsEvent"))
+
+	// a request costing more than the burst needs a full bucket and is charged in full
+	limiter := middleware.NewRateLimiter(config.RateLimit{Enable: true, Rules: map[string]config.RateLimitRule{
+		string(types.EVMRPCProtocol): {RequestsPerSecond: 1, Burst: 10},
+	}}, nil, nil)
+	ok, _ := limiter.Allow(middleware.Identity{Client: "10.0.0.1"}, types.EVMRPCProtocol, types.QueryRoute, limiter.Cost(types.EVMRPCProtocol, "eth_getLogs"))
+	assert.True(t, ok)
+	ok, retryAfter := limiter.Allow(middleware.Identity{Client: "10.0.0.1"}, types.EVMRPCProtocol, types.QueryRoute, limiter.Cost(types.EVMRPCProtocol, "eth_chainId"))
+	assert.False(t, ok)
+	assert.True(t, retryAfter.Seconds() > 10)
+}
+
+func TestRateLimitBatchOverBurst(t *testing.T) {
+	limiter := middleware.NewRateLimiter(config.RateLimit{Enable: true, DefaultCost: 1, Rules: map[string]config.RateLimitRule{
+		string(types.JSONRPCProtocol): {RequestsPerSecond: 10, Burst: 20},
+	}}, nil, nil)
+	client := middleware.Identity{Client: "10.0.0.1"}
+
+	// a batch of 200 calls is admitted on a full bucket, which then owes 180 tokens
+	ok, _ := limiter.Allow(client, types.JSONRPCProtocol, types.QueryRoute, 200)
+	assert.True(t, ok)
+	ok, retryAfter := limiter.Allow(client, types.JSONRPCProtocol, types.QueryRoute, 1)
+	assert.False(t, ok)
+	assert.InDelta(t, 18.1, retryAfter.Seconds(), 0.1)
+	ok, retryAfter = limiter.Allow(client, types.JSONRPCProtocol, types.QueryRoute, 200)
+	assert.False(t, ok)
+	assert.InDelta(t, 20, retryAfter.Seconds(), 0.1)
+}
+
+func TestHTTPClientIP(t *testing.T) {
+	trusted, err := config.ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/status", nil)
+	r.RemoteAddr = "1.2.3.4:5678"
+	r.Header.Set("X-Forwarded-For", "5.6.7.8")
+	assert.Equal(t, "1.2.3.4", middleware.HTTPClientIP(r, trusted))
+
+	r.RemoteAddr = "10.1.1.1:5678"
+	r.Header.Set("X-Forwarded-For", "9.9.9.9, 5.6.7.8, 192.168.1.1")
+	assert.Equal(t, "5.6.7.8", middleware.HTTPClientIP(r, trusted))
+
+	r.Header.Del("X-Forwarded-For")
+	r.Header.Set("X-Real-IP", "5.6.7.8")
+	assert.Equal(t, "5.6.7.8", middleware.HTTPClientIP(r, trusted))
+}
+
+func TestRateLimitClasses(t *testing.T) {
+	limiter := middleware.NewRateLimiter(config.RateLimit{Enable: true, DefaultCost: 1, Rules: map[string]config.RateLimitRule{
+		config.RateLimitRuleKey(types.JSONRPCProtocol, types.QueryRoute):     {RequestsPerSecond: 0.001, Burst: 2},
+		config.RateLimitRuleKey(types.JSONRPCProtocol, types.BroadcastRoute): {RequestsPerSecond: 0.001, Burst: 1},
+	}}, nil, nil)
+	client := middleware.Identity{Client: "10.0.0.1"}
+	batch := map[types.RouteClass]float64{types.QueryRoute: 1, types.BroadcastRoute: 1}
+
+	_, ok, _ := limiter.AllowClasses(client, types.JSONRPCProtocol, batch)
+	assert.True(t, ok)
+	// the broadcast bucket is short, the query bucket is not charged
+	class, ok, _ := limiter.AllowClasses(client, types.JSONRPCProtocol, batch)
+	assert.False(t, ok)
+	assert.Equal(t, types.BroadcastRoute, class)
+	ok, _ = limiter.Allow(client, types.JSONRPCProtocol, types.QueryRoute, 1)
+	assert.True(t, ok)
+	ok, _ = limiter.Allow(client, types.JSONRPCProtocol, types.QueryRoute, 1)
+	assert.False(t, ok)
+}
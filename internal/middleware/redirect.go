@@ -8,11 +8,15 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
 	"github.com/overload-ak/cosmos-firewall/internal/node"
+	"github.com/overload-ak/cosmos-firewall/internal/tracing"
 	"github.com/overload-ak/cosmos-firewall/internal/types"
 )
 
@@ -85,16 +89,36 @@ func NewRedirectClient(ctx context.Context, uri string, httpClient *http.Client,
 	}
 }
 
+// URI returns the URI of the upstream node.
+func (redirect *RedirectClient) URI() string {
+	return redirect.uri
+}
+
 func (redirect *RedirectClient) HttpRedirect(w http.ResponseWriter, r *http.Request, body io.Reader) error {
 	request, err := http.NewRequest(r.Method, fmt.Sprintf("%s%s", redirect.uri, r.URL.RequestURI()), body)
 	if err != nil {
 		return err
 	}
-	request.Header = r.Header
+	ctx, span := tracing.StartClient(r.Context(), tracing.StageUpstream,
+		semconv.NetPeerName(redirect.uri), semconv.HTTPMethod(r.Method), semconv.HTTPTarget(r.URL.Path))
+	defer span.End()
+	request.Header = r.Header.Clone()
+	id := RequestIDFromContext(r.Context())
+	if id != "" {
+		request.Header.Set(RequestIDHeader, id)
+	}
+	tracing.InjectHTTP(ctx, request.Header)
+	inFlight := metrics.UpstreamInFlight.WithLabelValues(redirect.uri)
+	inFlight.Inc()
+	defer inFlight.Dec()
+	start := time.Now()
 	resp, err := redirect.Do(request)
+	metrics.ObserveUpstream(r.Context(), redirect.uri, start, err != nil || resp.StatusCode >= http.StatusInternalServerError)
 	if err != nil {
+		tracing.Fail(span, err)
 		return err
 	}
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
@@ -102,16 +126,36 @@ func (redirect *RedirectClient) HttpRedirect(w http.ResponseWriter, r *http.Requ
 		}
 	}(resp.Body)
 	copyHeader(w.Header(), resp.Header)
+	if id != "" {
+		// the upstream node may echo the request id
+		w.Header().Set(RequestIDHeader, id)
+	}
 	w.WriteHeader(resp.StatusCode)
-	_, err = io.Copy(w, resp.Body)
-	if err != nil {
-		return err
+	if _, err = io.Copy(w, resp.Body); err != nil && !errors.Is(err, ErrResponseTooLarge) {
+		tracing.Fail(span, err)
+		// the upstream status is sent already, the client sees a broken connection instead of
+		// the upstream response followed by an error
+		panic(http.ErrAbortHandler)
 	}
 	return nil
 }
 
-func (redirect *RedirectClient) GrpcRedirect(serverStream grpc.ServerStream, fullMethodName string, frame *types.Frame) error {
-	clientCtx, clientCancel := context.WithCancel(serverStream.Context())
+func (redirect *RedirectClient) GrpcRedirect(serverStream grpc.ServerStream, fullMethodName string, frame *types.Frame) (err error) {
+	inFlight := metrics.UpstreamInFlight.WithLabelValues(redirect.uri)
+	inFlight.Inc()
+	ctx, span := tracing.StartClient(serverStream.Context(), tracing.StageUpstream,
+		semconv.NetPeerName(redirect.uri), semconv.RPCSystemGRPC, semconv.RPCMethod(fullMethodName))
+	defer func(start time.Time) {
+		inFlight.Dec()
+		metrics.ObserveUpstream(serverStream.Context(), redirect.uri, start, isUpstreamFailure(err))
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+		tracing.Fail(span, err)
+		span.End()
+	}(time.Now())
+	if id := RequestIDFromContext(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, RequestIDMetadata, id)
+	}
+	clientCtx, clientCancel := context.WithCancel(tracing.InjectGRPC(ctx))
 	defer clientCancel()
 	clientStream, err := grpc.NewClientStream(clientCtx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, redirect.ClientConn, fullMethodName)
 	if err != nil {
@@ -141,6 +185,16 @@ func (redirect *RedirectClient) GrpcRedirect(serverStream grpc.ServerStream, ful
 	return status.Errorf(codes.Internal, "gRPC forwarder should never reach this stage.")
 }
 
+// isUpstreamFailure reports whether a forwarded gRPC call failed because of the upstream node
+// rather than of the request.
+func isUpstreamFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
 func forwardServerToClient(src grpc.ServerStream, dst grpc.ClientStream, frame *types.Frame) chan error {
 	ret := make(chan error, 1)
 	go func() {
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+)
+
+// RejectionDomain is the domain of the ErrorInfo details of the rejections.
+const RejectionDomain = "cosmos-firewall"
+
+// Code is the stable code of a rejection, reported to clients by every protocol so that
+// they can react to it programmatically.
+type Code string
+
+// Codes of the rejected txs.
+const (
+	CodeInvalidTx              Code = "INVALID_TX"
+	CodeTxTooLarge             Code = "TX_TOO_LARGE"
+	CodeNonCanonicalTx         Code = "NON_CANONICAL_TX"
+	CodeFeeTooLow              Code = "FEE_TOO_LOW"
+	CodeInvalidFee             Code = "INVALID_FEE"
+	CodeInvalidFeePayer        Code = "INVALID_FEE_PAYER"
+	CodeGasTooLow              Code = "GAS_TOO_LOW"
+	CodeGasTooHigh             Code = "GAS_TOO_HIGH"
+	CodeMemoTooLong            Code = "MEMO_TOO_LONG"
+	CodeNoMessages             Code = "NO_MESSAGES"
+	CodeMessageDenied          Code = "MESSAGE_DENIED"
+	CodeTooManyMessages        Code = "TOO_MANY_MESSAGES"
+	CodeInvalidSignature       Code = "INVALID_SIGNATURE"
+	CodeTooManySignatures      Code = "TOO_MANY_SIGNATURES"
+	CodeInvalidSignerInfo      Code = "INVALID_SIGNER_INFO"
+	CodeExtensionDenied        Code = "EXTENSION_DENIED"
+	CodeTimeoutHeightTooFar    Code = "TIMEOUT_HEIGHT_TOO_FAR"
+	CodeReplayUnprotected      Code = "REPLAY_UNPROTECTED"
+	CodeChainIDMismatch        Code = "CHAIN_ID_MISMATCH"
+	CodeContractCreationDenied Code = "CONTRACT_CREATION_DENIED"
+	CodeRecipientDenied        Code = "RECIPIENT_DENIED"
+)
+
+// Codes of the rejected requests.
+const (
+	CodeInvalidRequest     Code = "INVALID_REQUEST"
+	CodeQueryLimitExceeded Code = "QUERY_LIMIT_EXCEEDED"
+	CodeRouteDenied        Code = "ROUTE_DENIED"
+	CodeRouteNotPermitted  Code = "ROUTE_NOT_PERMITTED"
+	CodeUnauthenticated    Code = "UNAUTHENTICATED"
+	CodeIPDenied           Code = "IP_DENIED"
+	CodeBanned             Code = "BANNED"
+	CodeRateLimited        Code = "RATE_LIMITED"
+	CodeSignerLimited      Code = "SIGNER_LIMITED"
+	CodeProofOfWork        Code = "PROOF_OF_WORK_REQUIRED"
+	CodeMempoolFull        Code = "MEMPOOL_FULL"
+	CodeOverloaded         Code = "OVERLOADED"
+	CodeRequestTooLarge    Code = "REQUEST_TOO_LARGE"
+	CodeResponseTooLarge   Code = "RESPONSE_TOO_LARGE"
+)
+
+// JSON-RPC error codes of the rejections, -32005 is the EIP-1474 "limit exceeded".
+const (
+	RPCCodeRejected      = -32000
+	RPCCodeLimitExceeded = -32005
+	RPCCodeNotFound      = -32601
+	RPCCodeInvalidParams = -32602
+)
+
+// Rejection is an error rejecting a request, carrying its code.
+type Rejection struct {
+	Code Code
+	Err  error
+}
+
+// NewRejection returns a rejection with a message, also used for the sentinel errors.
+func NewRejection(code Code, message string) *Rejection {
+	return &Rejection{Code: code, Err: errors.New(message)}
+}
+
+// Rejectf returns a rejection with a formatted message.
+func Rejectf(code Code, format string, args ...interface{}) error {
+	return &Rejection{Code: code, Err: errors.Errorf(format, args...)}
+}
+
+// WrapRejection returns a rejection of err annotated with a formatted message.
+func WrapRejection(code Code, err error, format string, args ...interface{}) error {
+	return &Rejection{Code: code, Err: errors.Wrapf(err, format, args...)}
+}
+
+// AsRejection returns err as a rejection with code unless it carries a rejection already.
+func AsRejection(code Code, err error) error {
+	var rejection *Rejection
+	if err == nil || errors.As(err, &rejection) {
+		return err
+	}
+	return &Rejection{Code: code, Err: err}
+}
+
+func (r *Rejection) Error() string {
+	return r.Err.Error()
+}
+
+func (r *Rejection) Unwrap() error {
+	return r.Err
+}
+
+// CodeOf returns the code of the rejection carried by err, INVALID_REQUEST without one.
+func CodeOf(err error) Code {
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		return rejection.Code
+	}
+	return CodeInvalidRequest
+}
+
+// HTTPStatus returns the HTTP status of a rejection.
+func (c Code) HTTPStatus() int {
+	switch c {
+	case CodeTxTooLarge, CodeRequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeInvalidRequest, CodeQueryLimitExceeded:
+		return http.StatusBadRequest
+	case CodeRouteDenied:
+		return http.StatusMethodNotAllowed
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case CodeRouteNotPermitted, CodeIPDenied, CodeBanned:
+		return http.StatusForbidden
+	case CodeRateLimited, CodeSignerLimited:
+		return http.StatusTooManyRequests
+	case CodeProofOfWork:
+		return http.StatusPreconditionRequired
+	case CodeMempoolFull, CodeOverloaded:
+		return http.StatusServiceUnavailable
+	case CodeResponseTooLarge:
+		return http.StatusBadGateway
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// GRPCCode returns the gRPC status code of a rejection.
+func (c Code) GRPCCode() codes.Code {
+	switch c {
+	case CodeRouteDenied:
+		return codes.Unimplemented
+	case CodeUnauthenticated:
+		return codes.Unauthenticated
+	case CodeRouteNotPermitted, CodeIPDenied, CodeBanned:
+		return codes.PermissionDenied
+	case CodeRateLimited, CodeSignerLimited, CodeRequestTooLarge, CodeResponseTooLarge:
+		return codes.ResourceExhausted
+	case CodeProofOfWork:
+		return codes.FailedPrecondition
+	case CodeMempoolFull, CodeOverloaded:
+		return codes.Unavailable
+	}
+	return codes.InvalidArgument
+}
+
+// RPCCode returns the JSON-RPC error code of a rejection.
+func (c Code) RPCCode() int {
+	switch c {
+	case CodeInvalidRequest:
+		return RPCCodeInvalidParams
+	case CodeRouteDenied:
+		return RPCCodeNotFound
+	case CodeQueryLimitExceeded, CodeRateLimited, CodeSignerLimited, CodeMempoolFull, CodeOverloaded,
+		CodeRequestTooLarge, CodeResponseTooLarge:
+		return RPCCodeLimitExceeded
+	}
+	return RPCCodeRejected
+}
+
+// Reason returns the reason a rejection is counted under in the bans and the metrics.
+func (c Code) Reason() string {
+	switch c {
+	case CodeInvalidRequest, CodeQueryLimitExceeded:
+		return RejectInvalidRequest
+	case CodeRouteDenied, CodeRouteNotPermitted:
+		return RejectRouteDenied
+	case CodeUnauthenticated:
+		return RejectInvalidAPIKey
+	case CodeIPDenied:
+		return RejectIPDenied
+	case CodeBanned:
+		return RejectBanned
+	case CodeRateLimited:
+		return RejectRateLimited
+	case CodeSignerLimited:
+		return RejectSignerLimited
+	case CodeProofOfWork:
+		return RejectProofOfWork
+	case CodeMempoolFull:
+		return RejectMempoolFull
+	case CodeOverloaded:
+		return RejectOverloaded
+	case CodeRequestTooLarge, CodeResponseTooLarge:
+		return RejectTooLarge
+	}
+	return RejectInvalidTx
+}
+
+// HeldAgainstClient reports whether a rejection counts towards the ban of the client.
+func (c Code) HeldAgainstClient() bool {
+	switch c.Reason() {
+	case RejectIPDenied, RejectBanned, RejectProofOfWork, RejectTooLarge, RejectOverloaded, RejectMempoolFull:
+		return false
+	}
+	return true
+}
+
+// RecordRejectionOf counts a rejection under the reason of its code, towards the ban of the
+// client IP when it is held against the client.
+func (v Validator) RecordRejectionOf(ctx context.Context, client string, err error) {
+	code := CodeOf(err)
+	if !code.HeldAgainstClient() {
+		v.CountRejection(code.Reason())
+		return
+	}
+	v.RecordRejection(ctx, client, code.Reason())
+}
@@ -0,0 +1,69 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestRejectionCodes(t *testing.T) {
+	cfg := config.DefaultConfig()
+	validator := middleware.NewValidator(cfg)
+
+	assert.Equal(t, middleware.CodeTooManyMessages, middleware.CodeOf(validator.CheckTx(newTestTx(t, config.DefaultMaxMessages+1, 200000, 1))))
+	assert.Equal(t, middleware.CodeGasTooHigh, middleware.CodeOf(validator.CheckTx(newTestTx(t, 2, config.DefaultMaxGasLimit+1, 1))))
+	assert.Equal(t, middleware.CodeTooManySignatures, middleware.CodeOf(validator.CheckTx(newTestTx(t, 2, 200000, config.DefaultMaxSignatures+1))))
+	memoTooLong := newTestTx(t, 1, 200000, 1)
+	memoTooLong.Body.Memo = strings.Repeat("m", cfg.Chain.MaxMemo+1)
+	err := validator.CheckTx(memoTooLong)
+	assert.Equal(t, middleware.CodeMemoTooLong, middleware.CodeOf(err))
+	assert.Contains(t, err.Error(), "memo field length exceeds limit")
+	assert.Equal(t, middleware.CodeInvalidTx, middleware.CodeOf(validator.CheckTxBytes(context.Background(), []byte{0xff})))
+
+	evm := cfg.Chain.EVM
+	evm.ChainID = testEVMChainID
+	evm.MinimumGasPrice = "500000000000"
+	to := "0x2407900b68B18dBcf9ee9dC43110Ad422695305c"
+	assert.Equal(t, middleware.CodeFeeTooLow, middleware.CodeOf(middleware.CheckEthereumTxData(newLegacyTx(testEVMChainID, 1, 21000, to), evm)))
+	assert.Equal(t, middleware.CodeChainIDMismatch, middleware.CodeOf(middleware.CheckEthereumTxData(newLegacyTx(1, 500000000000, 21000, to), evm)))
+
+	banned := errors.Wrapf(middleware.ErrBanned, "signer %s", "fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy")
+	assert.ErrorIs(t, banned, middleware.ErrBanned)
+	assert.Equal(t, middleware.CodeBanned, middleware.CodeOf(banned))
+	assert.Equal(t, middleware.CodeInvalidRequest, middleware.CodeOf(errors.New("invalid params")))
+	assert.Equal(t, middleware.CodeSignerLimited, middleware.CodeOf(middleware.AsRejection(middleware.CodeInvalidTx, middleware.ErrSignerLimited)))
+}
+
+func TestRejectionMapping(t *testing.T) {
+	for _, tc := range []struct {
+		code     middleware.Code
+		status   int
+		grpcCode codes.Code
+		rpcCode  int
+		reason   string
+	}{
+		{middleware.CodeFeeTooLow, http.StatusUnprocessableEntity, codes.InvalidArgument, middleware.RPCCodeRejected, middleware.RejectInvalidTx},
+		{middleware.CodeTxTooLarge, http.StatusRequestEntityTooLarge, codes.InvalidArgument, middleware.RPCCodeRejected, middleware.RejectInvalidTx},
+		{middleware.CodeInvalidRequest, http.StatusBadRequest, codes.InvalidArgument, middleware.RPCCodeInvalidParams, middleware.RejectInvalidRequest},
+		{middleware.CodeRouteDenied, http.StatusMethodNotAllowed, codes.Unimplemented, middleware.RPCCodeNotFound, middleware.RejectRouteDenied},
+		{middleware.CodeUnauthenticated, http.StatusUnauthorized, codes.Unauthenticated, middleware.RPCCodeRejected, middleware.RejectInvalidAPIKey},
+		{middleware.CodeRateLimited, http.StatusTooManyRequests, codes.ResourceExhausted, middleware.RPCCodeLimitExceeded, middleware.RejectRateLimited},
+		{middleware.CodeProofOfWork, http.StatusPreconditionRequired, codes.FailedPrecondition, middleware.RPCCodeRejected, middleware.RejectProofOfWork},
+		{middleware.CodeMempoolFull, http.StatusServiceUnavailable, codes.Unavailable, middleware.RPCCodeLimitExceeded, middleware.RejectMempoolFull},
+	} {
+		assert.Equal(t, tc.status, tc.code.HTTPStatus(), tc.code)
+		assert.Equal(t, tc.grpcCode, tc.code.GRPCCode(), tc.code)
+		assert.Equal(t, tc.rpcCode, tc.code.RPCCode(), tc.code)
+		assert.Equal(t, tc.reason, tc.code.Reason(), tc.code)
+	}
+	assert.True(t, middleware.CodeFeeTooLow.HeldAgainstClient())
+	assert.False(t, middleware.CodeMempoolFull.HeldAgainstClient())
+}
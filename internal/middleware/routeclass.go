@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// healthRoutes are the routes polled by health checks and load balancers, keyed by protocol:
+// JSON-RPC URI paths, gRPC full method names, REST paths and ethereum JSON-RPC methods.
+var healthRoutes = map[types.Protocol]map[string]bool{
+	types.JSONRPCProtocol: {"/health": true, "/status": true},
+	types.GRPCProtocol: {
+		"/cosmos.base.tendermint.v1beta1.Service/GetSyncing":  true,
+		"/cosmos.base.tendermint.v1beta1.Service/GetNodeInfo": true,
+		"/grpc.health.v1.Health/Check":                        true,
+	},
+	types.RESTProtocol: {
+		"/cosmos/base/tendermint/v1beta1/syncing":   true,
+		"/cosmos/base/tendermint/v1beta1/node_info": true,
+		"/syncing":   true,
+		"/node_info": true,
+	},
+	types.EVMRPCProtocol: {"eth_syncing": true, "net_version": true, "eth_chainId": true, "web3_clientVersion": true},
+}
+
+// IsHealthRoute reports whether the route is polled by health checks.
+func IsHealthRoute(protocol types.Protocol, route string) bool {
+	return healthRoutes[protocol][route]
+}
+
+// routeClassPriority orders the route classes by how much they cost to retry.
+var routeClassPriority = map[types.RouteClass]int{
+	types.QueryRoute:     0,
+	types.SimulateRoute:  1,
+	types.BroadcastRoute: 2,
+}
+
+// LowestRouteClass returns the route class cheapest to retry of the calls of a batch.
+func LowestRouteClass(classes []types.RouteClass) types.RouteClass {
+	if len(classes) == 0 {
+		return types.QueryRoute
+	}
+	lowest := classes[0]
+	for _, class := range classes[1:] {
+		if routeClassPriority[class] < routeClassPriority[lowest] {
+			lowest = class
+		}
+	}
+	return lowest
+}
+
+func JSONRPCRouteClass(method string) types.RouteClass {
+	switch strings.TrimPrefix(method, "/") {
+	case "broadcast_tx_commit", "broadcast_tx_sync", "broadcast_tx_async":
+		return types.BroadcastRoute
+	case "check_tx":
+		return types.SimulateRoute
+	}
+	return types.QueryRoute
+}
+
+func GRPCRouteClass(fullMethodName string) types.RouteClass {
+	switch fullMethodName {
+	case "/cosmos.tx.v1beta1.Service/BroadcastTx":
+		return types.BroadcastRoute
+	case "/cosmos.tx.v1beta1.Service/Simulate":
+		return types.SimulateRoute
+	}
+	return types.QueryRoute
+}
+
+func RESTRouteClass(method, path string) types.RouteClass {
+	switch {
+	case method == http.MethodPost && (path == "/cosmos/tx/v1beta1/txs" || path == "/txs"):
+		return types.BroadcastRoute
+	case path == "/cosmos/tx/v1beta1/simulate":
+		return types.SimulateRoute
+	}
+	return types.QueryRoute
+}
+
+func EVMRPCRouteClass(method string) types.RouteClass {
+	switch method {
+	case "eth_sendRawTransaction":
+		return types.BroadcastRoute
+	case "eth_call", "eth_estimateGas":
+		return types.SimulateRoute
+	}
+	return types.QueryRoute
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+// defaultRouteCosts are the costs of routes that are much heavier than a plain query,
+// applied to the routes the chain actually serves. Broadcast routes are left at the
+// default cost since they are throttled by their own route class.
+var defaultRouteCosts = map[types.Protocol]map[string]float64{
+	types.JSONRPCProtocol: {
+		"/tx_search":            20,
+		"/block_search":         20,
+		"/block_results":        10,
+		"/blockchain":           5,
+		"/genesis":              50,
+		"/genesis_chunked":      10,
+		"/dump_consensus_state": 10,
+		"/consensus_state":      5,
+		"/unconfirmed_txs":      5,
+		"/validators":           2,
+		"/check_tx":             5,
+		"/abci_query":           2,
+	},
+	types.GRPCProtocol: {
+		"/cosmos.tx.v1beta1.Service/GetTxsEvent":                          20,
+		"/cosmos.tx.v1beta1.Service/GetBlockWithTxs":                      10,
+		"/cosmos.tx.v1beta1.Service/Simulate":                             5,
+		"/cosmos.base.tendermint.v1beta1.Service/GetValidatorSetByHeight": 2,
+		"/cosmos.base.tendermint.v1beta1.Service/GetLatestValidatorSet":   2,
+		"/cosmos.staking.v1beta1.Query/Validators":                        5,
+		"/cosmos.staking.v1beta1.Query/ValidatorDelegations":              5,
+		"/cosmos.bank.v1beta1.Query/DenomOwners":                          5,
+		"/cosmos.gov.v1beta1.Query/Proposals":                             5,
+		"/cosmos.gov.v1.Query/Proposals":                                  5,
+	},
+	// REST costs only apply to GET, POST to the txs routes is a broadcast
+	types.RESTProtocol: {
+		"/cosmos/tx/v1beta1/txs":                20,
+		"/cosmos/tx/v1beta1/txs/block/{height}": 10,
+		"/txs":                                  20,
+		"/cosmos/staking/v1beta1/validators":    5,
+		"/cosmos/staking/v1beta1/validators/{validator_addr}/delegations": 5,
+		"/cosmos/bank/v1beta1/denom_owners/{denom}":                       5,
+		"/cosmos/gov/v1beta1/proposals":                                   5,
+		"/cosmos/gov/v1/proposals":                                        5,
+	},
+	types.EVMRPCProtocol: {
+		"eth_getLogs":              20,
+		"eth_call":                 5,
+		"eth_estimateGas":          5,
+		"eth_getBlockByNumber":     2,
+		"eth_getBlockByHash":       2,
+		"debug_traceTransaction":   50,
+		"debug_traceBlockByNumber": 100,
+		"debug_traceBlockByHash":   100,
+		"debug_traceCall":          50,
+	},
+}
+
+// RouteCosts is the number of rate limit units charged for a request to a route.
+type RouteCosts struct {
+	defaultCost float64
+	routes      map[types.Protocol]map[string]float64
+	restRoutes  []restRouteCost
+}
+
+type restRouteCost struct {
+	method  string
+	pattern types.PathPattern
+	cost    float64
+}
+
+// NewRouteCosts builds the cost table from the defaults of the routes served by the
+// chain's routers, overridden by the configured costs. routers may be nil.
+func NewRouteCosts(cfg config.RateLimit, routers *Routers) *RouteCosts {
+	costs := &RouteCosts{defaultCost: cfg.DefaultCost, routes: make(map[types.Protocol]map[string]float64)}
+	if costs.defaultCost <= 0 {
+		costs.defaultCost = 1
+	}
+	if routers != nil {
+		costs.addDefaults(types.JSONRPCProtocol, routers.GetRPCRouters())
+		costs.addDefaults(types.GRPCProtocol, routers.GetGRPCRouters())
+		costs.addDefaults(types.RESTProtocol, routers.GetRESTRouters())
+	}
+	for route, cost := range defaultRouteCosts[types.EVMRPCProtocol] {
+		costs.set(types.EVMRPCProtocol, route, cost)
+	}
+	for _, routeCost := range cfg.Costs {
+		costs.set(types.Protocol(routeCost.Protocol), routeCost.Route, routeCost.Cost)
+	}
+	return costs
+}
+
+// Cost returns the cost of a route: a JSON-RPC URI path ("/tx_search"), a gRPC full method
+// name, an ethereum JSON-RPC method, or for REST the HTTP method and the request path
+// separated by a space ("GET /cosmos/tx/v1beta1/txs").
+func (c *RouteCosts) Cost(protocol types.Protocol, route string) float64 {
+	if protocol == types.RESTProtocol {
+		method, path := splitRESTRoute(route)
+		for _, restRoute := range c.restRoutes {
+			if (restRoute.method == "" || strings.EqualFold(restRoute.method, method)) && restRoute.pattern.Match(path) {
+				return restRoute.cost
+			}
+		}
+		return c.defaultCost
+	}
+	if cost, ok := c.routes[protocol][route]; ok {
+		return cost
+	}
+	return c.defaultCost
+}
+
+func (c *RouteCosts) addDefaults(protocol types.Protocol, routes []string) {
+	for _, route := range routes {
+		for defaultRoute, cost := range defaultRouteCosts[protocol] {
+			if !strings.EqualFold(route, defaultRoute) {
+				continue
+			}
+			if protocol == types.RESTProtocol {
+				route = http.MethodGet + " " + route
+			}
+			c.set(protocol, route, cost)
+			break
+		}
+	}
+}
+
+func (c *RouteCosts) set(protocol types.Protocol, route string, cost float64) {
+	if protocol == types.RESTProtocol {
+		// configured routes are checked before the defaults
+		method, path := splitRESTRoute(route)
+		for i, restRoute := range c.restRoutes {
+			if restRoute.method == method && restRoute.pattern.Pattern == path {
+				c.restRoutes = append(c.restRoutes[:i], c.restRoutes[i+1:]...)
+				break
+			}
+		}
+		restRoute := restRouteCost{method: method, pattern: types.NewPathPattern(path), cost: cost}
+		c.restRoutes = append([]restRouteCost{restRoute}, c.restRoutes...)
+		return
+	}
+	if c.routes[protocol] == nil {
+		c.routes[protocol] = make(map[string]float64)
+	}
+	c.routes[protocol][route] = cost
+}
+
+// splitRESTRoute splits "GET /path" into its method and path, the method is empty for "/path".
+func splitRESTRoute(route string) (string, string) {
+	if method, path, ok := strings.Cut(route, " "); ok {
+		return strings.ToUpper(method), strings.TrimSpace(path)
+	}
+	return "", route
+}
@@ -1,25 +1,39 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/cosmos/cosmos-sdk/client"
 	"github.com/cosmos/cosmos-sdk/server/api"
 	srvconfig "github.com/cosmos/cosmos-sdk/server/config"
+	"github.com/gogo/protobuf/proto"
 	"github.com/gorilla/mux"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/pkg/errors"
 	"github.com/tendermint/tendermint/rpc/core"
 	"github.com/tendermint/tendermint/rpc/jsonrpc/server"
+	"google.golang.org/grpc"
 
 	"github.com/overload-ak/cosmos-firewall/internal/application"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
 )
 
+var ErrRouteDenied = NewRejection(CodeRouteDenied, "method not allowed")
+
 type Routers struct {
 	application.Application
 	rpcRouters, grpcRouters, restRouters []string
+
+	grpcRequestTypesOnce sync.Once
+	grpcRequestTypes     map[string]reflect.Type
+	restPatternsOnce     sync.Once
+	restPatterns         []types.PathPattern
 }
 
 func NewRouters(chainId string) (*Routers, error) {
@@ -51,6 +65,16 @@ func (r *Routers) GetRESTRouters() []string {
 	return r.getRESTRouters()
 }
 
+// GetRESTPatterns returns the path patterns of the REST routers.
+func (r *Routers) GetRESTPatterns() []types.PathPattern {
+	r.restPatternsOnce.Do(func() {
+		for _, p := range r.GetRESTRouters() {
+			r.restPatterns = append(r.restPatterns, types.NewPathPattern(p))
+		}
+	})
+	return r.restPatterns
+}
+
 func (r *Routers) getRPCRouters() []string {
 	mu := http.NewServeMux()
 	server.RegisterRPCFuncs(mu, core.Routes, nil)
@@ -101,3 +125,41 @@ func (r *Routers) getRESTRouters() []string {
 	}
 	return r.restRouters
 }
+
+// NewGRPCRequest returns a new request message of a gRPC query method served by the app.
+func (r *Routers) NewGRPCRequest(fullMethodName string) (proto.Message, bool) {
+	r.grpcRequestTypesOnce.Do(func() {
+		r.grpcRequestTypes = r.getGRPCRequestTypes()
+	})
+	requestType, ok := r.grpcRequestTypes[fullMethodName]
+	if !ok {
+		return nil, false
+	}
+	msg, ok := reflect.New(requestType).Interface().(proto.Message)
+	return msg, ok
+}
+
+// getGRPCRequestTypes resolves the request types of the query services by calling the
+// method handlers with a decoder that records the message they decode into.
+func (r *Routers) getGRPCRequestTypes() map[string]reflect.Type {
+	// registers the tx, node and tendermint services
+	r.GetGRPCRouters()
+	requestTypes := make(map[string]reflect.Type)
+	errDecoded := errors.New("decoded")
+	serviceData := reflect.Indirect(reflect.ValueOf(r.GRPCQueryRouter())).FieldByName("serviceData")
+	for i := 0; i < serviceData.Len(); i++ {
+		field := serviceData.Index(i).Field(0)
+		serviceDesc := reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Interface().(*grpc.ServiceDesc)
+		for _, method := range serviceDesc.Methods {
+			var requestType reflect.Type
+			_, _ = method.Handler(nil, context.Background(), func(in interface{}) error {
+				requestType = reflect.TypeOf(in)
+				return errDecoded
+			}, nil)
+			if requestType != nil && requestType.Kind() == reflect.Ptr {
+				requestTypes[fmt.Sprintf("/%s/%s", serviceDesc.ServiceName, method.MethodName)] = requestType.Elem()
+			}
+		}
+	}
+	return requestTypes
+}
@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	cryptotypes "github.com/cosmos/cosmos-sdk/crypto/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+)
+
+var ErrSignerLimited = NewRejection(CodeSignerLimited, "signer limit exceeded")
+
+// SignerLimiter enforces sliding window limits on the txs broadcast by a signer and on the
+// messages of a type signed by a signer, keyed by the bech32 string of the signer, or by
+// the client key of the txs without signers, see Validator.chargedSigners.
+type SignerLimiter struct {
+	broadcast signerQuota
+	quotas    map[string]signerQuota
+	trusted   map[string]struct{}
+
+	mu        sync.Mutex
+	windows   map[string]*slidingWindow
+	lastSweep time.Time
+}
+
+type signerQuota struct {
+	limit  int
+	window time.Duration
+}
+
+type slidingWindow struct {
+	window time.Duration
+	events []time.Time
+}
+
+func NewSignerLimiter(cfg config.SignerLimit) (*SignerLimiter, error) {
+	trustedAddresses, err := config.ParseAccAddresses(cfg.TrustedAddresses)
+	if err != nil {
+		return nil, err
+	}
+	limiter := &SignerLimiter{
+		broadcast: signerQuota{limit: cfg.BroadcastLimit, window: time.Duration(cfg.WindowSecond) * time.Second},
+		quotas:    make(map[string]signerQuota, len(cfg.MessageQuotas)),
+		trusted:   make(map[string]struct{}, len(trustedAddresses)),
+		windows:   make(map[string]*slidingWindow),
+		lastSweep: time.Now(),
+	}
+	for _, quota := range cfg.MessageQuotas {
+		limiter.quotas[quota.TypeURL] = signerQuota{limit: quota.Limit, window: time.Duration(quota.WindowSecond) * time.Second}
+	}
+	for _, address := range trustedAddresses {
+		limiter.trusted[address.String()] = struct{}{}
+	}
+	return limiter, nil
+}
+
+// Allow records a broadcast tx, given the type urls of the messages signed by each signer.
+// Nothing is recorded when any signer is over a limit.
+func (l *SignerLimiter) Allow(signers map[string][]string) error {
+	type charge struct {
+		signer  string
+		typeURL string
+		quota   signerQuota
+		n       int
+	}
+	var charges []charge
+	for signer, typeURLs := range signers {
+		if _, ok := l.trusted[signer]; ok {
+			continue
+		}
+		if l.broadcast.limit > 0 {
+			charges = append(charges, charge{signer: signer, quota: l.broadcast, n: 1})
+		}
+		counts := make(map[string]int)
+		for _, typeURL := range typeURLs {
+			counts[typeURL]++
+		}
+		for typeURL, n := range counts {
+			if quota, ok := l.quotas[typeURL]; ok {
+				charges = append(charges, charge{signer: signer, typeURL: typeURL, quota: quota, n: n})
+			}
+		}
+	}
+	if len(charges) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	for _, c := range charges {
+		key := c.typeURL + "|" + c.signer
+		window, ok := l.windows[key]
+		if !ok {
+			window = &slidingWindow{window: c.quota.window}
+			l.windows[key] = window
+		}
+		window.expire(now)
+		if len(window.events)+c.n <= c.quota.limit {
+			continue
+		}
+		if c.typeURL == "" {
+			return errors.Wrapf(ErrSignerLimited, "%s exceeded %d broadcasts per %s", c.signer, c.quota.limit, c.quota.window)
+		}
+		return errors.Wrapf(ErrSignerLimited, "%s exceeded %d %s messages per %s", c.signer, c.quota.limit, c.typeURL, c.quota.window)
+	}
+	for _, c := range charges {
+		window := l.windows[c.typeURL+"|"+c.signer]
+		for i := 0; i < c.n; i++ {
+			window.events = append(window.events, now)
+		}
+	}
+	return nil
+}
+
+// expire drops the events that left the window.
+func (w *slidingWindow) expire(now time.Time) {
+	i := 0
+	for i < len(w.events) && now.Sub(w.events[i]) >= w.window {
+		i++
+	}
+	w.events = w.events[i:]
+}
+
+// sweep drops the windows of signers without events in their window.
+func (l *SignerLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, window := range l.windows {
+		if window.expire(now); len(window.events) == 0 {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// ClientSignerKey returns the key of the signer limits of the txs of a client IP without
+// signer infos.
+func ClientSignerKey(client string) string {
+	return "ip:" + client
+}
+
+// ProvenTxSigners returns the type urls of the messages of a tx per signer proven by a
+// signature, the sender of an ethereum tx recovered from its signature, and the type urls
+// of the other messages. The signers named by cosmos messages are not proven: their
+// signatures can not be verified without the account numbers of the signers, so anyone may
+// name any address.
+func (v Validator) ProvenTxSigners(txBody tx.TxBody) (map[string][]string, []string, error) {
+	signers := make(map[string][]string)
+	var unproven []string
+	for _, message := range txBody.Messages {
+		if message.TypeUrl != MsgEthereumTxTypeURL {
+			unproven = append(unproven, message.TypeUrl)
+			continue
+		}
+		txData, err := UnpackEthereumTxData(message)
+		if err != nil {
+			return nil, nil, err
+		}
+		sender, err := ethereumTxSender(ethtypes.NewTx(txData.AsEthereumData()))
+		if err != nil {
+			return nil, nil, err
+		}
+		address := sdk.AccAddress(sender.Bytes()).String()
+		signers[address] = append(signers[address], message.TypeUrl)
+	}
+	return signers, unproven, nil
+}
+
+// chargedSigners returns the signers charged for a tx of a client by the signer limits: the
+// proven signers, and the addresses of the public keys of the signer infos for the other
+// messages. These keys are not verified either, but the node rejects the tx unless it is
+// signed by them. The client key is charged for the txs without signer infos.
+func (v Validator) chargedSigners(client string, authInfo tx.AuthInfo, proven map[string][]string, unproven []string) (map[string][]string, error) {
+	if len(unproven) == 0 {
+		return proven, nil
+	}
+	addresses, err := v.signerInfoAddresses(authInfo)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		addresses = []string{ClientSignerKey(client)}
+	}
+	charged := make(map[string][]string, len(proven)+len(addresses))
+	for signer, typeURLs := range proven {
+		charged[signer] = typeURLs
+	}
+	for _, address := range addresses {
+		charged[address] = append(charged[address], unproven...)
+	}
+	return charged, nil
+}
+
+// signerInfoAddresses returns the bech32 addresses of the public keys of the signer infos of a tx.
+func (v Validator) signerInfoAddresses(authInfo tx.AuthInfo) ([]string, error) {
+	addresses := make([]string, 0, len(authInfo.SignerInfos))
+	for _, info := range authInfo.SignerInfos {
+		if info == nil || info.PublicKey == nil {
+			continue
+		}
+		var pubKey cryptotypes.PubKey
+		if err := v.Routers.InterfaceRegistry().UnpackAny(info.PublicKey, &pubKey); err != nil {
+			return nil, errors.Wrapf(err, "unpack public key")
+		}
+		addresses = append(addresses, sdk.AccAddress(pubKey.Address()).String())
+	}
+	return addresses, nil
+}
+
+func ethereumTxSender(ethTx *ethtypes.Transaction) (common.Address, error) {
+	sender, err := ethtypes.LatestSignerForChainID(ethTx.ChainId()).Sender(ethTx)
+	if err != nil {
+		return common.Address{}, WrapRejection(CodeInvalidSignature, err, "recover ethereum tx sender")
+	}
+	return sender, nil
+}
@@ -0,0 +1,111 @@
+package middleware_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	cryptotypes "github.com/cosmos/cosmos-sdk/crypto/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/ethereum/go-ethereum/common"
+	ethtypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+)
+
+func TestSignerLimiter(t *testing.T) {
+	signer, trusted := sdk.AccAddress([]byte("signer______________")), sdk.AccAddress([]byte("trusted_____________"))
+	proposal := "/cosmos.gov.v1beta1.MsgSubmitProposal"
+	limiter, err := middleware.NewSignerLimiter(config.SignerLimit{
+		Enable:           true,
+		BroadcastLimit:   3,
+		WindowSecond:     60,
+		MessageQuotas:    []config.MessageQuota{{TypeURL: proposal, Limit: 1, WindowSecond: 3600}},
+		TrustedAddresses: []string{common.BytesToAddress(trusted).Hex()},
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, limiter.Allow(map[string][]string{signer.String(): {proposal}}))
+	// the proposal quota is spent, the rejected tx is not charged to the broadcast limit
+	assert.Error(t, limiter.Allow(map[string][]string{signer.String(): {proposal}}))
+	assert.NoError(t, limiter.Allow(map[string][]string{signer.String(): {"/cosmos.bank.v1beta1.MsgSend"}}))
+	assert.NoError(t, limiter.Allow(map[string][]string{signer.String(): {"/cosmos.bank.v1beta1.MsgSend"}}))
+	assert.Error(t, limiter.Allow(map[string][]string{signer.String(): {"/cosmos.bank.v1beta1.MsgSend"}}))
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, limiter.Allow(map[string][]string{trusted.String(): {proposal}}))
+	}
+
+	_, err = middleware.NewSignerLimiter(config.SignerLimit{TrustedAddresses: []string{"fx1invalid"}})
+	assert.Error(t, err)
+}
+
+func TestCheckBroadcastEthereumRawTx(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Chain.EVM.ChainID = testEVMChainID
+	cfg.SignerLimit.Enable = true
+	cfg.SignerLimit.BroadcastLimit = 1
+	validator := middleware.NewValidator(cfg)
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	to := common.HexToAddress("0x2407900b68B18dBcf9ee9dC43110Ad422695305c")
+	signer := ethtypes.LatestSignerForChainID(big.NewInt(testEVMChainID))
+	for nonce := uint64(0); nonce < 2; nonce++ {
+		ethTx, err := ethtypes.SignNewTx(key, signer, &ethtypes.LegacyTx{Nonce: nonce, GasPrice: big.NewInt(500000000000), Gas: 21000, To: &to, Value: big.NewInt(1)})
+		require.NoError(t, err)
+		rawTx, err := ethTx.MarshalBinary()
+		require.NoError(t, err)
+		if nonce == 0 {
+			assert.NoError(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx))
+		} else {
+			assert.ErrorContains(t, validator.CheckBroadcastEthereumRawTx(context.Background(), rawTx), "exceeded 1 broadcasts")
+			assert.NoError(t, validator.CheckEthereumRawTx(rawTx))
+		}
+	}
+}
+
+func TestProvenTxSigners(t *testing.T) {
+	validator := middleware.NewValidator(config.DefaultConfig())
+	// the signers named by cosmos messages are not proven
+	proven, unproven, err := validator.ProvenTxSigners(*newTestTx(t, 2, 100000, 1).Body)
+	require.NoError(t, err)
+	assert.Empty(t, proven)
+	assert.Equal(t, []string{"/cosmos.bank.v1beta1.MsgSend", "/cosmos.bank.v1beta1.MsgSend"}, unproven)
+}
+
+func TestCheckBroadcastTxBytesSignerInfos(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.SignerLimit.Enable = true
+	cfg.SignerLimit.BroadcastLimit = 1
+	cfg.Chain.MinimumFee = "1FX"
+	validator := middleware.NewValidator(cfg)
+
+	newTxBytes := func(signerInfos bool) ([]byte, string) {
+		decodedTx := newTestTx(t, 1, 200000, 1)
+		decodedTx.AuthInfo.Fee.Amount = sdk.NewCoins(sdk.NewInt64Coin("FX", 4000))
+		pubKey := decodedTx.AuthInfo.SignerInfos[0].PublicKey.GetCachedValue().(cryptotypes.PubKey)
+		if !signerInfos {
+			decodedTx.AuthInfo.SignerInfos = nil
+		}
+		return newTestTxBytes(t, decodedTx), sdk.AccAddress(pubKey.Address()).String()
+	}
+
+	// the txs of an account are charged to the address of its public key, whatever the client IP
+	txBytes, address := newTxBytes(true)
+	assert.NoError(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.1", txBytes))
+	assert.ErrorContains(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.2", txBytes), address+" exceeded 1 broadcasts")
+	otherTxBytes, _ := newTxBytes(true)
+	assert.NoError(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.1", otherTxBytes))
+
+	// the txs without signer infos are charged to the client IP
+	cfg.Chain.SignerInfos = 0
+	txBytes, _ = newTxBytes(false)
+	assert.NoError(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.1", txBytes))
+	assert.NoError(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.2", txBytes))
+	assert.ErrorContains(t, validator.CheckBroadcastTxBytes(context.Background(), "10.0.0.1", txBytes), "ip:10.0.0.1 exceeded 1 broadcasts")
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+var (
+	ErrRequestTooLarge  = NewRejection(CodeRequestTooLarge, "request too large")
+	ErrResponseTooLarge = NewRejection(CodeResponseTooLarge, "upstream response too large")
+)
+
+// SizeLimits resolves the request size limit of a route and the response size limit of a protocol.
+type SizeLimits struct {
+	requests   map[types.Protocol]int64
+	responses  map[types.Protocol]int64
+	routes     map[types.Protocol]map[string]int64
+	restRoutes []restRouteSizeLimit
+}
+
+type restRouteSizeLimit struct {
+	pattern types.PathPattern
+	limit   int64
+}
+
+func NewSizeLimits(cfg config.SizeLimit) *SizeLimits {
+	limits := &SizeLimits{
+		requests:  make(map[types.Protocol]int64, len(cfg.MaxRequestBytes)),
+		responses: make(map[types.Protocol]int64, len(cfg.MaxResponseBytes)),
+		routes:    make(map[types.Protocol]map[string]int64),
+	}
+	for protocol, limit := range cfg.MaxRequestBytes {
+		limits.requests[types.Protocol(protocol)] = limit
+	}
+	for protocol, limit := range cfg.MaxResponseBytes {
+		limits.responses[types.Protocol(protocol)] = limit
+	}
+	for _, route := range cfg.Routes {
+		protocol := types.Protocol(route.Protocol)
+		if protocol == types.RESTProtocol {
+			limits.restRoutes = append(limits.restRoutes, restRouteSizeLimit{pattern: types.NewPathPattern(route.Route), limit: route.MaxRequestBytes})
+			continue
+		}
+		if limits.routes[protocol] == nil {
+			limits.routes[protocol] = make(map[string]int64)
+		}
+		limits.routes[protocol][route.Route] = route.MaxRequestBytes
+	}
+	return limits
+}
+
+// MaxRequestBytes returns the request size limit of a route, a JSON-RPC URI path, a gRPC
+// full method name or a REST path, 0 for no limit.
+func (l *SizeLimits) MaxRequestBytes(protocol types.Protocol, route string) int64 {
+	if protocol == types.RESTProtocol {
+		for _, restRoute := range l.restRoutes {
+			if restRoute.pattern.Match(route) {
+				return restRoute.limit
+			}
+		}
+	}
+	if limit, ok := l.routes[protocol][route]; ok {
+		return limit
+	}
+	return l.requests[protocol]
+}
+
+// MaxResponseBytes returns the upstream response size limit of a protocol, 0 for no limit.
+func (l *SizeLimits) MaxResponseBytes(protocol types.Protocol) int64 {
+	return l.responses[protocol]
+}
+
+// GRPCMaxRecvBytes returns the maximum message size received by the gRPC server, the largest
+// of the gRPC request limits since the limits of the routes are checked by the handler.
+func (l *SizeLimits) GRPCMaxRecvBytes() int {
+	limit := l.requests[types.GRPCProtocol]
+	for _, routeLimit := range l.routes[types.GRPCProtocol] {
+		if limit == 0 || routeLimit == 0 {
+			limit = 0
+			break
+		}
+		if routeLimit > limit {
+			limit = routeLimit
+		}
+	}
+	if limit == 0 {
+		return math.MaxInt32
+	}
+	return int(limit)
+}
+
+// GRPCMaxSendBytes returns the maximum message size sent by the gRPC server.
+func (l *SizeLimits) GRPCMaxSendBytes() int {
+	if limit := l.responses[types.GRPCProtocol]; limit > 0 {
+		return int(limit)
+	}
+	return math.MaxInt32
+}
+
+// CheckGRPCRequestSize checks the size of a received message against the limit of its method.
+func (v Validator) CheckGRPCRequestSize(fullMethodName string, size int) error {
+	if v.SizeLimits == nil {
+		return nil
+	}
+	if limit := v.SizeLimits.MaxRequestBytes(types.GRPCProtocol, fullMethodName); limit > 0 && int64(size) > limit {
+		return errors.Wrapf(ErrRequestTooLarge, "message size %d exceeds limit %d", size, limit)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package middleware_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/middleware"
+	"github.com/overload-ak/cosmos-firewall/internal/types"
+)
+
+func TestSizeLimits(t *testing.T) {
+	cfg := config.DefaultConfig().SizeLimit
+	cfg.MaxResponseBytes = map[string]int64{string(types.RESTProtocol): 1 << 20}
+	cfg.Routes = []config.RouteSizeLimit{
+		{Protocol: string(types.RESTProtocol), Route: "/cosmos/tx/v1beta1/txs", MaxRequestBytes: 8 << 20},
+		{Protocol: string(types.GRPCProtocol), Route: "/cosmos.tx.v1beta1.Service/BroadcastTx", MaxRequestBytes: 8 << 20},
+	}
+	limits := middleware.NewSizeLimits(cfg)
+
+	assert.Equal(t, int64(config.DefaultMaxRequestBytes), limits.MaxRequestBytes(types.RESTProtocol, "/cosmos/bank/v1beta1/balances/fx1"))
+	assert.Equal(t, int64(8<<20), limits.MaxRequestBytes(types.RESTProtocol, "/cosmos/tx/v1beta1/txs"))
+	assert.Equal(t, int64(config.DefaultMaxRequestBytes), limits.MaxRequestBytes(types.JSONRPCProtocol, "/broadcast_tx_sync"))
+	assert.Equal(t, int64(1<<20), limits.MaxResponseBytes(types.RESTProtocol))
+	assert.Zero(t, limits.MaxResponseBytes(types.JSONRPCProtocol))
+	// the server receives messages up to the largest route limit, the handler checks the others
+	assert.Equal(t, 8<<20, limits.GRPCMaxRecvBytes())
+	assert.Equal(t, math.MaxInt32, limits.GRPCMaxSendBytes())
+
+	validator := middleware.NewValidator(config.DefaultConfig())
+	validator.SizeLimits = limits
+	assert.NoError(t, validator.CheckGRPCRequestSize("/cosmos.tx.v1beta1.Service/BroadcastTx", 6<<20))
+	assert.ErrorIs(t, validator.CheckGRPCRequestSize("/cosmos.bank.v1beta1.Query/Balance", 6<<20), middleware.ErrRequestTooLarge)
+
+	invalid := config.DefaultConfig().SizeLimit
+	invalid.Routes = []config.RouteSizeLimit{{Protocol: string(types.EVMRPCProtocol), Route: "eth_call"}}
+	assert.Error(t, invalid.ValidateBasic())
+	assert.NoError(t, config.DefaultConfig().SizeLimit.ValidateBasic())
+}
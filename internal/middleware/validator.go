@@ -1,21 +1,46 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"net"
 	"strings"
 
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	"github.com/cosmos/cosmos-sdk/codec/unknownproto"
 	"github.com/cosmos/cosmos-sdk/types/tx"
 	"github.com/cosmos/cosmos-sdk/types/tx/signing"
 	"github.com/gogo/protobuf/proto"
 	"github.com/pkg/errors"
+	"github.com/tendermint/tendermint/crypto/tmhash"
 
 	"github.com/overload-ak/cosmos-firewall/config"
-	"github.com/overload-ak/cosmos-firewall/internal/types"
 	"github.com/overload-ak/cosmos-firewall/logger"
 )
 
+// log is the logger of the middleware subsystem.
+var log = logger.Named("middleware")
+
 type Validator struct {
 	Routers *Routers
 	Cfg     *config.Config
+	// LatestHeight returns the latest block height known from upstream nodes, nil without redirect.
+	LatestHeight func() int64
+	// MempoolSize returns the number of txs and bytes in the upstream mempools, nil without redirect.
+	MempoolSize    func() (int64, int64)
+	TrustedProxies []*net.IPNet
+	IPFilter       *IPFilter
+	RateLimiter    *RateLimiter
+	SignerLimiter  *SignerLimiter
+	Authenticator  *Authenticator
+	Banner         *Banner
+	PoW            *PoW
+	SizeLimits     *SizeLimits
+	Concurrency    *ConcurrencyLimiter
+	Mempool        *MempoolGuard
+	Auditor        *Auditor
+	AccessLogger   *AccessLogger
+	BodyLogger     *BodyLogger
 }
 
 func NewValidator(cfg *config.Config) Validator {
@@ -23,7 +48,55 @@ func NewValidator(cfg *config.Config) Validator {
 	if err != nil {
 		panic(err)
 	}
-	return Validator{Routers: routers, Cfg: cfg}
+	trustedProxies, err := config.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+	validator := Validator{Routers: routers, Cfg: cfg, TrustedProxies: trustedProxies, SizeLimits: NewSizeLimits(cfg.SizeLimit)}
+	if cfg.AccessControl.Enable {
+		if validator.IPFilter, err = NewIPFilter(cfg.AccessControl); err != nil {
+			panic(err)
+		}
+	}
+	var tiers map[string]config.Tier
+	if cfg.Auth.Enable {
+		if validator.Authenticator, err = NewAuthenticator(cfg.Auth, routers.InterfaceRegistry()); err != nil {
+			panic(err)
+		}
+		tiers = cfg.Auth.Tiers
+	}
+	if cfg.RateLimit.Enable || cfg.Auth.Enable {
+		validator.RateLimiter = NewRateLimiter(cfg.RateLimit, tiers, routers)
+	}
+	if cfg.SignerLimit.Enable {
+		if validator.SignerLimiter, err = NewSignerLimiter(cfg.SignerLimit); err != nil {
+			panic(err)
+		}
+	}
+	if cfg.Ban.Enable {
+		validator.Banner = NewBanner(cfg.Ban)
+	}
+	if cfg.PoW.Enable {
+		if validator.PoW, err = NewPoW(cfg.PoW); err != nil {
+			panic(err)
+		}
+	}
+	if cfg.Concurrency.Enable {
+		validator.Concurrency = NewConcurrencyLimiter(cfg.Concurrency)
+	}
+	if cfg.Mempool.Enable {
+		validator.Mempool = NewMempoolGuard(cfg.Mempool)
+	}
+	if cfg.Audit.Enable {
+		validator.Auditor = NewAuditor(cfg.Audit)
+	}
+	if cfg.AccessLog.Enable {
+		validator.AccessLogger = NewAccessLogger(cfg.AccessLog)
+	}
+	if cfg.BodyLog.Mode != config.BodyLogOff || len(cfg.BodyLog.Routes) > 0 {
+		validator.BodyLogger = NewBodyLogger(cfg.BodyLog, routers)
+	}
+	return validator
 }
 
 func (v Validator) IsJSONPRCRouterAllowed(router string) bool {
@@ -45,113 +118,292 @@ func (v Validator) IsGRPCRouterAllowed(router string) bool {
 }
 
 func (v Validator) IsRESTRouterAllowed(router string) bool {
-	patterns := make([]types.PathPattern, 0, len(v.Routers.GetRESTRouters()))
-	for _, p := range v.Routers.GetRESTRouters() {
-		patterns = append(patterns, types.NewPathPattern(p))
-	}
-	for _, pattern := range patterns {
+	_, ok := v.MatchRESTRouter(router)
+	return ok
+}
+
+// MatchRESTRouter returns the pattern of the REST router matching a path.
+func (v Validator) MatchRESTRouter(router string) (string, bool) {
+	for _, pattern := range v.Routers.GetRESTPatterns() {
 		if pattern.Match(router) {
-			return true
+			return pattern.Pattern, true
 		}
 	}
-	return false
+	return "", false
+}
+
+// CheckBroadcastStamp requires a proof of work stamp bound to the hash of the tx being
+// broadcast while the firewall is under load.
+func (v Validator) CheckBroadcastStamp(stamps []string, txBytes []byte) error {
+	if v.PoW == nil {
+		return nil
+	}
+	return v.PoW.Verify(stamps, tmhash.Sum(txBytes))
+}
+
+func (v Validator) CheckTxBytes(ctx context.Context, txBytes []byte) error {
+	_, _, err := v.checkTxBytes(ctx, txBytes)
+	if err != nil {
+		v.rejectTxBytesSigners(ctx, txBytes)
+	}
+	return err
+}
+
+// CheckBroadcastTxBytes validates a tx being broadcast by a client IP, rejects it when a
+// proven signer is banned or the upstream mempools are full, and charges it to the signer limits,
+// see chargedSigners.
+func (v Validator) CheckBroadcastTxBytes(ctx context.Context, client string, txBytes []byte) error {
+	txBody, authInfo, err := v.checkTxBytes(ctx, txBytes)
+	if err != nil {
+		v.rejectTxBytesSigners(ctx, txBytes)
+		return err
+	}
+	priority := allWhiteRouters(txBody, v.Cfg.Chain.WhiteRouters)
+	if v.SignerLimiter == nil && v.Banner == nil {
+		return v.checkMempool(priority)
+	}
+	proven, unproven, err := v.ProvenTxSigners(txBody)
+	if err != nil {
+		return WrapRejection(CodeInvalidTx, err, "tx signers")
+	}
+	if err = v.checkSignerBans(proven); err != nil {
+		return err
+	}
+	if err = v.checkMempool(priority); err != nil {
+		return err
+	}
+	if v.SignerLimiter == nil {
+		return nil
+	}
+	charged, err := v.chargedSigners(client, authInfo, proven, unproven)
+	if err != nil {
+		return WrapRejection(CodeInvalidSignerInfo, err, "tx signers")
+	}
+	if err = v.SignerLimiter.Allow(charged); err != nil {
+		v.rejectSigners(ctx, proven, RejectSignerLimited)
+		return err
+	}
+	return nil
 }
 
-func (v Validator) CheckTxBytes(txBytes []byte) error {
+func (v Validator) checkTxBytes(ctx context.Context, txBytes []byte) (tx.TxBody, tx.AuthInfo, error) {
+	if maxTxBytes := v.Cfg.Chain.MaximumTxBytes; maxTxBytes > 0 && len(txBytes) > maxTxBytes {
+		return tx.TxBody{}, tx.AuthInfo{}, Rejectf(CodeTxTooLarge, "tx size %d exceeds limit %d", len(txBytes), maxTxBytes)
+	}
 	txRaw := tx.TxRaw{}
 	if err := proto.Unmarshal(txBytes, &txRaw); err != nil {
-		return errors.Wrapf(err, "proto unmarshal txBytes")
+		return tx.TxBody{}, tx.AuthInfo{}, WrapRejection(CodeInvalidTx, err, "proto unmarshal txBytes")
 	}
-	if len(txRaw.Signatures) < v.Cfg.Chain.MinimumSignatures {
-		return errors.New("signatures is empty")
+	if v.Cfg.Chain.StrictDecoding {
+		if err := v.CheckTxEncoding(txBytes, txRaw); err != nil {
+			return tx.TxBody{}, tx.AuthInfo{}, errors.Wrapf(err, "check tx encoding")
+		}
 	}
-	for _, signature := range txRaw.Signatures {
-		if len(signature) != 64 && len(signature) != 65 {
-			return errors.New("signature format error")
+	txBody := tx.TxBody{}
+	if err := proto.Unmarshal(txRaw.BodyBytes, &txBody); err != nil {
+		return tx.TxBody{}, tx.AuthInfo{}, WrapRejection(CodeInvalidTx, err, "proto unmarshal txBody")
+	}
+	if IsEthereumTx(txBody) {
+		if err := v.checkEthereumTx(txRaw, txBody); err != nil {
+			return tx.TxBody{}, tx.AuthInfo{}, errors.Wrapf(err, "check ethereum tx")
 		}
+		return txBody, tx.AuthInfo{}, nil
+	}
+	if len(txRaw.Signatures) < v.Cfg.Chain.MinimumSignatures {
+		return tx.TxBody{}, tx.AuthInfo{}, NewRejection(CodeInvalidSignature, "signatures is empty")
+	}
+	if err := v.CheckSignatures(txRaw.Signatures); err != nil {
+		return tx.TxBody{}, tx.AuthInfo{}, err
 	}
 	authInfo := tx.AuthInfo{}
 	if err := proto.Unmarshal(txRaw.AuthInfoBytes, &authInfo); err != nil {
-		return errors.Wrapf(err, "proto unmarshal authInfo")
-	}
-	if authInfo.Fee.GasLimit < v.Cfg.Chain.MinimumGasLimit {
-		return errors.New("GasLimit is too small")
+		return tx.TxBody{}, tx.AuthInfo{}, WrapRejection(CodeInvalidTx, err, "proto unmarshal authInfo")
 	}
 	if err := v.CheckTxAuthInfo(authInfo); err != nil {
-		return errors.Wrapf(err, "check txAuthInfo")
+		return tx.TxBody{}, tx.AuthInfo{}, errors.Wrapf(err, "check txAuthInfo")
 	}
-	txBody := tx.TxBody{}
-	if err := proto.Unmarshal(txRaw.BodyBytes, &txBody); err != nil {
-		return errors.Wrapf(err, "proto unmarshal txBody")
+	if authInfo.Fee.GasLimit < v.Cfg.Chain.MinimumGasLimit {
+		return tx.TxBody{}, tx.AuthInfo{}, NewRejection(CodeGasTooLow, "GasLimit is too small")
 	}
 	if !checkWhiteRouters(txBody, v.Cfg.Chain.WhiteRouters) {
 		fee := v.Cfg.Chain.GetMinFee()
-		if authInfo.Fee == nil || !authInfo.Fee.Amount.IsAnyGTE(fee) {
-			logger.Warnf("==> fee is too low expect: %s, actual:%s", authInfo.Fee.Amount.String(), fee.String())
-			return errors.New("fee is too low")
+		if !authInfo.Fee.Amount.IsAnyGTE(fee) {
+			log.Ctx(ctx).Warnf("fee is too low, expect: %s, actual: %s", fee.String(), authInfo.Fee.Amount.String())
+			return tx.TxBody{}, tx.AuthInfo{}, NewRejection(CodeFeeTooLow, "fee is too low")
 		}
 	}
 	if err := v.CheckTxBody(txBody); err != nil {
+		return tx.TxBody{}, tx.AuthInfo{}, errors.Wrapf(err, "check txBody")
+	}
+	if err := v.checkWeb3TxFeePayer(txBody); err != nil {
+		return tx.TxBody{}, tx.AuthInfo{}, errors.Wrapf(err, "check ExtensionOptionsWeb3Tx")
+	}
+	return txBody, authInfo, nil
+}
+
+// CheckTx validates a decoded tx, e.g. the Tx field of a SimulateRequest.
+func (v Validator) CheckTx(decodedTx *tx.Tx) error {
+	if decodedTx.Body == nil || decodedTx.AuthInfo == nil {
+		return NewRejection(CodeInvalidTx, "tx body or auth info is empty")
+	}
+	if maxTxBytes := v.Cfg.Chain.MaximumTxBytes; maxTxBytes > 0 && decodedTx.Size() > maxTxBytes {
+		return Rejectf(CodeTxTooLarge, "tx size %d exceeds limit %d", decodedTx.Size(), maxTxBytes)
+	}
+	if err := v.CheckSignatures(decodedTx.Signatures); err != nil {
+		return err
+	}
+	if err := v.CheckTxAuthInfo(*decodedTx.AuthInfo); err != nil {
+		return errors.Wrapf(err, "check txAuthInfo")
+	}
+	if err := v.CheckTxBody(*decodedTx.Body); err != nil {
 		return errors.Wrapf(err, "check txBody")
 	}
+	if err := v.checkWeb3TxFeePayer(*decodedTx.Body); err != nil {
+		return errors.Wrapf(err, "check ExtensionOptionsWeb3Tx")
+	}
+	return nil
+}
+
+func (v Validator) CheckSignatures(signatures [][]byte) error {
+	if maxSignatures := v.Cfg.Chain.MaximumSignatures; maxSignatures > 0 && len(signatures) > maxSignatures {
+		return Rejectf(CodeTooManySignatures, "signatures exceed limit %d", maxSignatures)
+	}
+	for _, signature := range signatures {
+		if len(signature) != 64 && len(signature) != 65 {
+			return NewRejection(CodeInvalidSignature, "signature format error")
+		}
+	}
+	return nil
+}
+
+// CheckTxEncoding rejects unknown fields the way the SDK tx decoder does, using the
+// application's interface registry to resolve Any messages, and requires TxRaw to be
+// encoded canonically so that the bytes hashed by the node are the bytes validated here.
+func (v Validator) CheckTxEncoding(txBytes []byte, txRaw tx.TxRaw) error {
+	registry := v.Routers.InterfaceRegistry()
+	if err := unknownproto.RejectUnknownFieldsStrict(txBytes, &tx.TxRaw{}, registry); err != nil {
+		return WrapRejection(CodeNonCanonicalTx, err, "reject unknown fields of TxRaw")
+	}
+	if _, err := unknownproto.RejectUnknownFields(txRaw.BodyBytes, &tx.TxBody{}, true, registry); err != nil {
+		return WrapRejection(CodeNonCanonicalTx, err, "reject unknown fields of TxBody")
+	}
+	if err := unknownproto.RejectUnknownFieldsStrict(txRaw.AuthInfoBytes, &tx.AuthInfo{}, registry); err != nil {
+		return WrapRejection(CodeNonCanonicalTx, err, "reject unknown fields of AuthInfo")
+	}
+	encoded, err := proto.Marshal(&txRaw)
+	if err != nil {
+		return WrapRejection(CodeInvalidTx, err, "proto marshal TxRaw")
+	}
+	if !bytes.Equal(encoded, txBytes) {
+		return NewRejection(CodeNonCanonicalTx, "non-canonical TxRaw encoding")
+	}
 	return nil
 }
 
 func (v Validator) CheckTxBody(txBody tx.TxBody) error {
 	if len(txBody.Memo) > v.Cfg.Chain.MaxMemo {
-		return errors.New("memo field length exceeds limit")
+		return NewRejection(CodeMemoTooLong, "memo field length exceeds limit")
 	}
-	if v.Cfg.Chain.ExtensionOptions == 0 && len(txBody.ExtensionOptions) > 0 {
-		return errors.New("fill in illegal field ExtensionOptions")
+	if err := v.checkExtensionOptions(txBody.ExtensionOptions, v.Cfg.Chain.AllowedExtensionOptions, v.Cfg.Chain.ExtensionOptions); err != nil {
+		return errors.Wrapf(err, "check ExtensionOptions")
 	}
-	if v.Cfg.Chain.NonCriticalExtensionOptions == 0 && len(txBody.NonCriticalExtensionOptions) > 0 {
-		return errors.New("fill in illegal field NonCriticalExtensionOptions")
+	if err := v.checkExtensionOptions(txBody.NonCriticalExtensionOptions, v.Cfg.Chain.AllowedNonCriticalExtensionOptions, v.Cfg.Chain.NonCriticalExtensionOptions); err != nil {
+		return errors.Wrapf(err, "check NonCriticalExtensionOptions")
 	}
 	if len(txBody.Messages) <= 0 {
-		return errors.New("transaction message is empty")
+		return NewRejection(CodeNoMessages, "transaction message is empty")
+	}
+	if err := v.checkMessageLimits(txBody.Messages); err != nil {
+		return err
+	}
+	if err := v.checkTimeoutHeight(txBody.TimeoutHeight); err != nil {
+		return err
 	}
 	for _, message := range txBody.Messages {
 		if message.TypeUrl == "" {
-			return errors.New("message type url is empty")
+			return NewRejection(CodeMessageDenied, "message type url is empty")
 		}
 		if !v.IsGRPCRouterAllowed(message.TypeUrl) {
-			return errors.New("unsupported transaction message type")
+			return NewRejection(CodeMessageDenied, "unsupported transaction message type")
+		}
+		if message.TypeUrl == MsgEthereumTxTypeURL {
+			if _, err := v.checkEthereumMsg(message); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
 func (v Validator) CheckTxAuthInfo(authInfo tx.AuthInfo) error {
+	if authInfo.Fee == nil {
+		return NewRejection(CodeInvalidFee, "fee is empty")
+	}
+	if maxGasLimit := v.Cfg.Chain.MaximumGasLimit; maxGasLimit > 0 && authInfo.Fee.GasLimit > maxGasLimit {
+		return NewRejection(CodeGasTooHigh, "GasLimit is too large")
+	}
 	if v.Cfg.Chain.Granter == 0 && authInfo.Fee.Granter != "" {
-		return errors.New("fill in illegal field Granter")
+		return NewRejection(CodeInvalidFee, "fill in illegal field Granter")
 	}
 	if v.Cfg.Chain.Payer == 0 && authInfo.Fee.Payer != "" {
-		return errors.New("set Payer, non-normal client request")
+		return NewRejection(CodeInvalidFee, "set Payer, non-normal client request")
 	}
 	if len(authInfo.SignerInfos) < v.Cfg.Chain.SignerInfos {
-		return errors.New("multiple SignerInfos, non-normal client request")
+		return NewRejection(CodeInvalidSignerInfo, "multiple SignerInfos, non-normal client request")
 	}
 	for _, info := range authInfo.SignerInfos {
 		if info.PublicKey == nil {
-			return errors.New("public key is empty")
+			return NewRejection(CodeInvalidSignerInfo, "public key is empty")
 		}
 		if !checkPublicKeyTypeUrl(info.PublicKey.TypeUrl, v.Cfg.Chain.PublicKeyTypeURL) {
-			return errors.New("illegal public key type")
+			return NewRejection(CodeInvalidSignerInfo, "illegal public key type")
 		}
 		if len(info.PublicKey.Value) != 35 {
-			return errors.New("public key format error")
+			return NewRejection(CodeInvalidSignerInfo, "public key format error")
 		}
 		if single, ok := info.ModeInfo.Sum.(*tx.ModeInfo_Single_); !ok {
-			return errors.New("invalid signature sum")
+			return NewRejection(CodeInvalidSignerInfo, "invalid signature sum")
 		} else {
 			if single.Single.Mode == signing.SignMode_SIGN_MODE_UNSPECIFIED || single.Single.Mode == signing.SignMode_SIGN_MODE_TEXTUAL {
-				return errors.New("signature mode error")
+				return NewRejection(CodeInvalidSignerInfo, "signature mode error")
 			}
 		}
 	}
 	return nil
 }
 
+func (v Validator) checkMessageLimits(messages []*codectypes.Any) error {
+	if maxMessages := v.Cfg.Chain.MaximumMessages; maxMessages > 0 && len(messages) > maxMessages {
+		return Rejectf(CodeTooManyMessages, "transaction messages exceed limit %d", maxMessages)
+	}
+	if maxPerType := v.Cfg.Chain.MaximumMessagesPerType; maxPerType > 0 {
+		counts := make(map[string]int, len(messages))
+		for _, message := range messages {
+			counts[message.TypeUrl]++
+			if counts[message.TypeUrl] > maxPerType {
+				return Rejectf(CodeTooManyMessages, "%s messages exceed limit %d", message.TypeUrl, maxPerType)
+			}
+		}
+	}
+	return nil
+}
+
+// checkTimeoutHeight bounds how far in the future a tx may stay valid, skipped until the latest height is known.
+func (v Validator) checkTimeoutHeight(timeoutHeight uint64) error {
+	maxDistance := v.Cfg.Chain.MaximumTimeoutHeight
+	if maxDistance == 0 || timeoutHeight == 0 || v.LatestHeight == nil {
+		return nil
+	}
+	latestHeight := v.LatestHeight()
+	if latestHeight <= 0 {
+		return nil
+	}
+	if timeoutHeight > uint64(latestHeight)+maxDistance {
+		return Rejectf(CodeTimeoutHeightTooFar, "timeout height exceeds latest height by more than %d", maxDistance)
+	}
+	return nil
+}
+
 func checkPublicKeyTypeUrl(typeUrl string, publicKeyTypeURL []string) bool {
 	for _, url := range publicKeyTypeURL {
 		if strings.EqualFold(url, typeUrl) {
@@ -163,10 +415,28 @@ func checkPublicKeyTypeUrl(typeUrl string, publicKeyTypeURL []string) bool {
 
 func checkWhiteRouters(txBody tx.TxBody, whiteRouters []string) bool {
 	for _, message := range txBody.Messages {
-		for _, router := range whiteRouters {
-			if strings.EqualFold(message.TypeUrl, router) {
-				return true
-			}
+		if isWhiteRouter(message.TypeUrl, whiteRouters) {
+			return true
+		}
+	}
+	return false
+}
+
+// allWhiteRouters reports whether every message of the tx is a white router, so that a
+// white router message does not give priority to the other messages of its tx.
+func allWhiteRouters(txBody tx.TxBody, whiteRouters []string) bool {
+	for _, message := range txBody.Messages {
+		if !isWhiteRouter(message.TypeUrl, whiteRouters) {
+			return false
+		}
+	}
+	return len(txBody.Messages) > 0
+}
+
+func isWhiteRouter(typeURL string, whiteRouters []string) bool {
+	for _, router := range whiteRouters {
+		if strings.EqualFold(typeURL, router) {
+			return true
 		}
 	}
 	return false
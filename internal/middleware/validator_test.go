@@ -1,14 +1,32 @@
 package middleware_test
 
 import (
+	"context"
+	"os"
 	"testing"
 
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/cosmos/cosmos-sdk/types/tx/signing"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/application"
 	"github.com/overload-ak/cosmos-firewall/internal/middleware"
 )
 
+func TestMain(m *testing.M) {
+	if err := application.SetBech32Prefixes(config.DefaultConfig().Chain.ChainID); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
 func TestValidatorRouters(t *testing.T) {
 	cfg := &config.Config{Chain: config.Chain{ChainID: "fxcore"}}
 	validator := middleware.NewValidator(cfg)
@@ -30,3 +48,104 @@ func TestValidatorRouters(t *testing.T) {
 	assert.True(t, validator.IsGRPCRouterAllowed("/cosmos.bank.v1beta1.Query/AllBalances"))
 	assert.True(t, validator.IsGRPCRouterAllowed("/cosmos.base.tendermint.v1beta1.Service/GetNodeInfo"))
 }
+
+func newTestTx(t *testing.T, messages int, gasLimit uint64, signatures int) *tx.Tx {
+	sender := "fx1pmlwpl22294jeh06zvx39y5txnxnaezfg2m7cy"
+	anys := make([]*codectypes.Any, 0, messages)
+	for i := 0; i < messages; i++ {
+		msg, err := codectypes.NewAnyWithValue(&banktypes.MsgSend{FromAddress: sender, ToAddress: sender, Amount: sdk.NewCoins(sdk.NewInt64Coin("FX", 1))})
+		require.NoError(t, err)
+		anys = append(anys, msg)
+	}
+	pubKey, err := codectypes.NewAnyWithValue(secp256k1.GenPrivKey().PubKey())
+	require.NoError(t, err)
+	signerInfo := &tx.SignerInfo{
+		PublicKey: pubKey,
+		ModeInfo:  &tx.ModeInfo{Sum: &tx.ModeInfo_Single_{Single: &tx.ModeInfo_Single{Mode: signing.SignMode_SIGN_MODE_DIRECT}}},
+	}
+	sigs := make([][]byte, signatures)
+	for i := range sigs {
+		sigs[i] = make([]byte, 64)
+	}
+	return &tx.Tx{
+		Body:       &tx.TxBody{Messages: anys},
+		AuthInfo:   &tx.AuthInfo{SignerInfos: []*tx.SignerInfo{signerInfo}, Fee: &tx.Fee{GasLimit: gasLimit}},
+		Signatures: sigs,
+	}
+}
+
+func newTestTxBytes(t *testing.T, decodedTx *tx.Tx) []byte {
+	bodyBytes, err := proto.Marshal(decodedTx.Body)
+	require.NoError(t, err)
+	authInfoBytes, err := proto.Marshal(decodedTx.AuthInfo)
+	require.NoError(t, err)
+	txBytes, err := proto.Marshal(&tx.TxRaw{BodyBytes: bodyBytes, AuthInfoBytes: authInfoBytes, Signatures: decodedTx.Signatures})
+	require.NoError(t, err)
+	return txBytes
+}
+
+func TestValidatorTxCeilings(t *testing.T) {
+	cfg := config.DefaultConfig()
+	validator := middleware.NewValidator(cfg)
+
+	assert.NoError(t, validator.CheckTx(newTestTx(t, 2, 200000, 1)))
+	assert.Error(t, validator.CheckTx(newTestTx(t, config.DefaultMaxMessages+1, 200000, 1)))
+	assert.Error(t, validator.CheckTx(newTestTx(t, 2, config.DefaultMaxGasLimit+1, 1)))
+	assert.Error(t, validator.CheckTx(newTestTx(t, 2, 200000, config.DefaultMaxSignatures+1)))
+
+	cfg.Chain.MaximumMessagesPerType = 1
+	assert.Error(t, validator.CheckTx(newTestTx(t, 2, 200000, 1)))
+
+	cfg.Chain.MaximumTxBytes = 100
+	assert.Error(t, validator.CheckTx(newTestTx(t, 1, 200000, 1)))
+	assert.Error(t, validator.CheckTxBytes(context.Background(), make([]byte, 101)))
+
+	cfg.Chain.MaximumTxBytes = 0
+	cfg.Chain.MaximumTimeoutHeight = 100
+	validator.LatestHeight = func() int64 { return 1000 }
+	tooFar := newTestTx(t, 1, 200000, 1)
+	tooFar.Body.TimeoutHeight = 1101
+	assert.Error(t, validator.CheckTx(tooFar))
+	tooFar.Body.TimeoutHeight = 1100
+	assert.NoError(t, validator.CheckTx(tooFar))
+}
+
+func TestCheckTxEncoding(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Chain.MinimumFee = "1FX"
+	validator := middleware.NewValidator(cfg)
+
+	decodedTx := newTestTx(t, 1, 200000, 1)
+	decodedTx.AuthInfo.Fee.Amount = sdk.NewCoins(sdk.NewInt64Coin("FX", 1))
+	txBytes := newTestTxBytes(t, decodedTx)
+	assert.NoError(t, validator.CheckTxBytes(context.Background(), txBytes))
+
+	// unknown field 100 (varint)
+	assert.Error(t, validator.CheckTxBytes(context.Background(), append(append([]byte{}, txBytes...), 0xa0, 0x06, 0x01)))
+
+	// unknown non-critical field 1025 (varint) is allowed in TxBody only, as the SDK tx decoder does
+	bodyBytes, err := proto.Marshal(decodedTx.Body)
+	require.NoError(t, err)
+	authInfoBytes, err := proto.Marshal(decodedTx.AuthInfo)
+	require.NoError(t, err)
+	nonCritical := []byte{0x88, 0x40, 0x01}
+	txRaw := tx.TxRaw{BodyBytes: append(append([]byte{}, bodyBytes...), nonCritical...), AuthInfoBytes: authInfoBytes, Signatures: decodedTx.Signatures}
+	rawBytes, err := proto.Marshal(&txRaw)
+	require.NoError(t, err)
+	assert.NoError(t, validator.CheckTxEncoding(rawBytes, txRaw))
+	txRaw = tx.TxRaw{BodyBytes: bodyBytes, AuthInfoBytes: append(append([]byte{}, authInfoBytes...), nonCritical...), Signatures: decodedTx.Signatures}
+	rawBytes, err = proto.Marshal(&txRaw)
+	require.NoError(t, err)
+	assert.Error(t, validator.CheckTxEncoding(rawBytes, txRaw))
+
+	// TxRaw with the auth info encoded before the body
+	authInfoRaw, err := proto.Marshal(&tx.TxRaw{AuthInfoBytes: authInfoBytes})
+	require.NoError(t, err)
+	bodyRaw, err := proto.Marshal(&tx.TxRaw{BodyBytes: bodyBytes, Signatures: decodedTx.Signatures})
+	require.NoError(t, err)
+	reordered := append(authInfoRaw, bodyRaw...)
+	assert.Error(t, validator.CheckTxBytes(context.Background(), reordered))
+
+	cfg.Chain.StrictDecoding = false
+	assert.NoError(t, validator.CheckTxBytes(context.Background(), reordered))
+}
@@ -2,15 +2,19 @@ package node
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
 	"github.com/cosmos/cosmos-sdk/codec/legacy"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/pkg/errors"
 	clienthttp "github.com/tendermint/tendermint/rpc/client/http"
 	jsonrpcclient "github.com/tendermint/tendermint/rpc/jsonrpc/client"
@@ -18,15 +22,24 @@ import (
 	"google.golang.org/grpc/credentials/google"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/overload-ak/cosmos-firewall/internal/metrics"
 	"github.com/overload-ak/cosmos-firewall/internal/types"
 	"github.com/overload-ak/cosmos-firewall/logger"
 )
 
+// log is the logger of the node subsystem.
+var log = logger.Named("node")
+
 type INode interface {
 	GetLatestHeight(ctx context.Context) (int64, error)
 	GetURI() string
 }
 
+// MempoolNode is a node reporting the number of txs and bytes in its mempool.
+type MempoolNode interface {
+	GetMempoolSize(ctx context.Context) (int64, int64, error)
+}
+
 type Node struct {
 	LightNodes   []INode
 	FullNodes    []INode
@@ -35,6 +48,9 @@ type Node struct {
 	TimeoutSecond   uint
 	CheckNodeSecond uint
 	g               sync.WaitGroup
+	latestHeight    int64
+	mempoolTxs      int64
+	mempoolBytes    int64
 }
 
 func NewJSONRPCNode(lightURI, fullURI, archiveURI []string, timeoutSecond, checkNodeSecond uint) (*Node, error) {
@@ -57,6 +73,16 @@ func NewRESTNode(lightURI, fullURI, archiveURI []string, timeoutSecond, checkNod
 	return &Node{LightNodes: lightNodes, FullNodes: fullNodes, ArchiveNodes: archiveNodes, TimeoutSecond: timeoutSecond, CheckNodeSecond: checkNodeSecond}, nil
 }
 
+func NewEVMJSONRPCNode(lightURI, fullURI, archiveURI []string, timeoutSecond, checkNodeSecond uint) (*Node, error) {
+	if len(lightURI) == 0 && len(fullURI) == 0 && len(archiveURI) == 0 {
+		return nil, errors.New("empty evm json rpc nodes")
+	}
+	lightNodes := batchCreateEVMJSONRPCClient(lightURI, timeoutSecond)
+	fullNodes := batchCreateEVMJSONRPCClient(fullURI, timeoutSecond)
+	archiveNodes := batchCreateEVMJSONRPCClient(archiveURI, timeoutSecond)
+	return &Node{LightNodes: lightNodes, FullNodes: fullNodes, ArchiveNodes: archiveNodes, TimeoutSecond: timeoutSecond, CheckNodeSecond: checkNodeSecond}, nil
+}
+
 func NewGRPCNode(lightURI, fullURI, archiveURI []string, timeoutSecond, checkNodeSecond uint) (*Node, error) {
 	if len(lightURI) == 0 && len(fullURI) == 0 && len(archiveURI) == 0 {
 		return nil, errors.New("empty json rpc nodes")
@@ -71,20 +97,86 @@ func (n *Node) CheckNode() {
 	if len(n.LightNodes) == 0 && len(n.ArchiveNodes) == 0 && len(n.FullNodes) == 0 {
 		panic("empty node")
 	}
+	heights := make([]int64, 3)
+	nodeHeights := [][]int64{make([]int64, len(n.LightNodes)), make([]int64, len(n.FullNodes)), make([]int64, len(n.ArchiveNodes))}
 	n.g.Add(3)
 	go func() {
-		getBestNode(n.LightNodes, &n.g)
+		getBestNode(n.LightNodes, nodeHeights[0], &heights[0], &n.g)
 	}()
 	go func() {
-		getBestNode(n.FullNodes, &n.g)
+		getBestNode(n.FullNodes, nodeHeights[1], &heights[1], &n.g)
 	}()
 	go func() {
-		getBestNode(n.ArchiveNodes, &n.g)
+		getBestNode(n.ArchiveNodes, nodeHeights[2], &heights[2], &n.g)
 	}()
 	n.g.Wait()
+	var latestHeight int64
+	for _, height := range heights {
+		if height > latestHeight {
+			latestHeight = height
+		}
+	}
+	atomic.StoreInt64(&n.latestHeight, latestHeight)
+	nodeTypes := []types.ModelNode{types.LightNode, types.FullNode, types.ArchiveNode}
+	for i, nodes := range [][]INode{n.LightNodes, n.FullNodes, n.ArchiveNodes} {
+		for j, no := range nodes {
+			labels := []string{no.GetURI(), string(nodeTypes[i])}
+			height := nodeHeights[i][j]
+			if height == 0 {
+				metrics.NodeUp.WithLabelValues(labels...).Set(0)
+				continue
+			}
+			metrics.NodeUp.WithLabelValues(labels...).Set(1)
+			metrics.NodeHeight.WithLabelValues(labels...).Set(float64(height))
+			metrics.NodeHeightLag.WithLabelValues(labels...).Set(float64(latestHeight - height))
+		}
+	}
 }
 
-func getBestNode(nodes []INode, group *sync.WaitGroup) {
+// LatestHeight returns the highest block height seen by the last CheckNode, 0 if unknown.
+func (n *Node) LatestHeight() int64 {
+	return atomic.LoadInt64(&n.latestHeight)
+}
+
+// CheckMempool polls the mempool size of the nodes reporting it, keeping the fullest.
+// The size is reset when no node answers.
+func (n *Node) CheckMempool() {
+	var txs, bytes int64
+	for _, nodes := range [][]INode{n.LightNodes, n.FullNodes, n.ArchiveNodes} {
+		for _, no := range nodes {
+			mempoolNode, ok := no.(MempoolNode)
+			if !ok {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(n.TimeoutSecond)*time.Second)
+			nodeTxs, nodeBytes, err := mempoolNode.GetMempoolSize(ctx)
+			cancel()
+			if err != nil {
+				log.Errorf("mempool node error: %s, node: %s", err.Error(), no.GetURI())
+				continue
+			}
+			if nodeTxs > txs {
+				txs = nodeTxs
+			}
+			if nodeBytes > bytes {
+				bytes = nodeBytes
+			}
+		}
+	}
+	atomic.StoreInt64(&n.mempoolTxs, txs)
+	atomic.StoreInt64(&n.mempoolBytes, bytes)
+	metrics.MempoolTxs.Set(float64(txs))
+	metrics.MempoolBytes.Set(float64(bytes))
+}
+
+// MempoolSize returns the number of txs and bytes in the fullest mempool seen by the last CheckMempool.
+func (n *Node) MempoolSize() (int64, int64) {
+	return atomic.LoadInt64(&n.mempoolTxs), atomic.LoadInt64(&n.mempoolBytes)
+}
+
+// getBestNode moves the highest node first and stores its height in best, the height of every
+// node, 0 when it failed, is stored in heights.
+func getBestNode(nodes []INode, heights []int64, best *int64, group *sync.WaitGroup) {
 	defer group.Done()
 	if len(nodes) == 0 {
 		return
@@ -95,10 +187,12 @@ func getBestNode(nodes []INode, group *sync.WaitGroup) {
 		height, err := no.GetLatestHeight(context.Background())
 		if err != nil {
 			// todo bad node should notify
-			logger.Errorf("light node error: %s, node: %s", err.Error(), no.GetURI())
+			log.Errorf("light node error: %s, node: %s", err.Error(), no.GetURI())
 			continue
 		}
+		heights[i] = height
 		if latestHeight == 0 || height > latestHeight {
+			latestHeight = height
 			index = i
 		}
 	}
@@ -106,6 +200,8 @@ func getBestNode(nodes []INode, group *sync.WaitGroup) {
 	bestNode := nodes[index]
 	nodes[0] = bestNode
 	nodes[index] = tempNode
+	heights[0], heights[index] = heights[index], heights[0]
+	*best = latestHeight
 }
 
 func batchCreateJSONRPCClient(uris []string, timeOut uint) []INode {
@@ -113,7 +209,20 @@ func batchCreateJSONRPCClient(uris []string, timeOut uint) []INode {
 	for _, uri := range uris {
 		n, err := NewNodesJSONRPCClient(uri, timeOut)
 		if err != nil {
-			logger.Errorf("rpc node error: %s, node: %s", err.Error(), nodes)
+			log.Errorf("rpc node error: %s, node: %s", err.Error(), nodes)
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func batchCreateEVMJSONRPCClient(uris []string, timeOut uint) []INode {
+	nodes := make([]INode, 0, len(uris))
+	for _, uri := range uris {
+		n, err := NewNodesEVMJSONRPCClient(uri, timeOut)
+		if err != nil {
+			log.Errorf("evm rpc node error: %s, node: %s", err.Error(), uri)
 			continue
 		}
 		nodes = append(nodes, n)
@@ -126,7 +235,7 @@ func batchCreateGRPCClient(uris []string, timeOut uint) []INode {
 	for _, uri := range uris {
 		n, err := NewNodesGrpcClient(uri, timeOut)
 		if err != nil {
-			logger.Errorf("rpc node error: %s, node: %s", err.Error(), nodes)
+			log.Errorf("rpc node error: %s, node: %s", err.Error(), nodes)
 			continue
 		}
 		nodes = append(nodes, n)
@@ -139,7 +248,7 @@ func batchCreateRESTClient(uris []string, timeOut uint) []INode {
 	for _, uri := range uris {
 		n, err := NewNodesRESTClient(uri, timeOut)
 		if err != nil {
-			logger.Errorf("rpc node error: %s, node: %s", err.Error(), nodes)
+			log.Errorf("rpc node error: %s, node: %s", err.Error(), nodes)
 			continue
 		}
 		nodes = append(nodes, n)
@@ -169,6 +278,21 @@ func NewNodesJSONRPCClient(uri string, timeout uint) (*NodesJSONRPCClient, error
 	return &NodesJSONRPCClient{uri: uri, HTTP: rpcClient}, nil
 }
 
+type NodesEVMJSONRPCClient struct {
+	uri string
+	*http.Client
+}
+
+func NewNodesEVMJSONRPCClient(uri string, timeout uint) (*NodesEVMJSONRPCClient, error) {
+	if uri == "" {
+		return nil, errors.New("empty uri")
+	}
+	httpClient := &http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+	}
+	return &NodesEVMJSONRPCClient{uri: uri, Client: httpClient}, nil
+}
+
 type NodesGRPCClient struct {
 	uri string
 	*grpc.ClientConn
@@ -225,10 +349,51 @@ func (c *NodesJSONRPCClient) GetLatestHeight(ctx context.Context) (int64, error)
 	return status.SyncInfo.LatestBlockHeight, nil
 }
 
+func (c *NodesJSONRPCClient) GetMempoolSize(ctx context.Context) (int64, int64, error) {
+	result, err := c.NumUnconfirmedTxs(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(result.Total), result.TotalBytes, nil
+}
+
 func (c *NodesJSONRPCClient) GetURI() string {
 	return c.uri
 }
 
+func (c *NodesEVMJSONRPCClient) GetLatestHeight(ctx context.Context) (int64, error) {
+	body := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uri, body)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	var res struct {
+		Result hexutil.Uint64 `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		return 0, errors.New(res.Error.Message)
+	}
+	return int64(res.Result), nil
+}
+
+func (c *NodesEVMJSONRPCClient) GetURI() string {
+	return c.uri
+}
+
 func (c *NodesGRPCClient) GetLatestHeight(ctx context.Context) (int64, error) {
 	out := new(tmservice.GetLatestBlockResponse)
 	err := c.ClientConn.Invoke(ctx, "/cosmos.base.tendermint.v1beta1.Service/GetLatestBlock", &tmservice.GetLatestBlockRequest{}, out)
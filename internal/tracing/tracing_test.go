@@ -0,0 +1,63 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/overload-ak/cosmos-firewall/config"
+	"github.com/overload-ak/cosmos-firewall/internal/tracing"
+)
+
+func TestTracingPropagation(t *testing.T) {
+	cfg := config.DefaultConfig().Tracing
+	cfg.Enable, cfg.Exporter, cfg.File = true, config.TracingExporterFile, filepath.Join(t.TempDir(), "spans.json")
+	require.NoError(t, cfg.ValidateBasic())
+	shutdown, err := tracing.Init(context.Background(), cfg)
+	require.NoError(t, err)
+
+	ctx, span := tracing.StartServer(context.Background(), "rest")
+	traceID := span.SpanContext().TraceID()
+	upstreamCtx, upstream := tracing.StartClient(ctx, tracing.StageUpstream)
+
+	// the upstream node sees the span of the forwarded request as parent
+	header := http.Header{}
+	tracing.InjectHTTP(upstreamCtx, header)
+	assert.NotEmpty(t, header.Get("traceparent"))
+	remote := trace.SpanContextFromContext(tracing.ExtractHTTP(context.Background(), header))
+	assert.Equal(t, traceID, remote.TraceID())
+	assert.Equal(t, upstream.SpanContext().SpanID(), remote.SpanID())
+
+	md, ok := metadata.FromOutgoingContext(tracing.InjectGRPC(upstreamCtx))
+	require.True(t, ok)
+	remote = trace.SpanContextFromContext(tracing.ExtractGRPC(metadata.NewIncomingContext(context.Background(), md)))
+	assert.Equal(t, traceID, remote.TraceID())
+	assert.True(t, remote.IsSampled())
+
+	upstream.End()
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+	spans, err := os.ReadFile(cfg.File)
+	require.NoError(t, err)
+	assert.Contains(t, string(spans), `"Name":"upstream"`)
+	assert.Contains(t, string(spans), traceID.String())
+}
+
+func TestTracingValidateBasic(t *testing.T) {
+	cfg := config.DefaultConfig().Tracing
+	cfg.Enable = true
+	assert.NoError(t, cfg.ValidateBasic())
+	cfg.Exporter = "jaeger"
+	assert.Error(t, cfg.ValidateBasic())
+	cfg.Exporter = config.TracingExporterFile
+	assert.Error(t, cfg.ValidateBasic())
+	cfg.Exporter, cfg.SampleRatio = config.TracingExporterStdout, 2
+	assert.Error(t, cfg.ValidateBasic())
+}
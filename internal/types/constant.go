@@ -7,3 +7,20 @@ const (
 	FullNode    ModelNode = "full"
 	ArchiveNode ModelNode = "archive"
 )
+
+type Protocol string
+
+const (
+	JSONRPCProtocol Protocol = "jsonrpc"
+	GRPCProtocol    Protocol = "grpc"
+	RESTProtocol    Protocol = "rest"
+	EVMRPCProtocol  Protocol = "evm-rpc"
+)
+
+type RouteClass string
+
+const (
+	QueryRoute     RouteClass = "query"
+	SimulateRoute  RouteClass = "simulate"
+	BroadcastRoute RouteClass = "broadcast"
+)
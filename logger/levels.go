@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels are the log levels of the subsystems, a subsystem without a level of its own
+// logging at the default level.
+type Levels struct {
+	Default    zapcore.Level
+	Subsystems map[string]zapcore.Level
+}
+
+// Subsystems are the names of the loggers of the subsystems, see Named.
+var Subsystems = []string{"main", "node", "middleware", "handler"}
+
+var currentLevels atomic.Value
+
+// ParseLevels parses a default level and subsystem=level pairs separated by commas, e.g.
+// "info,node=debug,handler=warn", "*=level" being the default level too. The default
+// level is info unless set, the subsystems are those of Subsystems.
+func ParseLevels(spec string) (Levels, error) {
+	levels := Levels{Default: zapcore.InfoLevel, Subsystems: make(map[string]zapcore.Level)}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		subsystem, name, found := strings.Cut(entry, "=")
+		if !found {
+			subsystem, name = "*", entry
+		}
+		subsystem = strings.TrimSpace(subsystem)
+		level := new(zapcore.Level)
+		if err := level.Set(strings.TrimSpace(name)); err != nil {
+			return Levels{}, fmt.Errorf("invalid log level %q: %s", entry, err.Error())
+		}
+		switch subsystem {
+		case "":
+			return Levels{}, fmt.Errorf("invalid log level %q: empty subsystem", entry)
+		case "*":
+			levels.Default = *level
+		default:
+			if !isSubsystem(subsystem) {
+				return Levels{}, fmt.Errorf("invalid log level %q: unknown subsystem %s, expected one of %s", entry, subsystem, strings.Join(Subsystems, ", "))
+			}
+			levels.Subsystems[subsystem] = *level
+		}
+	}
+	return levels, nil
+}
+
+func isSubsystem(name string) bool {
+	for _, subsystem := range Subsystems {
+		if name == subsystem {
+			return true
+		}
+	}
+	return false
+}
+
+// Of returns the level of a subsystem.
+func (l Levels) Of(subsystem string) zapcore.Level {
+	if level, ok := l.Subsystems[subsystem]; ok {
+		return level
+	}
+	return l.Default
+}
+
+// String returns the levels in the format of ParseLevels, the subsystems sorted by name.
+func (l Levels) String() string {
+	entries := make([]string, 0, len(l.Subsystems)+1)
+	entries = append(entries, l.Default.String())
+	for subsystem, level := range l.Subsystems {
+		entries = append(entries, subsystem+"="+level.String())
+	}
+	sort.Strings(entries[1:])
+	return strings.Join(entries, ",")
+}
+
+func (l Levels) min() zapcore.Level {
+	min := l.Default
+	for _, level := range l.Subsystems {
+		if level < min {
+			min = level
+		}
+	}
+	return min
+}
+
+// GetLevels returns the levels logged at.
+func GetLevels() Levels {
+	return currentLevels.Load().(Levels)
+}
+
+// SetLevels changes the levels logged at while running, in the format of ParseLevels.
+func SetLevels(spec string) error {
+	levels, err := ParseLevels(spec)
+	if err != nil {
+		return err
+	}
+	currentLevels.Store(levels)
+	return nil
+}
+
+// levelCore drops the entries below the level of their subsystem, the name of their logger.
+type levelCore struct {
+	zapcore.Core
+}
+
+func (c levelCore) Enabled(level zapcore.Level) bool {
+	return level >= GetLevels().min()
+}
+
+func (c levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return levelCore{Core: c.Core.With(fields)}
+}
+
+func (c levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Level < GetLevels().Of(entry.LoggerName) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
@@ -1,26 +1,89 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-var logger *zap.SugaredLogger
+// Formats of the log lines.
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// Outputs of the log.
+const (
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+	OutputFile   = "file"
+)
+
+// Options defines the format and the output of the log, the console format to stdout by
+// default. A file output is rotated as set by Rotation.
+type Options struct {
+	Format string
+	Output string
+	File   string
+	Rotation
+}
+
+var (
+	mu     sync.RWMutex
+	base   *zap.Logger
+	named  map[string]*zap.SugaredLogger
+	output io.Closer
+
+	std = Named("")
+)
 
 func init() {
 	Init("info")
 }
 
+// Init logs in the console format to stdout at the levels of ParseLevels, panicking on
+// invalid levels.
 func Init(level string) {
-	l := new(zapcore.Level)
-	if err := l.Set(level); err != nil {
+	if err := Setup(level, Options{}); err != nil {
 		panic(err.Error())
 	}
-	logCfg := zapcore.EncoderConfig{
+}
+
+// Setup logs at the levels of ParseLevels in the format and to the output of options.
+func Setup(level string, options Options) error {
+	levels, err := ParseLevels(level)
+	if err != nil {
+		return err
+	}
+	encoder, err := newEncoder(options.Format)
+	if err != nil {
+		return err
+	}
+	sink, closer, err := newOutput(options)
+	if err != nil {
+		return err
+	}
+	core := levelCore{Core: zapcore.NewCore(encoder, sink, zapcore.DebugLevel)}
+	currentLevels.Store(levels)
+	mu.Lock()
+	previous := output
+	base = zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1), zap.AddStacktrace(zapcore.DPanicLevel))
+	named, output = make(map[string]*zap.SugaredLogger), closer
+	mu.Unlock()
+	if previous != nil {
+		return previous.Close()
+	}
+	return nil
+}
+
+func newEncoder(format string) (zapcore.Encoder, error) {
+	encoderConfig := zapcore.EncoderConfig{
 		NameKey:        "logger",
 		MessageKey:     "msg",
 		StacktraceKey:  "stacktrace",
@@ -34,14 +97,31 @@ func Init(level string) {
 		EncodeCaller:   zapcore.ShortCallerEncoder,
 		EncodeName:     zapcore.FullNameEncoder,
 	}
-	logger = NewLogger(*l, logCfg).Sugar()
-	_ = logger.Sync()
+	switch format {
+	case "", FormatConsole:
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	case FormatJSON:
+		encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	}
+	return nil, fmt.Errorf("invalid log format: %s", format)
 }
 
-func NewLogger(level zapcore.Level, encoderConfig zapcore.EncoderConfig) *zap.Logger {
-	encoder := zapcore.NewConsoleEncoder(encoderConfig)
-	core := zapcore.NewCore(encoder, os.Stdout, zap.NewAtomicLevelAt(level))
-	return zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1), zap.Development(), zap.AddStacktrace(zapcore.DPanicLevel))
+// newOutput returns the output of the log, and its closer for a file.
+func newOutput(options Options) (zapcore.WriteSyncer, io.Closer, error) {
+	switch options.Output {
+	case "", OutputStdout:
+		return zapcore.Lock(os.Stdout), nil, nil
+	case OutputStderr:
+		return zapcore.Lock(os.Stderr), nil, nil
+	case OutputFile:
+		if options.File == "" {
+			return nil, nil, fmt.Errorf("log file is empty")
+		}
+		file := options.Rotation.Open(options.File)
+		return zapcore.AddSync(file), file, nil
+	}
+	return nil, nil, fmt.Errorf("invalid log output: %s", options.Output)
 }
 
 // format Date
@@ -49,50 +129,154 @@ func formatEncodeTime(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 	enc.AppendString(fmt.Sprintf("%d-%02d-%02d %02d:%02d:%02d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second()))
 }
 
+// Logger logs the lines of a subsystem, at the level of the subsystem.
+type Logger struct {
+	subsystem string
+}
+
+// Named returns the logger of a subsystem, whose lines are named after it.
+func Named(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+func (l *Logger) sugar() *zap.SugaredLogger {
+	mu.RLock()
+	sugared, ok := named[l.subsystem]
+	mu.RUnlock()
+	if ok {
+		return sugared
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sugared, ok = named[l.subsystem]; !ok {
+		sugared = base.Named(l.subsystem).Sugar()
+		named[l.subsystem] = sugared
+	}
+	return sugared
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a context carrying key-value pairs added to the lines logged with Ctx,
+// such as the id of the request served.
+func WithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	return context.WithValue(ctx, fieldsKey{}, append(fields[:len(fields):len(fields)], keysAndValues...))
+}
+
+// Ctx returns the logger adding the key-value pairs carried by ctx to its lines.
+func (l *Logger) Ctx(ctx context.Context) *zap.SugaredLogger {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	return l.sugar().Desugar().WithOptions(zap.AddCallerSkip(-1)).Sugar().With(fields...)
+}
+
+// Enabled reports whether the lines at level are logged.
+func (l *Logger) Enabled(level zapcore.Level) bool {
+	return level >= GetLevels().Of(l.subsystem)
+}
+
+func (l *Logger) Debug(args ...interface{}) {
+	l.sugar().Debug(args...)
+}
+
+func (l *Logger) Debugf(template string, args ...interface{}) {
+	l.sugar().Debugf(template, args...)
+}
+
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.sugar().Debugw(msg, keysAndValues...)
+}
+
+func (l *Logger) Info(args ...interface{}) {
+	l.sugar().Info(args...)
+}
+
+func (l *Logger) Infof(template string, args ...interface{}) {
+	l.sugar().Infof(template, args...)
+}
+
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.sugar().Infow(msg, keysAndValues...)
+}
+
+func (l *Logger) Warn(args ...interface{}) {
+	l.sugar().Warn(args...)
+}
+
+func (l *Logger) Warnf(template string, args ...interface{}) {
+	l.sugar().Warnf(template, args...)
+}
+
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.sugar().Warnw(msg, keysAndValues...)
+}
+
+func (l *Logger) Error(args ...interface{}) {
+	l.sugar().Error(args...)
+}
+
+func (l *Logger) Errorf(template string, args ...interface{}) {
+	l.sugar().Errorf(template, args...)
+}
+
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.sugar().Errorw(msg, keysAndValues...)
+}
+
+// Ctx returns the logger adding the key-value pairs carried by ctx to its lines.
+func Ctx(ctx context.Context) *zap.SugaredLogger {
+	return std.Ctx(ctx)
+}
+
+// Enabled reports whether the lines at level are logged.
+func Enabled(level zapcore.Level) bool {
+	return std.Enabled(level)
+}
+
 func Debug(args ...interface{}) {
-	logger.Debug(args...)
+	std.sugar().Debug(args...)
 }
 
 func Debugf(template string, args ...interface{}) {
-	logger.Debugf(template, args...)
+	std.sugar().Debugf(template, args...)
 }
 
 func Debugw(msg string, keysAndValues ...interface{}) {
-	logger.Debugw(msg, keysAndValues...)
+	std.sugar().Debugw(msg, keysAndValues...)
 }
 
 func Info(args ...interface{}) {
-	logger.Info(args...)
+	std.sugar().Info(args...)
 }
 
 func Infof(template string, args ...interface{}) {
-	logger.Infof(template, args...)
+	std.sugar().Infof(template, args...)
 }
 
 func Infow(msg string, keysAndValues ...interface{}) {
-	logger.Infow(msg, keysAndValues...)
+	std.sugar().Infow(msg, keysAndValues...)
 }
 
 func Warn(args ...interface{}) {
-	logger.Warn(args...)
+	std.sugar().Warn(args...)
 }
 
 func Warnf(template string, args ...interface{}) {
-	logger.Warnf(template, args...)
+	std.sugar().Warnf(template, args...)
 }
 
 func Warnw(msg string, keysAndValues ...interface{}) {
-	logger.Warnw(msg, keysAndValues...)
+	std.sugar().Warnw(msg, keysAndValues...)
 }
 
 func Error(args ...interface{}) {
-	logger.Error(args...)
+	std.sugar().Error(args...)
 }
 
 func Errorf(template string, args ...interface{}) {
-	logger.Errorf(template, args...)
+	std.sugar().Errorf(template, args...)
 }
 
 func Errorw(msg string, keysAndValues ...interface{}) {
-	logger.Errorw(msg, keysAndValues...)
+	std.sugar().Errorw(msg, keysAndValues...)
 }
@@ -0,0 +1,106 @@
+package logger_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/overload-ak/cosmos-firewall/logger"
+)
+
+func TestParseLevels(t *testing.T) {
+	levels, err := logger.ParseLevels("")
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.InfoLevel, levels.Default)
+	assert.Empty(t, levels.Subsystems)
+
+	levels, err = logger.ParseLevels("warn, node=debug,handler=error")
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.WarnLevel, levels.Default)
+	assert.Equal(t, zapcore.DebugLevel, levels.Of("node"))
+	assert.Equal(t, zapcore.ErrorLevel, levels.Of("handler"))
+	assert.Equal(t, zapcore.WarnLevel, levels.Of("middleware"))
+	assert.Equal(t, "warn,handler=error,node=debug", levels.String())
+
+	levels, err = logger.ParseLevels("node=debug,*=error")
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.ErrorLevel, levels.Default)
+
+	for _, spec := range []string{"verbose", "node=verbose", "=debug", "nodes=debug"} {
+		_, err = logger.ParseLevels(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	defer logger.Init("info")
+	file := filepath.Join(t.TempDir(), "firewall.log")
+	require.NoError(t, logger.Setup("info,node=debug,handler=warn", logger.Options{Format: logger.FormatJSON, Output: logger.OutputFile, File: file}))
+
+	node, handler := logger.Named("node"), logger.Named("handler")
+	node.Debug("node debug")
+	handler.Info("handler info")
+	handler.Ctx(logger.WithFields(context.Background(), "request_id", "req-1")).Warn("handler warn")
+	logger.Debug("main debug")
+	assert.True(t, node.Enabled(zapcore.DebugLevel))
+	assert.False(t, handler.Enabled(zapcore.InfoLevel))
+
+	require.Error(t, logger.SetLevels("node=verbose"))
+	require.NoError(t, logger.SetLevels("error,handler=info"))
+	assert.Equal(t, "error,handler=info", logger.GetLevels().String())
+	node.Warn("node warn")
+	handler.Info("handler info")
+
+	lines := readLines(t, file)
+	require.Len(t, lines, 3)
+	assert.Equal(t, "node", lines[0]["logger"])
+	assert.Equal(t, "debug", lines[0]["level"])
+	assert.Equal(t, "node debug", lines[0]["msg"])
+	assert.Equal(t, "handler warn", lines[1]["msg"])
+	assert.Equal(t, "req-1", lines[1]["request_id"])
+	assert.Equal(t, "handler", lines[2]["logger"])
+	assert.Equal(t, "handler info", lines[2]["msg"])
+
+	assert.Error(t, logger.Setup("info", logger.Options{Format: "xml"}))
+	assert.Error(t, logger.Setup("info", logger.Options{Output: logger.OutputFile}))
+}
+
+func readLines(t *testing.T, file string) []map[string]interface{} {
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRotation(t *testing.T) {
+	assert.NoError(t, logger.Rotation{MaxSizeMB: 1}.Validate("log"))
+	assert.EqualError(t, logger.Rotation{}.Validate("audit"), "invalid audit max size: 0")
+	assert.EqualError(t, logger.Rotation{MaxSizeMB: 1, RotateSecond: -1}.Validate("access log"), "invalid access log rotation")
+
+	// the file output is rotated every RotateSecond
+	defer logger.Init("info")
+	dir := t.TempDir()
+	require.NoError(t, logger.Setup("info", logger.Options{Output: logger.OutputFile, File: filepath.Join(dir, "firewall.log"),
+		Rotation: logger.Rotation{MaxSizeMB: 1, RotateSecond: 1}}))
+	logger.Info("before rotation")
+	time.Sleep(1100 * time.Millisecond)
+	logger.Info("after rotation")
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Rotation defines the rotation of a log file: once over MaxSizeMB and every RotateSecond, 0
+// rotating it on size only. The rotated files are kept MaxBackups at most and MaxAgeDays, zero
+// keeping them all, and compressed with gzip when Compress is set.
+type Rotation struct {
+	MaxSizeMB    int   `mapstructure:"max-size-mb"`
+	RotateSecond int64 `mapstructure:"rotate-second"`
+	MaxBackups   int   `mapstructure:"max-backups"`
+	MaxAgeDays   int   `mapstructure:"max-age-days"`
+	Compress     bool  `mapstructure:"compress"`
+}
+
+// Validate checks the rotation of the log named name.
+func (r Rotation) Validate(name string) error {
+	if r.MaxSizeMB <= 0 {
+		return fmt.Errorf("invalid %s max size: %d", name, r.MaxSizeMB)
+	}
+	if r.RotateSecond < 0 || r.MaxBackups < 0 || r.MaxAgeDays < 0 {
+		return fmt.Errorf("invalid %s rotation", name)
+	}
+	return nil
+}
+
+// Open returns the file a log is appended to, rotated by size, and every RotateSecond until
+// it is closed.
+func (r Rotation) Open(filename string) io.WriteCloser {
+	file := &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    r.MaxSizeMB,
+		MaxBackups: r.MaxBackups,
+		MaxAge:     r.MaxAgeDays,
+		Compress:   r.Compress,
+	}
+	if r.RotateSecond <= 0 {
+		return file
+	}
+	return newRotatingFile(file, r.RotateSecond)
+}
+
+// rotatingFile is a log file rotated every rotateSecond until it is closed.
+type rotatingFile struct {
+	*lumberjack.Logger
+	stop chan struct{}
+	once sync.Once
+}
+
+func newRotatingFile(file *lumberjack.Logger, rotateSecond int64) *rotatingFile {
+	f := &rotatingFile{Logger: file, stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(time.Duration(rotateSecond) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.stop:
+				return
+			case <-ticker.C:
+				if err := f.Rotate(); err != nil {
+					// the log can not be written to, report it on stderr
+					_, _ = fmt.Fprintf(os.Stderr, "rotate log file %s: %s\n", f.Filename, err.Error())
+				}
+			}
+		}
+	}()
+	return f
+}
+
+func (f *rotatingFile) Close() error {
+	f.once.Do(func() { close(f.stop) })
+	return f.Logger.Close()
+}